@@ -0,0 +1,332 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/linuxswords/wandering-inn/internal/epub"
+	"github.com/linuxswords/wandering-inn/internal/export"
+	"github.com/linuxswords/wandering-inn/internal/models"
+	"github.com/linuxswords/wandering-inn/internal/scraper"
+	"github.com/linuxswords/wandering-inn/internal/ui"
+)
+
+func runBuild(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("build", flag.ExitOnError)
+	var rangeOpts ui.RangeOptions
+	addRangeFlags(fs, &rangeOpts)
+	output := fs.String("output", "", "path of the file to write")
+	var filenameOpts filenameOptions
+	addFilenameFlags(fs, &filenameOpts)
+	var format string
+	addFormatFlag(fs, &format)
+	var exportOpts exportOptions
+	addExportFlags(fs, &exportOpts)
+	profile := addProfileFlag(fs)
+	cssPath := fs.String("css", "", "stylesheet to embed instead of the default one")
+	coverPath := fs.String("cover", "", "image to use as the cover instead of a generated one")
+	byVolume := fs.Bool("by-volume", false, "pick whole volumes in the interactive selector")
+	resume := fs.Bool("resume", false, "continue the last unfinished build instead of selecting chapters")
+	force := fs.Bool("force", false, "discard the last unfinished build and start a new one")
+	workDir := fs.String("work-dir", "", "directory for the progress of unfinished builds (default: $XDG_CACHE_HOME/wandering-inn/build)")
+	var fetchOpts fetchOptions
+	addFetchFlags(fs, &fetchOpts)
+	addConcurrencyFlag(fs, &fetchOpts)
+	var imageOpts epub.ImageOptions
+	addImageFlags(fs, &imageOpts)
+	var metadata epub.Metadata
+	addMetadataFlags(fs, &metadata)
+	fs.Parse(args)
+
+	if *resume && (rangeOpts.IsSet() || *byVolume) {
+		return fmt.Errorf("--resume continues the previous selection and cannot be combined with selection flags")
+	}
+	if *resume && *force {
+		return fmt.Errorf("--resume and --force cannot be combined")
+	}
+
+	var err error
+	if *workDir == "" {
+		*workDir, err = epub.DefaultWorkDir()
+		if err != nil {
+			return fmt.Errorf("locating work directory: %w", err)
+		}
+	}
+
+	// A resumed build is made with the settings it was started with
+	var manifest *epub.Manifest
+	if *resume {
+		manifest, err = epub.LoadManifest(*workDir)
+		if err != nil {
+			return err
+		}
+		if err := restoreFlags(fs, manifest); err != nil {
+			return err
+		}
+		if *output == "" {
+			*output = manifest.Output
+		}
+		if !formatGiven(fs) && manifest.Format != "" {
+			format = manifest.Format
+		}
+	} else if err := applyProfile(fs, *profile); err != nil {
+		return err
+	}
+
+	if err := checkFormat(format); err != nil {
+		return err
+	}
+	if err := checkFilenameOptions(filenameOpts); err != nil {
+		return err
+	}
+	if err := checkExportOptions(exportOpts, format, *output); err != nil {
+		return err
+	}
+	if err := checkMetadata(metadata); err != nil {
+		return err
+	}
+	if err := checkImageOptions(imageOpts); err != nil {
+		return err
+	}
+
+	formatter, err := loadFormatter(*cssPath)
+	if err != nil {
+		return err
+	}
+	cover, err := loadCover(*coverPath)
+	if err != nil {
+		return err
+	}
+
+	images, err := fetchOpts.imageSource()
+	if err != nil {
+		return err
+	}
+
+	cli := ui.NewCLI()
+	cli.PrintWelcome()
+
+	scraperImpl, err := newScraper(fetchOpts)
+	if err != nil {
+		return err
+	}
+
+	var selectedChapters []models.Chapter
+	if *resume {
+		selectedChapters = manifest.Chapters
+		pending := manifest.Pending()
+		fmt.Printf("Resuming build of %d chapters, %d already downloaded\n", len(selectedChapters), len(selectedChapters)-len(pending))
+		if err := checkArchived(fetchOpts, pending); err != nil {
+			return err
+		}
+	} else {
+		selectedChapters, err = selectChapters(ctx, cli, scraperImpl, rangeOpts, *byVolume)
+		if err != nil {
+			return err
+		}
+		if len(selectedChapters) == 0 {
+			return fmt.Errorf("no chapters selected")
+		}
+
+		if err := checkArchived(fetchOpts, selectedChapters); err != nil {
+			return err
+		}
+	}
+
+	// Everything that can fail is set up before a new manifest is started,
+	// so a mistake in the flags does not leave an unfinished build behind
+	var exporter *export.Exporter
+	var epubCreator *epub.EPUBCreator
+	if format != "epub" {
+		exportOpts.html = export.HTMLOptions{CSS: formatter.GetCSS(), Images: imageOpts, ImageFetcher: images}
+		exportOpts.pdf.CSS, exportOpts.pdf.Images, exportOpts.pdf.ImageFetcher = formatter.GetCSS(), imageOpts, images
+
+		renderer, err := newRenderer(format, exportOpts)
+		if err != nil {
+			return err
+		}
+		exporter = export.NewExporter(renderer)
+		exporter.SetProgressCallback(cli.PrintDownloadProgress)
+		exporter.SetOutputPath(*output)
+		exporter.SetSplit(exportOpts.split)
+		exporter.SetMetadata(metadata)
+		exporter.SetConcurrency(fetchOpts.concurrency)
+		if err := setFilenameOptions(exporter, filenameOpts); err != nil {
+			return err
+		}
+	} else {
+		epubCreator = epub.NewEPUBCreator()
+		epubCreator.SetProgressCallback(cli.PrintDownloadProgress)
+		epubCreator.SetOutputPath(*output)
+		epubCreator.SetFormatter(formatter)
+		epubCreator.SetCover(cover)
+		epubCreator.SetMetadata(metadata)
+		epubCreator.SetConcurrency(fetchOpts.concurrency)
+		epubCreator.SetImageFetcher(images)
+		epubCreator.SetImageOptions(imageOpts)
+		if err := setFilenameOptions(epubCreator, filenameOpts); err != nil {
+			return err
+		}
+	}
+
+	if !*resume {
+		flags, err := recordFlags(fs, metadata.Subjects)
+		if err != nil {
+			return err
+		}
+		manifest, err = startManifest(*workDir, selectedChapters, *output, format, flags, *force)
+		if err != nil {
+			return err
+		}
+	}
+
+	cli.PrintCreationInfo(len(selectedChapters), selectedChapters[0].Index+1, selectedChapters[len(selectedChapters)-1].Index+1)
+
+	if exporter != nil {
+		exporter.SetManifest(manifest)
+		err = exporter.ExportContext(ctx, selectedChapters, scraperImpl)
+	} else {
+		epubCreator.SetManifest(manifest)
+		err = epubCreator.CreateEPUBContext(ctx, selectedChapters, scraperImpl)
+	}
+	return finishBuild(manifest, format, err)
+}
+
+// startManifest starts recording the progress of a new build in workDir,
+// with the flags it is made with. With force, an unfinished build there is
+// discarded first.
+func startManifest(workDir string, chapters []models.Chapter, output, format string, flags []epub.Flag, force bool) (*epub.Manifest, error) {
+	if force {
+		if err := epub.DiscardManifest(workDir); err != nil {
+			return nil, fmt.Errorf("discarding unfinished build: %w", err)
+		}
+	}
+	manifest, err := epub.NewManifest(workDir, chapters, output)
+	if errors.Is(err, epub.ErrUnfinishedBuild) {
+		return nil, fmt.Errorf("%w; continue it with --resume, or start over with --force", err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("starting build manifest: %w", err)
+	}
+
+	if err := manifest.SetSettings(format, flags); err != nil {
+		// Nothing was downloaded yet, so there is nothing to resume
+		manifest.Remove()
+		return nil, fmt.Errorf("saving build manifest: %w", err)
+	}
+	return manifest, nil
+}
+
+// unrecordedFlags are the flags of build that do not shape the book, or are
+// kept in the manifest on their own: the chapter selection, where chapters
+// come from, and the format and output path. All other flags are recorded
+// for --resume.
+var unrecordedFlags = []string{
+	"from", "to", "last", "all", "volume", "volumes", "by-volume",
+	"resume", "force", "work-dir", "profile",
+	"cache-dir", "no-cache", "offline", "archive", "concurrency",
+	"format", "output",
+}
+
+// pathFlags are the flags naming files, which are recorded as absolute paths
+// so a build can be resumed from another directory. --font also takes the
+// name of a built-in font, which is kept as it is.
+var pathFlags = []string{"css", "cover", "output-dir", "font", "font-bold", "font-italic", "font-bold-italic"}
+
+// recordFlags returns the flags given for a new build, on the command line or
+// by a profile, that shape the book.
+func recordFlags(fs *flag.FlagSet, subjects []string) ([]epub.Flag, error) {
+	var flags []epub.Flag
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		if err != nil || slices.Contains(unrecordedFlags, f.Name) {
+			return
+		}
+		// --subject can be repeated, and its value only holds the last one
+		if f.Name == "subject" {
+			for _, subject := range subjects {
+				flags = append(flags, epub.Flag{Name: f.Name, Value: subject})
+			}
+			return
+		}
+
+		value := f.Value.String()
+		if slices.Contains(pathFlags, f.Name) && value != "" && !filepath.IsAbs(value) {
+			if _, statErr := os.Stat(value); statErr == nil || f.Name == "output-dir" {
+				value, err = filepath.Abs(value)
+			}
+		}
+		flags = append(flags, epub.Flag{Name: f.Name, Value: value})
+	})
+	return flags, err
+}
+
+// restoreFlags sets the flags recorded for the build being resumed. Flags
+// that shape the book cannot be given again, as the resumed book would not
+// match the chapters already downloaded for it.
+func restoreFlags(fs *flag.FlagSet, manifest *epub.Manifest) error {
+	var given []string
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "profile" || !slices.Contains(unrecordedFlags, f.Name) {
+			given = append(given, "--"+f.Name)
+		}
+	})
+	if len(given) > 0 {
+		return fmt.Errorf("%s cannot be given with --resume; the build continues with the settings it was started with", strings.Join(given, ", "))
+	}
+
+	for _, f := range manifest.Flags {
+		if err := fs.Set(f.Name, f.Value); err != nil {
+			return fmt.Errorf("restoring --%s of the build: %w", f.Name, err)
+		}
+	}
+	return nil
+}
+
+// finishBuild reports chapters that are still missing after a build and
+// wraps its error. A build that failed before downloading anything is not
+// worth resuming, so its manifest is removed.
+func finishBuild(manifest *epub.Manifest, format string, err error) error {
+	pending := manifest.Pending()
+	if err != nil && len(pending) == len(manifest.Chapters) {
+		manifest.Remove()
+	} else if len(pending) > 0 {
+		fmt.Printf("%d chapters are still missing; run 'wandering-inn build --resume' to fetch them and finish the book, or 'wandering-inn build --force' to start a new one\n", len(pending))
+	}
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", strings.ToUpper(format), err)
+	}
+	return nil
+}
+
+// selectChapters fetches the table of contents and lets the user pick the
+// chapters to build, from the range flags or interactively.
+func selectChapters(ctx context.Context, cli *ui.CLI, scraperImpl scraper.ContextScraper, rangeOpts ui.RangeOptions, byVolume bool) ([]models.Chapter, error) {
+	chapters, err := scraperImpl.FetchTableOfContentsContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("fetching table of contents: %w", err)
+	}
+
+	switch {
+	case rangeOpts.IsSet():
+		startIndex, endIndex, err := ui.SelectRange(chapters, rangeOpts)
+		if err != nil {
+			return nil, fmt.Errorf("selecting chapters: %w", err)
+		}
+		return chapters[startIndex-1 : endIndex], nil
+	case byVolume:
+		return cli.GetVolumesInteractive(scraper.GroupByVolume(chapters)), nil
+	default:
+		cli.PrintChapterInfo(chapters)
+
+		startIndex := cli.GetStartChapterInteractive(chapters)
+		endIndex := cli.GetEndChapterInteractive(chapters, startIndex)
+		return chapters[startIndex-1 : endIndex], nil
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/linuxswords/wandering-inn/internal/config"
+	"github.com/linuxswords/wandering-inn/internal/scraper"
+	"github.com/linuxswords/wandering-inn/internal/ui"
+)
+
+func runFetch(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("fetch", flag.ExitOnError)
+	var rangeOpts ui.RangeOptions
+	addRangeFlags(fs, &rangeOpts)
+	var fetchOpts fetchOptions
+	addCacheFlags(fs, &fetchOpts)
+	addArchiveFlag(fs, &fetchOpts)
+	refresh := fs.Bool("refresh", false, "download chapters again even if they are already archived")
+	fs.Parse(args)
+
+	source, err := fetchOpts.pageSource()
+	if err != nil {
+		return err
+	}
+	archive, err := fetchOpts.openArchive()
+	if err != nil {
+		return err
+	}
+
+	if err := archive.Save(ctx, source, config.TOCUrl); err != nil {
+		return fmt.Errorf("fetching table of contents: %w", err)
+	}
+
+	archived := scraper.NewWanderingInnScraper()
+	archived.SetPageFetcher(archive)
+
+	chapters, err := archived.FetchTableOfContentsContext(ctx)
+	if err != nil {
+		return fmt.Errorf("reading archived table of contents: %w", err)
+	}
+
+	if rangeOpts.IsSet() {
+		start, end, err := ui.SelectRange(chapters, rangeOpts)
+		if err != nil {
+			return fmt.Errorf("selecting chapters: %w", err)
+		}
+		chapters = chapters[start-1 : end]
+	}
+
+	cli := ui.NewCLI()
+	saved, skipped, failed, images := 0, 0, 0, 0
+	for i, chapter := range chapters {
+		if ctx.Err() != nil {
+			break
+		}
+		if *refresh || !archive.Has(chapter.URL) {
+			cli.PrintDownloadProgress(i+1, len(chapters), chapter.Title)
+			if err := archive.Save(ctx, source, chapter.URL); err != nil {
+				if ctx.Err() != nil {
+					break
+				}
+				fmt.Printf("Warning: Failed to fetch chapter %s: %v\n", chapter.Title, err)
+				failed++
+				continue
+			}
+			saved++
+		} else {
+			skipped++
+		}
+
+		// Images are checked for archived chapters too, which older archives
+		// have without their images
+		n, err := archive.SaveImages(ctx, source, chapter)
+		images += n
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			fmt.Printf("Warning: Failed to fetch images of chapter %s: %v\n", chapter.Title, err)
+		}
+	}
+
+	fmt.Printf("Archive %s: %d chapters saved, %d already archived, %d failed; %d images saved\n", archive.Dir(), saved, skipped, failed, images)
+	if ctx.Err() != nil {
+		return fmt.Errorf("interrupted, run 'wandering-inn fetch' again to fetch the remaining chapters: %w", ctx.Err())
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d chapters could not be fetched", failed)
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/linuxswords/wandering-inn/internal/epub"
+	"github.com/linuxswords/wandering-inn/internal/ui"
+)
+
+func runInfo(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("info", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: wandering-inn info BOOK.epub")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("info needs exactly one EPUB file")
+	}
+
+	book, err := epub.ReadEPUB(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", fs.Arg(0), err)
+	}
+
+	ui.NewCLI().PrintBookInfo(book)
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/linuxswords/wandering-inn/internal/models"
+	"github.com/linuxswords/wandering-inn/internal/ui"
+)
+
+func runList(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	var rangeOpts ui.RangeOptions
+	addRangeFlags(fs, &rangeOpts)
+	search := fs.String("search", "", "only show chapters whose title contains this text")
+	asJSON := fs.Bool("json", false, "print the chapters as JSON")
+	var fetchOpts fetchOptions
+	addFetchFlags(fs, &fetchOpts)
+	fs.Parse(args)
+
+	scraperImpl, err := newScraper(fetchOpts)
+	if err != nil {
+		return err
+	}
+
+	chapters, err := scraperImpl.FetchTableOfContentsContext(ctx)
+	if err != nil {
+		return fmt.Errorf("fetching table of contents: %w", err)
+	}
+
+	if rangeOpts.IsSet() {
+		start, end, err := ui.SelectRange(chapters, rangeOpts)
+		if err != nil {
+			return fmt.Errorf("selecting chapters: %w", err)
+		}
+		chapters = chapters[start-1 : end]
+	}
+
+	if *search != "" {
+		var matches []models.Chapter
+		for _, chapter := range chapters {
+			if strings.Contains(strings.ToLower(chapter.Title), strings.ToLower(*search)) {
+				matches = append(matches, chapter)
+			}
+		}
+		chapters = matches
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if chapters == nil {
+			chapters = []models.Chapter{}
+		}
+		return encoder.Encode(chapters)
+	}
+
+	ui.NewCLI().PrintChapterList(chapters)
+	return nil
+}
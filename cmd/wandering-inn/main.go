@@ -1,38 +1,115 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
-	"github.com/linuxswords/wandering-inn/internal/epub"
-	"github.com/linuxswords/wandering-inn/internal/scraper"
-	"github.com/linuxswords/wandering-inn/internal/ui"
+	"github.com/linuxswords/wandering-inn/internal/config"
 )
 
-func main() {
-	cli := ui.NewCLI()
-	cli.PrintWelcome()
+type command struct {
+	name        string
+	description string
+	run         func(ctx context.Context, args []string) error
+}
 
-	scraperImpl := scraper.NewWanderingInnScraper()
-	epubCreator := epub.NewEPUBCreator()
+var commands = []command{
+	{name: "build", description: "Create an EPUB from a range of chapters (default)", run: runBuild},
+	{name: "list", description: "Print the table of contents", run: runList},
+	{name: "update", description: "Append newly released chapters to an existing EPUB", run: runUpdate},
+	{name: "info", description: "Show the metadata and chapters of an EPUB", run: runInfo},
+	{name: "fetch", description: "Save the table of contents and chapters to a local archive", run: runFetch},
+	{name: "watch", description: "Check for new chapters on a schedule and build or update an EPUB", run: runWatch},
+}
 
-	chapters, err := scraperImpl.FetchTableOfContents()
-	if err != nil {
-		log.Fatalf("Error fetching table of contents: %v", err)
+func main() {
+	args := os.Args[1:]
+
+	name := "build"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
 	}
 
-	cli.PrintChapterInfo(chapters)
+	if name == "help" {
+		printUsage()
+		return
+	}
 
-	startIndex := cli.GetStartChapterInteractive(chapters)
-	endIndex := cli.GetEndChapterInteractive(chapters, startIndex)
+	for _, cmd := range commands {
+		if cmd.name == name {
+			if err := loadConfig(); err != nil {
+				log.Fatalf("Error: %v", err)
+			}
 
-	selectedChapters := chapters[startIndex-1 : endIndex]
+			ctx, stop := interruptContext()
+			err := cmd.run(ctx, args)
+			stop()
+			if err != nil {
+				log.Fatalf("Error: %v", err)
+			}
+			return
+		}
+	}
 
-	cli.PrintCreationInfo(len(selectedChapters), startIndex, endIndex)
+	fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", name)
+	printUsage()
+	os.Exit(2)
+}
 
-	epubCreator.SetProgressCallback(cli.PrintDownloadProgress)
+// loadConfig applies the user's config file, if there is one.
+func loadConfig() error {
+	path, err := config.DefaultConfigPath()
+	if err != nil {
+		return fmt.Errorf("locating config file: %w", err)
+	}
+	if path == "" {
+		return nil
+	}
 
-	err = epubCreator.CreateEPUB(selectedChapters, scraperImpl)
+	file, err := config.LoadFile(path)
 	if err != nil {
-		log.Fatalf("Error creating EPUB: %v", err)
+		return fmt.Errorf("reading config file: %w", err)
+	}
+	file.Apply()
+	return nil
+}
+
+// interruptContext returns a context that is cancelled on SIGINT or SIGTERM,
+// so commands can stop downloading and save what they have. A second signal
+// terminates the program as usual.
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case <-signals:
+			fmt.Fprintln(os.Stderr, "\nInterrupted, finishing up (press Ctrl+C again to quit immediately)...")
+			signal.Stop(signals)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel()
+	}
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "Usage: wandering-inn <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", cmd.name, cmd.description)
 	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Run 'wandering-inn <command> -h' for the flags of a command.")
 }
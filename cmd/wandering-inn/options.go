@@ -0,0 +1,439 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/linuxswords/wandering-inn/internal/config"
+	"github.com/linuxswords/wandering-inn/internal/epub"
+	"github.com/linuxswords/wandering-inn/internal/export"
+	"github.com/linuxswords/wandering-inn/internal/models"
+	"github.com/linuxswords/wandering-inn/internal/scraper"
+	"github.com/linuxswords/wandering-inn/internal/ui"
+	"github.com/linuxswords/wandering-inn/pkg/utils"
+)
+
+func addRangeFlags(fs *flag.FlagSet, opts *ui.RangeOptions) {
+	fs.StringVar(&opts.From, "from", "", "first chapter, by title (e.g. 9.01, \"Interlude - Pawn\") or list number")
+	fs.StringVar(&opts.To, "to", "", "last chapter, by title or list number")
+	fs.IntVar(&opts.Last, "last", 0, "select only the latest N chapters")
+	fs.BoolVar(&opts.All, "all", false, "select every chapter")
+	fs.StringVar(&opts.Volumes, "volume", "", "select a whole volume by number, e.g. 7")
+	fs.StringVar(&opts.Volumes, "volumes", "", "select a range of volumes, e.g. 3-5")
+}
+
+type fetchOptions struct {
+	cacheDir    string
+	noCache     bool
+	offline     bool
+	archiveDir  string
+	concurrency int
+}
+
+func addFetchFlags(fs *flag.FlagSet, opts *fetchOptions) {
+	addCacheFlags(fs, opts)
+	fs.BoolVar(&opts.offline, "offline", false, "read the table of contents and chapters only from the local archive")
+	addArchiveFlag(fs, opts)
+}
+
+func addConcurrencyFlag(fs *flag.FlagSet, opts *fetchOptions) {
+	fs.IntVar(&opts.concurrency, "concurrency", config.DefaultConcurrency, "number of chapters to download in parallel")
+}
+
+func addCacheFlags(fs *flag.FlagSet, opts *fetchOptions) {
+	fs.StringVar(&opts.cacheDir, "cache-dir", "", "directory of the chapter cache (default: $XDG_CACHE_HOME/wandering-inn/chapters)")
+	fs.BoolVar(&opts.noCache, "no-cache", false, "download every chapter without using the cache")
+}
+
+func addArchiveFlag(fs *flag.FlagSet, opts *fetchOptions) {
+	fs.StringVar(&opts.archiveDir, "archive", "", "directory of the local chapter archive (default: $XDG_DATA_HOME/wandering-inn/archive)")
+}
+
+// pageSource returns where pages are downloaded from when online: the site,
+// through the on-disk cache unless it is disabled.
+func (opts fetchOptions) pageSource() (scraper.PageFetcher, error) {
+	if opts.noCache {
+		return scraper.HTTPFetcher{}, nil
+	}
+
+	dir := opts.cacheDir
+	if dir == "" {
+		var err error
+		dir, err = scraper.DefaultCacheDir()
+		if err != nil {
+			return nil, fmt.Errorf("locating cache directory: %w", err)
+		}
+	}
+	return scraper.NewChapterCache(dir), nil
+}
+
+func (opts fetchOptions) openArchive() (*scraper.Archive, error) {
+	dir := opts.archiveDir
+	if dir == "" {
+		var err error
+		dir, err = scraper.DefaultArchiveDir()
+		if err != nil {
+			return nil, fmt.Errorf("locating archive directory: %w", err)
+		}
+	}
+	return scraper.NewArchive(dir), nil
+}
+
+// imageSource returns where images are downloaded from, which is the same
+// place as pages.
+func (opts fetchOptions) imageSource() (scraper.PageFetcher, error) {
+	if opts.offline {
+		return opts.openArchive()
+	}
+	return opts.pageSource()
+}
+
+func addImageFlags(fs *flag.FlagSet, opts *epub.ImageOptions) {
+	fs.BoolVar(&opts.Skip, "no-images", false, "leave images out of the book")
+	fs.IntVar(&opts.MaxWidth, "max-image-width", 0, "downscale images wider than this many pixels (default: keep their size)")
+	fs.IntVar(&opts.Quality, "image-quality", 0, "re-encode images as JPEG with this quality, 1-100 (default: keep their format)")
+}
+
+func checkImageOptions(imageOpts epub.ImageOptions) error {
+	if imageOpts.Quality < 0 || imageOpts.Quality > 100 {
+		return fmt.Errorf("--image-quality must be between 1 and 100")
+	}
+	if imageOpts.MaxWidth < 0 {
+		return fmt.Errorf("--max-image-width must not be negative")
+	}
+	return nil
+}
+
+func setImageOptions(epubCreator *epub.EPUBCreator, fetchOpts fetchOptions, imageOpts epub.ImageOptions) error {
+	if err := checkImageOptions(imageOpts); err != nil {
+		return err
+	}
+
+	images, err := fetchOpts.imageSource()
+	if err != nil {
+		return err
+	}
+	epubCreator.SetImageFetcher(images)
+	epubCreator.SetImageOptions(imageOpts)
+	return nil
+}
+
+func newScraper(opts fetchOptions) (*scraper.WanderingInnScraper, error) {
+	var pages scraper.PageFetcher
+	var err error
+	if opts.offline {
+		pages, err = opts.openArchive()
+	} else {
+		pages, err = opts.pageSource()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	scraperImpl := scraper.NewWanderingInnScraper()
+	scraperImpl.SetPageFetcher(pages)
+	return scraperImpl, nil
+}
+
+// checkArchived fails an offline build up front if any selected chapter is
+// missing from the archive, instead of leaving holes in the book.
+func checkArchived(opts fetchOptions, chapters []models.Chapter) error {
+	if !opts.offline {
+		return nil
+	}
+
+	archive, err := opts.openArchive()
+	if err != nil {
+		return err
+	}
+
+	missing := archive.Missing(chapters)
+	if len(missing) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d of the selected chapters are not in the archive at %s (first missing: %s); run 'wandering-inn fetch' for them first",
+		len(missing), archive.Dir(), missing[0].Title)
+}
+
+// formats are the output formats build can write.
+var formats = []string{"epub", "txt", "md", "html", "pdf"}
+
+func addFormatFlag(fs *flag.FlagSet, format *string) {
+	fs.StringVar(format, "format", "epub", "output format: "+strings.Join(formats, ", "))
+}
+
+// formatGiven reports whether the format was chosen on the command line or
+// by a profile, rather than left at its default.
+func formatGiven(fs *flag.FlagSet) bool {
+	given := false
+	fs.Visit(func(f *flag.Flag) { given = given || f.Name == "format" })
+	return given
+}
+
+func checkFormat(format string) error {
+	if !slices.Contains(formats, format) {
+		return fmt.Errorf("unknown --format %q, want one of: %s", format, strings.Join(formats, ", "))
+	}
+	return nil
+}
+
+// exportOptions are the settings of the formats other than EPUB.
+type exportOptions struct {
+	split bool
+	text  export.TextOptions
+	html  export.HTMLOptions
+	pdf   export.PDFOptions
+}
+
+func addExportFlags(fs *flag.FlagSet, opts *exportOptions) {
+	opts.text = export.DefaultTextOptions()
+	fs.BoolVar(&opts.split, "split", false, "write one file per chapter (not for epub)")
+	fs.IntVar(&opts.text.Width, "wrap", opts.text.Width, "txt: column to wrap paragraphs at, 0 to not wrap")
+	fs.StringVar(&opts.text.Emphasis, "emphasis", opts.text.Emphasis, "txt: marker put around emphasized text")
+	fs.StringVar(&opts.text.Strong, "strong", opts.text.Strong, "txt: marker put around bold text")
+
+	opts.pdf = export.DefaultPDFOptions()
+	fs.StringVar(&opts.pdf.PageSize, "page-size", opts.pdf.PageSize, "pdf: A3, A4, A5, A6, Letter, Legal, or WIDTHxHEIGHT in millimetres")
+	fs.Float64Var(&opts.pdf.Margin, "margin", opts.pdf.Margin, "pdf: page margin in millimetres")
+	fs.StringVar(&opts.pdf.Font, "font", opts.pdf.Font, "pdf: times, helvetica, courier, or the path of a TrueType font")
+	fs.StringVar(&opts.pdf.BoldFont, "font-bold", "", "pdf: TrueType font for bold text")
+	fs.StringVar(&opts.pdf.ItalicFont, "font-italic", "", "pdf: TrueType font for italic text")
+	fs.StringVar(&opts.pdf.BoldItalicFont, "font-bold-italic", "", "pdf: TrueType font for bold italic text")
+	fs.Float64Var(&opts.pdf.FontSize, "font-size", opts.pdf.FontSize, "pdf: size of body text in points")
+}
+
+func checkExportOptions(opts exportOptions, format, output string) error {
+	if opts.split && format == "epub" {
+		return fmt.Errorf("--split is not available for epub")
+	}
+	if opts.split && output != "" {
+		return fmt.Errorf("--split writes one file per chapter and cannot be combined with --output")
+	}
+	if opts.text.Width < 0 {
+		return fmt.Errorf("--wrap must not be negative")
+	}
+	if format != "epub" {
+		// Renderers check their options when they are made
+		if _, err := newRenderer(format, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newRenderer returns the renderer of a format other than EPUB.
+func newRenderer(format string, opts exportOptions) (export.Renderer, error) {
+	switch format {
+	case "txt":
+		return export.NewTextRenderer(opts.text), nil
+	case "md":
+		return export.NewMarkdownRenderer(), nil
+	case "html":
+		return export.NewHTMLRenderer(opts.html), nil
+	case "pdf":
+		renderer, err := export.NewPDFRenderer(opts.pdf)
+		if err != nil {
+			return nil, fmt.Errorf("pdf: %w", err)
+		}
+		return renderer, nil
+	}
+	return nil, fmt.Errorf("unknown --format %q, want one of: %s", format, strings.Join(formats, ", "))
+}
+
+type filenameOptions struct {
+	template  string
+	outputDir string
+	onExists  string
+}
+
+func addFilenameFlags(fs *flag.FlagSet, opts *filenameOptions) {
+	fs.StringVar(&opts.template, "filename", config.FilenameTemplate, "name of the file to write when --output is not given; can use {{series}}, {{volume}}, {{first}}, {{last}}, {{range}}, {{count}}, {{date}} and {{ext}}")
+	fs.StringVar(&opts.outputDir, "output-dir", "", "directory to write to when --output is not given (default: the current directory)")
+	fs.StringVar(&opts.onExists, "on-exists", string(utils.CollisionOverwrite), "what to do when the generated file name is taken: overwrite, or suffix to add _2, _3, ...")
+}
+
+func checkFilenameOptions(opts filenameOptions) error {
+	if err := utils.CheckFilenameTemplate(opts.template); err != nil {
+		return fmt.Errorf("--filename: %w", err)
+	}
+	policy := utils.CollisionPolicy(opts.onExists)
+	if policy != utils.CollisionOverwrite && policy != utils.CollisionSuffix {
+		return fmt.Errorf("--on-exists must be %s or %s", utils.CollisionOverwrite, utils.CollisionSuffix)
+	}
+	return nil
+}
+
+// filenameSetter is what files are named by: the EPUB creator or an
+// exporter.
+type filenameSetter interface {
+	SetFilenameTemplate(template string)
+	SetOutputDir(dir string)
+	SetCollisionPolicy(policy utils.CollisionPolicy)
+}
+
+func setFilenameOptions(target filenameSetter, opts filenameOptions) error {
+	if err := checkFilenameOptions(opts); err != nil {
+		return err
+	}
+
+	target.SetFilenameTemplate(opts.template)
+	target.SetOutputDir(opts.outputDir)
+	target.SetCollisionPolicy(utils.CollisionPolicy(opts.onExists))
+	return nil
+}
+
+func addProfileFlag(fs *flag.FlagSet) *string {
+	return fs.String("profile", "", "settings profile to use: "+config.ProfileNames())
+}
+
+// applyProfile sets the flags of fs that the named profile, or the default
+// profile of the config file if name is empty, has values for. Flags given on
+// the command line keep their values.
+func applyProfile(fs *flag.FlagSet, name string) error {
+	if name == "" {
+		name = config.DefaultProfile
+	}
+	if name == "" {
+		return nil
+	}
+	profile, ok := config.Profiles[name]
+	if !ok {
+		return fmt.Errorf("unknown profile %q (available: %s)", name, config.ProfileNames())
+	}
+
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	values := [][2]string{
+		{"format", profile.Format},
+		{"css", profile.CSS},
+		{"filename", profile.Filename},
+		{"title", profile.Metadata.Title},
+		{"author", profile.Metadata.Author},
+		{"description", profile.Metadata.Description},
+		{"series", profile.Metadata.Series},
+		{"language", profile.Metadata.Language},
+		{"publisher", profile.Metadata.Publisher},
+	}
+	for _, subject := range profile.Metadata.Subjects {
+		values = append(values, [2]string{"subject", subject})
+	}
+	if profile.Images.Skip {
+		values = append(values, [2]string{"no-images", "true"})
+	}
+	if profile.Images.MaxWidth > 0 {
+		values = append(values, [2]string{"max-image-width", strconv.Itoa(profile.Images.MaxWidth)})
+	}
+	if profile.Images.Quality > 0 {
+		values = append(values, [2]string{"image-quality", strconv.Itoa(profile.Images.Quality)})
+	}
+
+	for _, value := range values {
+		if value[1] == "" || given[value[0]] || fs.Lookup(value[0]) == nil {
+			continue
+		}
+		if err := fs.Set(value[0], value[1]); err != nil {
+			return fmt.Errorf("profile %s: %s: %w", name, value[0], err)
+		}
+	}
+	return nil
+}
+
+func addMetadataFlags(fs *flag.FlagSet, metadata *epub.Metadata) {
+	*metadata = epub.DefaultMetadata()
+	fs.StringVar(&metadata.Title, "title", metadata.Title, "title template; can use {{.Series}}, {{.Volume}}, {{.VolumeNumber}}, {{.First}}, {{.Last}}, {{.Range}} and {{.Count}}")
+	fs.StringVar(&metadata.Author, "author", metadata.Author, "author of the book")
+	fs.StringVar(&metadata.Description, "description", metadata.Description, "description template, with the same fields as --title")
+	fs.StringVar(&metadata.Series, "series", metadata.Series, "series the book belongs to (empty for none)")
+	fs.StringVar(&metadata.SeriesIndex, "series-index", "", "position in the series (default: the volume number, if all chapters are from one volume)")
+	fs.StringVar(&metadata.Language, "language", metadata.Language, "language of the book")
+	fs.StringVar(&metadata.Publisher, "publisher", "", "publisher of the book")
+	fs.Func("subject", "subject or genre of the book; can be repeated", func(subject string) error {
+		metadata.Subjects = append(metadata.Subjects, subject)
+		return nil
+	})
+	fs.StringVar(&metadata.Identifier, "identifier", "", "unique identifier of the book (default: derived from the series and chapter range)")
+	fs.StringVar(&metadata.Date, "date", "", "publication date as YYYY-MM-DD (default: when the last chapter was published, if known)")
+}
+
+func checkMetadata(metadata epub.Metadata) error {
+	if err := epub.CheckTemplate(metadata.Title); err != nil {
+		return fmt.Errorf("--title: %w", err)
+	}
+	if err := epub.CheckTemplate(metadata.Description); err != nil {
+		return fmt.Errorf("--description: %w", err)
+	}
+	return nil
+}
+
+// metadataFlags returns the names of the metadata flags given on the command
+// line, which override the metadata of a book being updated.
+func metadataFlags(fs *flag.FlagSet) []string {
+	var names []string
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "title", "author", "description", "series", "series-index", "language", "publisher", "subject", "identifier", "date":
+			names = append(names, f.Name)
+		}
+	})
+	return names
+}
+
+// clearMetadata removes the values of book that the named flags override, so
+// an update writes the flag values instead of keeping the book's.
+func clearMetadata(book *epub.Book, names []string) {
+	for _, name := range names {
+		switch name {
+		case "title":
+			book.Title = ""
+		case "author":
+			book.Author = ""
+		case "description":
+			book.Description = ""
+		case "series":
+			book.Series = ""
+		case "series-index":
+			book.SeriesIndex = ""
+		case "language":
+			book.Language = ""
+		case "publisher":
+			book.Publisher = ""
+		case "subject":
+			book.Subjects = nil
+		case "identifier":
+			book.Identifier = ""
+		case "date":
+			book.Date = ""
+		}
+	}
+}
+
+func loadCover(coverPath string) ([]byte, error) {
+	if coverPath == "" {
+		return nil, nil
+	}
+
+	cover, err := epub.LoadCover(coverPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading cover: %w", err)
+	}
+	return cover, nil
+}
+
+func loadFormatter(cssPath string) (*epub.Formatter, error) {
+	formatter := epub.NewFormatter()
+	if cssPath == "" {
+		return formatter, nil
+	}
+
+	css, err := os.ReadFile(cssPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading CSS: %w", err)
+	}
+	formatter.SetCSS(string(css))
+	return formatter, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/linuxswords/wandering-inn/internal/epub"
+	"github.com/linuxswords/wandering-inn/internal/models"
+	"github.com/linuxswords/wandering-inn/internal/scraper"
+	"github.com/linuxswords/wandering-inn/internal/ui"
+)
+
+func runUpdate(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("update", flag.ExitOnError)
+	output := fs.String("output", "", "path of the updated EPUB (default: overwrite the input)")
+	cssPath := fs.String("css", "", "stylesheet to embed instead of the default one")
+	coverPath := fs.String("cover", "", "image to use as the cover instead of a generated one")
+	profile := addProfileFlag(fs)
+	var fetchOpts fetchOptions
+	addFetchFlags(fs, &fetchOpts)
+	addConcurrencyFlag(fs, &fetchOpts)
+	var imageOpts epub.ImageOptions
+	addImageFlags(fs, &imageOpts)
+	var metadata epub.Metadata
+	addMetadataFlags(fs, &metadata)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: wandering-inn update [flags] BOOK.epub")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if err := applyProfile(fs, *profile); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("update needs exactly one EPUB file")
+	}
+
+	if err := checkMetadata(metadata); err != nil {
+		return err
+	}
+
+	formatter, err := loadFormatter(*cssPath)
+	if err != nil {
+		return err
+	}
+	cover, err := loadCover(*coverPath)
+	if err != nil {
+		return err
+	}
+
+	book, err := epub.ReadEPUB(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", fs.Arg(0), err)
+	}
+	clearMetadata(book, metadataFlags(fs))
+
+	cli := ui.NewCLI()
+	scraperImpl, err := newScraper(fetchOpts)
+	if err != nil {
+		return err
+	}
+	epubCreator := epub.NewEPUBCreator()
+
+	chapters, err := scraperImpl.FetchTableOfContentsContext(ctx)
+	if err != nil {
+		return fmt.Errorf("fetching table of contents: %w", err)
+	}
+
+	epubCreator.SetProgressCallback(cli.PrintDownloadProgress)
+	epubCreator.SetOutputPath(*output)
+	epubCreator.SetFormatter(formatter)
+	epubCreator.SetCover(cover)
+	epubCreator.SetMetadata(metadata)
+	epubCreator.SetConcurrency(fetchOpts.concurrency)
+	if err := setImageOptions(epubCreator, fetchOpts, imageOpts); err != nil {
+		return err
+	}
+
+	_, err = updateBook(ctx, epubCreator, book, chapters, scraperImpl, fetchOpts)
+	return err
+}
+
+// updateBook adds the chapters of the table of contents that book is missing,
+// and returns how many there were.
+func updateBook(ctx context.Context, epubCreator epub.Updater, book *epub.Book, toc []models.Chapter, scraperImpl scraper.Scraper, fetchOpts fetchOptions) (int, error) {
+	book.MatchSources(toc)
+	newChapters, err := epub.NewChapters(book, toc)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(newChapters) == 0 {
+		fmt.Printf("%s is up to date\n", book.Path)
+		return 0, nil
+	}
+
+	if err := checkArchived(fetchOpts, newChapters); err != nil {
+		return 0, err
+	}
+
+	fmt.Printf("Adding %d chapters to %s\n", len(newChapters), book.Path)
+
+	if err := epubCreator.UpdateEPUBContext(ctx, book, newChapters, scraperImpl); err != nil {
+		return 0, fmt.Errorf("updating EPUB: %w", err)
+	}
+	return len(newChapters), nil
+}
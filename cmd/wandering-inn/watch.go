@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/linuxswords/wandering-inn/internal/config"
+	"github.com/linuxswords/wandering-inn/internal/epub"
+	"github.com/linuxswords/wandering-inn/internal/models"
+	"github.com/linuxswords/wandering-inn/internal/scraper"
+	"github.com/linuxswords/wandering-inn/internal/ui"
+)
+
+type watchOptions struct {
+	output      string
+	formatter   *epub.Formatter
+	cover       []byte
+	feedContent bool
+	fetchOpts   fetchOptions
+	imageOpts   epub.ImageOptions
+	filenames   filenameOptions
+	metadata    epub.Metadata
+	// overrides are the metadata flags given, which replace the metadata of
+	// the book when it is updated.
+	overrides []string
+}
+
+func runWatch(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	interval := fs.Duration("interval", config.DefaultWatchInterval, "how often to check the table of contents")
+	output := fs.String("output", "", "EPUB to keep up to date; without it, each batch of new chapters becomes a new EPUB")
+	statePath := fs.String("state", "", "file recording the chapters already seen (default: $XDG_DATA_HOME/wandering-inn/seen.json)")
+	cssPath := fs.String("css", "", "stylesheet to embed instead of the default one")
+	coverPath := fs.String("cover", "", "image to use as the cover instead of a generated one")
+	profile := addProfileFlag(fs)
+	var filenameOpts filenameOptions
+	addFilenameFlags(fs, &filenameOpts)
+	feedContent := fs.Bool("feed-content", false, "take the chapter text from the feed instead of downloading chapter pages")
+	var fetchOpts fetchOptions
+	addCacheFlags(fs, &fetchOpts)
+	addConcurrencyFlag(fs, &fetchOpts)
+	var imageOpts epub.ImageOptions
+	addImageFlags(fs, &imageOpts)
+	var metadata epub.Metadata
+	addMetadataFlags(fs, &metadata)
+	fs.Parse(args)
+
+	if err := applyProfile(fs, *profile); err != nil {
+		return err
+	}
+	if *interval < config.MinWatchInterval {
+		return fmt.Errorf("--interval must be at least %s", config.MinWatchInterval)
+	}
+	if err := checkImageOptions(imageOpts); err != nil {
+		return err
+	}
+	if err := checkMetadata(metadata); err != nil {
+		return err
+	}
+	if err := checkFilenameOptions(filenameOpts); err != nil {
+		return err
+	}
+
+	formatter, err := loadFormatter(*cssPath)
+	if err != nil {
+		return err
+	}
+	cover, err := loadCover(*coverPath)
+	if err != nil {
+		return err
+	}
+
+	if *statePath == "" {
+		*statePath, err = scraper.DefaultSeenPath()
+		if err != nil {
+			return fmt.Errorf("locating watch state: %w", err)
+		}
+	}
+	seen, err := scraper.LoadSeenChapters(*statePath)
+	if err != nil {
+		return fmt.Errorf("reading watch state: %w", err)
+	}
+
+	opts := watchOptions{
+		output:      *output,
+		formatter:   formatter,
+		cover:       cover,
+		feedContent: *feedContent,
+		fetchOpts:   fetchOpts,
+		imageOpts:   imageOpts,
+		filenames:   filenameOpts,
+		metadata:    metadata,
+		overrides:   metadataFlags(fs),
+	}
+
+	// After a restart, keep to the schedule of the previous run
+	wait := time.Until(seen.CheckedAt().Add(*interval))
+	if wait > 0 {
+		fmt.Printf("Last checked at %s, next check at %s\n", seen.CheckedAt().Local().Format(time.Kitchen), time.Now().Add(wait).Format(time.Kitchen))
+	}
+
+	for {
+		if wait > 0 {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(wait):
+			}
+		}
+
+		if err := checkForChapters(ctx, seen, opts); err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			fmt.Printf("Warning: %v; trying again in %s\n", err, *interval)
+		}
+		wait = *interval
+	}
+}
+
+// checkForChapters fetches the table of contents once and builds or updates
+// the book if there are chapters the watcher has not seen yet.
+func checkForChapters(ctx context.Context, seen *scraper.SeenChapters, opts watchOptions) error {
+	scraperImpl, err := newScraper(opts.fetchOpts)
+	if err != nil {
+		return err
+	}
+	scraperImpl.SetFeedContent(opts.feedContent)
+
+	// The feed is enough to tell whether anything was released; the table of
+	// contents is only needed to place new chapters.
+	if seen.Len() > 0 {
+		latest, err := scraperImpl.FetchLatestChaptersContext(ctx)
+		if err != nil {
+			return fmt.Errorf("checking for new chapters: %w", err)
+		}
+		if len(seen.Unseen(latest)) == 0 {
+			fmt.Printf("%s: no new chapters\n", time.Now().Format(time.DateTime))
+			return seen.Save(time.Now())
+		}
+	}
+
+	chapters, err := scraperImpl.FetchTableOfContentsContext(ctx)
+	if err != nil {
+		return fmt.Errorf("fetching table of contents: %w", err)
+	}
+	checkedAt := time.Now()
+
+	// On the first run only remember what is there; only later releases
+	// trigger a build.
+	if seen.Len() == 0 {
+		seen.Add(chapters)
+		fmt.Printf("Watching %d chapters for new releases\n", len(chapters))
+		return seen.Save(checkedAt)
+	}
+
+	unseen := seen.Unseen(chapters)
+	if len(unseen) == 0 {
+		fmt.Printf("%s: no new chapters\n", checkedAt.Format(time.DateTime))
+		return seen.Save(checkedAt)
+	}
+	fmt.Printf("%s: %d new chapters, starting with %s\n", checkedAt.Format(time.DateTime), len(unseen), unseen[0].Title)
+
+	epubCreator := epub.NewEPUBCreator()
+	epubCreator.SetProgressCallback(ui.NewCLI().PrintDownloadProgress)
+	epubCreator.SetFormatter(opts.formatter)
+	epubCreator.SetCover(opts.cover)
+	epubCreator.SetMetadata(opts.metadata)
+	epubCreator.SetConcurrency(opts.fetchOpts.concurrency)
+	if err := setImageOptions(epubCreator, opts.fetchOpts, opts.imageOpts); err != nil {
+		return err
+	}
+	if err := setFilenameOptions(epubCreator, opts.filenames); err != nil {
+		return err
+	}
+
+	// Chapters that fail to download are left out of the book, so they stay
+	// unseen and are tried again on the next check
+	recorder := &failureRecorder{ContextScraper: scraperImpl, failed: make(map[string]bool)}
+
+	// Without --output each check writes a new book
+	var book *epub.Book
+	if opts.output != "" {
+		book, err = epub.ReadEPUB(opts.output)
+	}
+	switch {
+	case opts.output == "" || errors.Is(err, os.ErrNotExist):
+		epubCreator.SetOutputPath(opts.output)
+		err = epubCreator.CreateEPUBContext(ctx, unseen, recorder)
+	case err == nil:
+		clearMetadata(book, opts.overrides)
+		_, err = updateBook(ctx, epubCreator, book, chapters, recorder, opts.fetchOpts)
+	default:
+		err = fmt.Errorf("reading %s: %w", opts.output, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	var added []models.Chapter
+	for _, chapter := range unseen {
+		if !recorder.failed[chapter.URL] {
+			added = append(added, chapter)
+		}
+	}
+	if missed := len(unseen) - len(added); missed > 0 {
+		fmt.Printf("%d new chapters could not be fetched and will be tried again on the next check\n", missed)
+	}
+
+	seen.Add(added)
+	return seen.Save(checkedAt)
+}
+
+// failureRecorder wraps a scraper to remember the chapters whose download
+// failed for a reason other than cancellation.
+type failureRecorder struct {
+	scraper.ContextScraper
+
+	mu     sync.Mutex
+	failed map[string]bool
+}
+
+func (r *failureRecorder) FetchChapterContent(url, title string) (string, error) {
+	return r.FetchChapterContentContext(context.Background(), url, title)
+}
+
+func (r *failureRecorder) FetchChapterContentContext(ctx context.Context, url, title string) (string, error) {
+	content, err := r.ContextScraper.FetchChapterContentContext(ctx, url, title)
+	if err != nil && ctx.Err() == nil {
+		r.mu.Lock()
+		r.failed[url] = true
+		r.mu.Unlock()
+	}
+	return content, err
+}
@@ -1,16 +1,62 @@
 package config
 
-import "regexp"
+import (
+	"regexp"
+	"time"
+)
 
 const (
-	TOCUrl = "https://wanderinginn.com/table-of-contents/"
+	FeedURL = "https://wanderinginn.com/feed/"
 
 	EpubTitle       = "The Wandering Inn"
 	EpubAuthor      = "pirateaba"
 	EpubDescription = "The Wandering Inn web serial"
+	EpubLanguage    = "en"
+
+	// Template of book titles; see epub.TitleData for the fields.
+	TitleTemplate = "{{.Series}}{{with .Volume}} – {{.}}{{end}} ({{.Range}})"
 
 	DefaultFilename = "wandering_inn.epub"
-	MaxFilenameLen  = 50
+
+	// Template of the names of books written without an output path; see
+	// utils.GenerateFilename for the fields.
+	FilenameTemplate = "wandering_inn_{{range}}.{{ext}}"
+
+	CacheDirName = "wandering-inn"
+
+	DefaultConcurrency = 4
+
+	UserAgent       = "wandering-inn/1.0 (EPUB creator; +https://github.com/linuxswords/wandering-inn)"
+	RequestTimeout  = 30 * time.Second
+	RequestInterval = 500 * time.Millisecond
+	RequestBurst    = 4
+
+	// How long robots.txt rules are used before they are downloaded again,
+	// and how long to wait before trying again when robots.txt could not be
+	// downloaded.
+	RobotsTTL        = 24 * time.Hour
+	RobotsRetryDelay = time.Minute
+
+	CoverWidth  = 1200
+	CoverHeight = 1800
+
+	// JPEG quality used when an image has to be re-encoded after downscaling
+	// and no quality was asked for.
+	DefaultImageQuality = 85
+
+	DefaultWatchInterval = time.Hour
+	MinWatchInterval     = 5 * time.Minute
+
+	MaxRetries     = 4
+	RetryBaseDelay = 2 * time.Second
+	RetryMaxDelay  = time.Minute
+)
+
+// Settings that the config file can override; see File.
+var (
+	TOCUrl = "https://wanderinginn.com/table-of-contents/"
+
+	MaxFilenameLen = 50
 
 	LatestChaptersCount = 20
 )
@@ -18,6 +64,21 @@ const (
 var (
 	ChapterPattern = regexp.MustCompile(`(?i)(chapter|prologue|epilogue|interlude|\d+\.\d+)`)
 
+	// Attributes holding the URL of an image, in order of preference. Lazy-loaded
+	// images keep a placeholder in src and the real URL in a data attribute.
+	ImageSourceAttrs = []string{"src", "data-src", "data-lazy-src"}
+
+	VolumePattern = regexp.MustCompile(`(?i)^volume\s+(\d+)\b`)
+	BookPattern   = regexp.MustCompile(`(?i)^book\s+(\d+)\b`)
+
+	// Class fragments of elements that act as volume or book headings on the
+	// table of contents page, in addition to <h1>-<h6>.
+	HeadingClasses = []string{
+		"title",
+		"header",
+		"heading",
+	}
+
 	NavigationTerms = []string{
 		"previous chapter",
 		"next chapter",
@@ -0,0 +1,190 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// File is the user config file. Settings that are left out keep their
+// built-in values.
+type File struct {
+	TOCUrl              string   `yaml:"toc_url"`
+	MaxFilenameLen      int      `yaml:"max_filename_len"`
+	LatestChaptersCount int      `yaml:"latest_chapters"`
+	NavigationTerms     []string `yaml:"navigation_terms"`
+	// ColorClasses are added to ColorClassMap, replacing built-in entries
+	// for the same class.
+	ColorClasses map[string]string `yaml:"color_classes"`
+
+	// Profile is used by commands run without --profile.
+	Profile  string             `yaml:"profile"`
+	Profiles map[string]Profile `yaml:"profiles"`
+}
+
+// Profile bundles the output settings for a reader or purpose. Empty fields
+// leave the command's defaults alone, and flags given on the command line
+// always win.
+type Profile struct {
+	Format string `yaml:"format"`
+	// CSS is the path of a stylesheet, relative to the config file.
+	CSS    string      `yaml:"css"`
+	Images ImagePolicy `yaml:"images"`
+	// Filename is a filename template; see utils.GenerateFilename.
+	Filename string   `yaml:"filename"`
+	Metadata Metadata `yaml:"metadata"`
+}
+
+type ImagePolicy struct {
+	Skip     bool `yaml:"skip"`
+	MaxWidth int  `yaml:"max_width"`
+	Quality  int  `yaml:"quality"`
+}
+
+// Metadata are book metadata defaults; see epub.Metadata.
+type Metadata struct {
+	Title       string   `yaml:"title"`
+	Author      string   `yaml:"author"`
+	Description string   `yaml:"description"`
+	Series      string   `yaml:"series"`
+	Language    string   `yaml:"language"`
+	Publisher   string   `yaml:"publisher"`
+	Subjects    []string `yaml:"subjects"`
+}
+
+var (
+	// Profiles are the built-in profiles, and those of the config file once
+	// it is applied.
+	Profiles = map[string]Profile{
+		// Kindle Paperwhite screen width, JPEG to keep books small for
+		// Send to Kindle.
+		"kindle": {Format: "epub", Images: ImagePolicy{MaxWidth: 1072, Quality: 80}},
+		// Kobo Libra screen width.
+		"kobo": {Format: "epub", Images: ImagePolicy{MaxWidth: 1264, Quality: 85}},
+		// Everything at full size, dated so that rebuilds do not replace
+		// older copies.
+		"archive": {Format: "epub", Filename: "wandering_inn_v{{volume}}_{{range}}_{{date}}.{{ext}}"},
+	}
+
+	// DefaultProfile is the profile commands use without --profile.
+	DefaultProfile string
+)
+
+var configExtensions = []string{".yaml", ".yml"}
+
+// DefaultConfigPath returns the config file below the user's config
+// directory ($XDG_CONFIG_HOME on Linux): wandering-inn/config.yaml or
+// config.yml, whichever exists first. It returns "" if there is none.
+func DefaultConfigPath() (string, error) {
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	for _, ext := range configExtensions {
+		path := filepath.Join(base, CacheDirName, "config"+ext)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+// LoadFile reads a YAML config file. Unknown settings are an error, so typos
+// do not go unnoticed.
+func LoadFile(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file File
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	if err := file.resolve(filepath.Dir(path)); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &file, nil
+}
+
+// resolve checks the settings and makes the paths in profiles relative to
+// dir absolute.
+func (f *File) resolve(dir string) error {
+	if f.MaxFilenameLen < 0 {
+		return fmt.Errorf("max_filename_len must not be negative")
+	}
+	if f.LatestChaptersCount < 0 {
+		return fmt.Errorf("latest_chapters must not be negative")
+	}
+
+	for name, profile := range f.Profiles {
+		if profile.CSS != "" && !filepath.IsAbs(profile.CSS) {
+			profile.CSS = filepath.Join(dir, profile.CSS)
+		}
+		if profile.Images.Quality < 0 || profile.Images.Quality > 100 {
+			return fmt.Errorf("profile %s: image quality must be between 1 and 100", name)
+		}
+		if profile.Images.MaxWidth < 0 {
+			return fmt.Errorf("profile %s: image max_width must not be negative", name)
+		}
+		f.Profiles[name] = profile
+	}
+
+	if f.Profile != "" {
+		if _, ok := f.Profiles[f.Profile]; !ok {
+			if _, ok := Profiles[f.Profile]; !ok {
+				return fmt.Errorf("default profile %q is not defined", f.Profile)
+			}
+		}
+	}
+	return nil
+}
+
+// Apply overrides the package settings with those of the file. Profiles of
+// the file replace built-in profiles of the same name.
+func (f *File) Apply() {
+	if f.TOCUrl != "" {
+		TOCUrl = f.TOCUrl
+	}
+	if f.MaxFilenameLen > 0 {
+		MaxFilenameLen = f.MaxFilenameLen
+	}
+	if f.LatestChaptersCount > 0 {
+		LatestChaptersCount = f.LatestChaptersCount
+	}
+	if f.NavigationTerms != nil {
+		NavigationTerms = make([]string, len(f.NavigationTerms))
+		for i, term := range f.NavigationTerms {
+			NavigationTerms[i] = strings.ToLower(strings.TrimSpace(term))
+		}
+	}
+	if len(f.ColorClasses) > 0 {
+		ColorClassMap = maps.Clone(ColorClassMap)
+		maps.Copy(ColorClassMap, f.ColorClasses)
+	}
+
+	Profiles = maps.Clone(Profiles)
+	maps.Copy(Profiles, f.Profiles)
+	if f.Profile != "" {
+		DefaultProfile = f.Profile
+	}
+}
+
+// ProfileNames returns the names of the known profiles, sorted.
+func ProfileNames() string {
+	return strings.Join(slices.Sorted(maps.Keys(Profiles)), ", ")
+}
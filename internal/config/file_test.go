@@ -0,0 +1,189 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{
+			name: "yaml",
+			file: "config.yaml",
+			content: `
+toc_url: https://example.com/toc/
+latest_chapters: 5
+navigation_terms: [Next, Previous]
+color_classes:
+  has-vivid-red-color: red
+profile: ereader
+profiles:
+  ereader:
+    format: epub
+    css: reader.css
+    images:
+      max_width: 800
+      quality: 70
+    metadata:
+      subjects: [Fantasy]
+`,
+		},
+		{
+			name: "yml",
+			file: "config.yml",
+			content: `
+toc_url: https://example.com/toc/
+latest_chapters: 5
+navigation_terms: [Next, Previous]
+color_classes: {has-vivid-red-color: red}
+profile: ereader
+profiles:
+  ereader: {format: epub, css: reader.css, images: {max_width: 800, quality: 70}, metadata: {subjects: [Fantasy]}}
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfig(t, tt.file, tt.content)
+
+			file, err := LoadFile(path)
+			if err != nil {
+				t.Fatalf("LoadFile() failed: %v", err)
+			}
+
+			if file.TOCUrl != "https://example.com/toc/" || file.LatestChaptersCount != 5 {
+				t.Errorf("settings = %q, %d, want the values of the file", file.TOCUrl, file.LatestChaptersCount)
+			}
+			if !slices.Equal(file.NavigationTerms, []string{"Next", "Previous"}) {
+				t.Errorf("NavigationTerms = %v", file.NavigationTerms)
+			}
+			if file.ColorClasses["has-vivid-red-color"] != "red" {
+				t.Errorf("ColorClasses = %v", file.ColorClasses)
+			}
+
+			profile := file.Profiles["ereader"]
+			if want := filepath.Join(filepath.Dir(path), "reader.css"); profile.CSS != want {
+				t.Errorf("CSS = %q, want %q relative to the config file", profile.CSS, want)
+			}
+			if profile.Images != (ImagePolicy{MaxWidth: 800, Quality: 70}) {
+				t.Errorf("Images = %+v", profile.Images)
+			}
+			if !slices.Equal(profile.Metadata.Subjects, []string{"Fantasy"}) {
+				t.Errorf("Subjects = %v", profile.Metadata.Subjects)
+			}
+		})
+	}
+}
+
+func TestLoadFile_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{name: "unknown yaml setting", file: "config.yaml", content: "toc_uri: https://example.com/\n"},
+		{name: "unknown profile setting", file: "config.yaml", content: "profiles:\n  x:\n    fromat: epub\n"},
+		{name: "invalid yaml", file: "config.yaml", content: "profiles: [\n"},
+		{name: "image quality out of range", file: "config.yaml", content: "profiles:\n  x:\n    images:\n      quality: 101\n"},
+		{name: "undefined default profile", file: "config.yaml", content: "profile: missing\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := LoadFile(writeConfig(t, tt.file, tt.content)); err == nil {
+				t.Error("LoadFile() expected error")
+			}
+		})
+	}
+}
+
+func TestLoadFile_Empty(t *testing.T) {
+	if _, err := LoadFile(writeConfig(t, "config.yaml", "")); err != nil {
+		t.Errorf("LoadFile() of empty file failed: %v", err)
+	}
+}
+
+func TestFile_Apply(t *testing.T) {
+	tocURL, navigationTerms, colorClasses := TOCUrl, NavigationTerms, ColorClassMap
+	profiles, defaultProfile := Profiles, DefaultProfile
+	t.Cleanup(func() {
+		TOCUrl, NavigationTerms, ColorClassMap = tocURL, navigationTerms, colorClasses
+		Profiles, DefaultProfile = profiles, defaultProfile
+	})
+
+	file := &File{
+		TOCUrl:          "https://example.com/toc/",
+		NavigationTerms: []string{" Next Page "},
+		ColorClasses:    map[string]string{"has-red-color": "crimson"},
+		Profile:         "kindle",
+		Profiles:        map[string]Profile{"kindle": {Format: "epub", CSS: "/kindle.css"}},
+	}
+	file.Apply()
+
+	if TOCUrl != "https://example.com/toc/" {
+		t.Errorf("TOCUrl = %q", TOCUrl)
+	}
+	if MaxFilenameLen != 50 {
+		t.Errorf("MaxFilenameLen = %d, want the built-in value", MaxFilenameLen)
+	}
+	if !slices.Equal(NavigationTerms, []string{"next page"}) {
+		t.Errorf("NavigationTerms = %q, want the terms in lower case", NavigationTerms)
+	}
+	if ColorClassMap["has-red-color"] != "crimson" || ColorClassMap["has-blue-color"] != "blue" {
+		t.Errorf("ColorClassMap was not merged: %v", ColorClassMap)
+	}
+	if colorClasses["has-red-color"] != "red" {
+		t.Error("Apply() modified the built-in colour classes")
+	}
+	if Profiles["kindle"].CSS != "/kindle.css" || Profiles["kobo"].Format != "epub" {
+		t.Errorf("Profiles = %v, want kindle replaced and the other built-in profiles kept", Profiles)
+	}
+	if DefaultProfile != "kindle" {
+		t.Errorf("DefaultProfile = %q", DefaultProfile)
+	}
+}
+
+func TestDefaultConfigPath(t *testing.T) {
+	configHome := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configHome)
+
+	path, err := DefaultConfigPath()
+	if err != nil || path != "" {
+		t.Fatalf("DefaultConfigPath() = %q, %v, want no file", path, err)
+	}
+
+	dir := filepath.Join(configHome, CacheDirName)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"config.toml", "config.yml"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path, err = DefaultConfigPath()
+	if err != nil {
+		t.Fatalf("DefaultConfigPath() failed: %v", err)
+	}
+	if want := filepath.Join(dir, "config.yml"); path != want {
+		t.Errorf("DefaultConfigPath() = %q, want %q", path, want)
+	}
+}
@@ -0,0 +1,210 @@
+package epub
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"strings"
+
+	"github.com/linuxswords/wandering-inn/internal/config"
+	"github.com/linuxswords/wandering-inn/internal/models"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// Generated covers get this filename, so an update can tell them from a
+// custom cover and draw them again for the new chapter range.
+const generatedCoverFilename = "generated-cover.png"
+
+var (
+	coverBackground = color.RGBA{R: 0x2b, G: 0x1d, B: 0x14, A: 0xff}
+	coverFrame      = color.RGBA{R: 0xc8, G: 0x9b, B: 0x4a, A: 0xff}
+	coverTitleColor = color.RGBA{R: 0xf4, G: 0xe9, B: 0xd8, A: 0xff}
+	coverSubtitle   = color.RGBA{R: 0xe0, G: 0xc2, B: 0x8a, A: 0xff}
+)
+
+// LoadCover reads an image file to use as a cover.
+func LoadCover(filename string) ([]byte, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := imageExtensions[imageMediaType(data)]; !ok {
+		return nil, fmt.Errorf("%s is not a JPEG, PNG, GIF, WebP or SVG image", filename)
+	}
+	return data, nil
+}
+
+// CoverText is what a generated cover shows.
+type CoverText struct {
+	Title  string
+	Volume string
+	Range  string
+}
+
+// NewCoverText describes the chapters of a book, e.g. "Volume 8" and
+// "8.00–8.12". The volume is left empty unless every chapter knows its
+// volume.
+func NewCoverText(title string, chapters []models.Chapter) CoverText {
+	data := NewTitleData(title, chapters)
+	return CoverText{Title: title, Volume: data.Volume, Range: data.Range}
+}
+
+// GenerateCover draws a PNG cover with the title at the top and the volume
+// and chapter range below it, using the Go fonts bundled with x/image.
+func GenerateCover(text CoverText) ([]byte, error) {
+	width, height := config.CoverWidth, config.CoverHeight
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(coverBackground), image.Point{}, draw.Src)
+
+	// A double frame, inset from the edges
+	for _, inset := range []struct{ offset, thickness int }{{width / 24, 8}, {width/24 + 20, 3}} {
+		drawFrame(img, img.Bounds().Inset(inset.offset), inset.thickness, coverFrame)
+	}
+
+	margin := width / 8
+	textWidth := width - 2*margin
+
+	y := height / 5
+	var err error
+	y, err = drawLines(img, gobold.TTF, text.Title, 150, 3, textWidth, y, coverTitleColor)
+	if err != nil {
+		return nil, err
+	}
+
+	rule := image.Rect(width/2-width/6, y+40, width/2+width/6, y+46)
+	draw.Draw(img, rule, image.NewUniform(coverFrame), image.Point{}, draw.Src)
+	y = rule.Max.Y + 120
+
+	subtitle := text.Volume
+	if text.Range != "" {
+		if subtitle != "" {
+			subtitle += " · "
+		}
+		subtitle += text.Range
+	}
+	if _, err := drawLines(img, goregular.TTF, subtitle, 72, 3, textWidth, y, coverSubtitle); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func drawFrame(img draw.Image, r image.Rectangle, thickness int, c color.Color) {
+	src := image.NewUniform(c)
+	draw.Draw(img, image.Rect(r.Min.X, r.Min.Y, r.Max.X, r.Min.Y+thickness), src, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(r.Min.X, r.Max.Y-thickness, r.Max.X, r.Max.Y), src, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(r.Min.X, r.Min.Y, r.Min.X+thickness, r.Max.Y), src, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(r.Max.X-thickness, r.Min.Y, r.Max.X, r.Max.Y), src, image.Point{}, draw.Src)
+}
+
+// drawLines draws text centred and wrapped to width, starting with its first
+// baseline at y. The font shrinks until the text fits on maxLines lines.
+// It returns the baseline of the last line.
+func drawLines(img draw.Image, ttf []byte, text string, size float64, maxLines, width, y int, c color.Color) (int, error) {
+	if strings.TrimSpace(text) == "" {
+		return y, nil
+	}
+
+	f, err := opentype.Parse(ttf)
+	if err != nil {
+		return 0, fmt.Errorf("loading cover font: %w", err)
+	}
+
+	var face font.Face
+	var lines []string
+	for ; size >= 24; size *= 0.9 {
+		face, err = opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+		if err != nil {
+			return 0, fmt.Errorf("loading cover font: %w", err)
+		}
+		lines = wrapText(face, text, width)
+		if len(lines) <= maxLines && fits(face, lines, width) {
+			break
+		}
+	}
+
+	drawer := &font.Drawer{Dst: img, Src: image.NewUniform(c), Face: face}
+	lineHeight := face.Metrics().Height.Ceil() * 6 / 5
+	for i, line := range lines {
+		if i > 0 {
+			y += lineHeight
+		}
+		lineWidth := drawer.MeasureString(line).Ceil()
+		drawer.Dot = fixed.P((img.Bounds().Dx()-lineWidth)/2, y)
+		drawer.DrawString(line)
+	}
+	return y, nil
+}
+
+// wrapText breaks text into lines no wider than width, at spaces.
+func wrapText(face font.Face, text string, width int) []string {
+	var lines []string
+	var line string
+	for _, word := range strings.Fields(text) {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if line != "" && font.MeasureString(face, candidate).Ceil() > width {
+			lines = append(lines, line)
+			candidate = word
+		}
+		line = candidate
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func fits(face font.Face, lines []string, width int) bool {
+	for _, line := range lines {
+		if font.MeasureString(face, line).Ceil() > width {
+			return false
+		}
+	}
+	return true
+}
+
+// coverTitle is the title a generated cover shows: the series, since the
+// volume and chapters are shown below it.
+func coverTitle(m Metadata) string {
+	if m.Series != "" {
+		return m.Series
+	}
+	return m.Title
+}
+
+// addCover gives the book the custom cover if one was set, and otherwise a
+// generated cover for the chapters.
+func (c *EPUBCreator) addCover(book *bookBuilder, title string, chapters []models.Chapter) error {
+	if c.cover != nil {
+		return book.setCover("cover"+imageExtensions[imageMediaType(c.cover)], c.cover)
+	}
+
+	data, err := GenerateCover(NewCoverText(title, chapters))
+	if err != nil {
+		return fmt.Errorf("generating cover: %w", err)
+	}
+	return book.setCover(generatedCoverFilename, data)
+}
+
+func (b *bookBuilder) setCover(filename string, data []byte) error {
+	internal, err := b.images.addFile(filename, imageMediaType(data), data)
+	if err != nil {
+		return err
+	}
+	return b.epub.SetCover(internal, "")
+}
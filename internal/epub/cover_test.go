@@ -0,0 +1,158 @@
+package epub
+
+import (
+	"bytes"
+	"image/png"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/linuxswords/wandering-inn/internal/config"
+	"github.com/linuxswords/wandering-inn/internal/models"
+)
+
+func TestNewCoverText(t *testing.T) {
+	tests := []struct {
+		name     string
+		chapters []models.Chapter
+		volume   string
+		rng      string
+	}{
+		{
+			name: "one volume",
+			chapters: []models.Chapter{
+				{Title: "8.00", Volume: "Volume 8"},
+				{Title: "8.12", Volume: "Volume 8"},
+			},
+			volume: "Volume 8",
+			rng:    "8.00–8.12",
+		},
+		{
+			name: "several volumes",
+			chapters: []models.Chapter{
+				{Title: "3.00", Volume: "Volume 3"},
+				{Title: "4.00", Volume: "Volume 4"},
+				{Title: "5.00", Volume: "Volume 5"},
+			},
+			volume: "Volumes 3–5",
+			rng:    "3.00–5.00",
+		},
+		{
+			name:     "single chapter",
+			chapters: []models.Chapter{{Title: "Interlude – Pawn", Volume: "Volume 2"}},
+			volume:   "Volume 2",
+			rng:      "Interlude – Pawn",
+		},
+		{
+			name: "unknown volume",
+			chapters: []models.Chapter{
+				{Title: "1.00"},
+				{Title: "8.12", Volume: "Volume 8"},
+			},
+			rng: "1.00–8.12",
+		},
+		{name: "no chapters"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text := NewCoverText("The Wandering Inn", tt.chapters)
+			if text.Title != "The Wandering Inn" || text.Volume != tt.volume || text.Range != tt.rng {
+				t.Errorf("NewCoverText() = %+v, want volume %q and range %q", text, tt.volume, tt.rng)
+			}
+		})
+	}
+}
+
+func TestGenerateCover(t *testing.T) {
+	data, err := GenerateCover(CoverText{Title: "The Wandering Inn", Volume: "Volume 8", Range: "8.00–8.12"})
+	if err != nil {
+		t.Fatalf("GenerateCover() failed: %v", err)
+	}
+
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("cover is not a PNG: %v", err)
+	}
+	if bounds := img.Bounds(); bounds.Dx() != config.CoverWidth || bounds.Dy() != config.CoverHeight {
+		t.Errorf("cover is %dx%d, want %dx%d", bounds.Dx(), bounds.Dy(), config.CoverWidth, config.CoverHeight)
+	}
+}
+
+func TestLoadCover(t *testing.T) {
+	dir := t.TempDir()
+	image := filepath.Join(dir, "cover.png")
+	if err := os.WriteFile(image, testPNG(t, 10, 15), 0644); err != nil {
+		t.Fatal(err)
+	}
+	text := filepath.Join(dir, "cover.txt")
+	if err := os.WriteFile(text, []byte("not an image"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadCover(image); err != nil {
+		t.Errorf("LoadCover(PNG) failed: %v", err)
+	}
+	if _, err := LoadCover(text); err == nil {
+		t.Error("LoadCover(text file) succeeded, want an error")
+	}
+	if _, err := LoadCover(filepath.Join(dir, "missing.png")); err == nil {
+		t.Error("LoadCover(missing file) succeeded, want an error")
+	}
+}
+
+func TestEPUBCreator_Cover(t *testing.T) {
+	custom := testPNG(t, 10, 15)
+
+	tests := []struct {
+		name     string
+		cover    []byte
+		filename string
+	}{
+		{name: "generated", filename: generatedCoverFilename},
+		{name: "custom", cover: custom, filename: "cover.png"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			creator := NewEPUBCreator()
+			creator.SetCover(tt.cover)
+			outputPath := filepath.Join(t.TempDir(), "cover.epub")
+			creator.SetOutputPath(outputPath)
+
+			if err := creator.CreateEPUB([]models.Chapter{{Title: "1.00", URL: "url1"}}, &mockChapterContentFetcher{}); err != nil {
+				t.Fatalf("CreateEPUB() failed: %v", err)
+			}
+
+			book, err := ReadEPUB(outputPath)
+			if err != nil {
+				t.Fatalf("ReadEPUB() failed: %v", err)
+			}
+			if book.Cover == nil || path.Base(book.Cover.Href) != tt.filename {
+				t.Fatalf("Cover = %+v, want %s", book.Cover, tt.filename)
+			}
+			if tt.cover != nil && !bytes.Equal(book.Cover.Data, tt.cover) {
+				t.Error("custom cover was not stored as given")
+			}
+			if len(book.Sections) != 1 || len(book.Images) != 0 {
+				t.Errorf("book has %d sections and %d images, want the cover page and image left out", len(book.Sections), len(book.Images))
+			}
+
+			// An update keeps a custom cover and draws a generated one again
+			if err := NewEPUBCreator().UpdateEPUB(book, []models.Chapter{{Title: "1.01", URL: "url2"}}, &mockChapterContentFetcher{}); err != nil {
+				t.Fatalf("UpdateEPUB() failed: %v", err)
+			}
+			updated, err := ReadEPUB(outputPath)
+			if err != nil {
+				t.Fatalf("ReadEPUB() of updated book failed: %v", err)
+			}
+			if updated.Cover == nil || path.Base(updated.Cover.Href) != tt.filename {
+				t.Fatalf("Cover after update = %+v, want %s", updated.Cover, tt.filename)
+			}
+			if sameCover := bytes.Equal(updated.Cover.Data, book.Cover.Data); sameCover != (tt.cover != nil) {
+				t.Errorf("cover unchanged by update = %v, want %v", sameCover, tt.cover != nil)
+			}
+		})
+	}
+}
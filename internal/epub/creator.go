@@ -1,11 +1,22 @@
 package epub
 
 import (
+	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"html"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/go-shiori/go-epub"
 	"github.com/linuxswords/wandering-inn/internal/config"
 	"github.com/linuxswords/wandering-inn/internal/models"
+	"github.com/linuxswords/wandering-inn/internal/scraper"
 	"github.com/linuxswords/wandering-inn/pkg/utils"
 )
 
@@ -13,50 +24,365 @@ type Creator interface {
 	CreateEPUB(chapters []models.Chapter, scraper ChapterContentFetcher) error
 }
 
+// ContextCreator is a Creator that can be interrupted. On cancellation it
+// writes the chapters finished so far as a partial book.
+type ContextCreator interface {
+	Creator
+	CreateEPUBContext(ctx context.Context, chapters []models.Chapter, scraper ChapterContentFetcher) error
+}
+
+// Updater is a ContextCreator that can also append chapters to an existing
+// book.
+type Updater interface {
+	ContextCreator
+	UpdateEPUBContext(ctx context.Context, book *Book, chapters []models.Chapter, scraper ChapterContentFetcher) error
+}
+
 type ChapterContentFetcher interface {
 	FetchChapterContent(url, title string) (string, error)
 }
 
 type EPUBCreator struct {
 	progressCallback func(current, total int, title string)
+	outputPath       string
+	outputDir        string
+	filenameTemplate string
+	collision        utils.CollisionPolicy
+	formatter        *Formatter
+	concurrency      int
+	manifest         *Manifest
+	images           ImageOptions
+	imageFetcher     scraper.PageFetcher
+	cover            []byte
+	metadata         Metadata
 }
 
+const cssFilename = "styles.css"
+
 func NewEPUBCreator() *EPUBCreator {
-	return &EPUBCreator{}
+	return &EPUBCreator{
+		filenameTemplate: config.FilenameTemplate,
+		collision:        utils.CollisionOverwrite,
+		formatter:        NewFormatter(),
+		concurrency:      1,
+		imageFetcher:     scraper.HTTPFetcher{},
+		metadata:         DefaultMetadata(),
+	}
 }
 
 func (c *EPUBCreator) SetProgressCallback(callback func(current, total int, title string)) {
 	c.progressCallback = callback
 }
 
+func (c *EPUBCreator) SetOutputPath(path string) {
+	c.outputPath = path
+}
+
+// SetOutputDir sets the directory that books without an output path are
+// written to. The default is the current directory.
+func (c *EPUBCreator) SetOutputDir(dir string) {
+	c.outputDir = dir
+}
+
+// SetFilenameTemplate sets how books without an output path are named; see
+// utils.GenerateFilename.
+func (c *EPUBCreator) SetFilenameTemplate(template string) {
+	c.filenameTemplate = template
+}
+
+// SetCollisionPolicy sets what happens when the generated name of a book is
+// taken. The default overwrites the existing file.
+func (c *EPUBCreator) SetCollisionPolicy(policy utils.CollisionPolicy) {
+	c.collision = policy
+}
+
+func (c *EPUBCreator) SetFormatter(formatter *Formatter) {
+	c.formatter = formatter
+}
+
+// SetManifest makes CreateEPUB record its progress in manifest and reuse the
+// chapters already downloaded there. The manifest is removed once every
+// chapter made it into the book.
+func (c *EPUBCreator) SetManifest(manifest *Manifest) {
+	c.manifest = manifest
+}
+
+// SetConcurrency sets how many chapters are downloaded in parallel. The
+// default of 1 fetches them one after another.
+func (c *EPUBCreator) SetConcurrency(n int) {
+	c.concurrency = max(1, n)
+}
+
+// SetImageOptions sets whether images are embedded and how they are shrunk.
+func (c *EPUBCreator) SetImageOptions(options ImageOptions) {
+	c.images = options
+}
+
+// SetImageFetcher changes where images are downloaded from. A nil fetcher
+// goes straight to the site.
+func (c *EPUBCreator) SetImageFetcher(fetcher scraper.PageFetcher) {
+	if fetcher == nil {
+		fetcher = scraper.HTTPFetcher{}
+	}
+	c.imageFetcher = fetcher
+}
+
+// SetMetadata sets the metadata of the books written. See Metadata for how
+// it is filled in from the chapters.
+func (c *EPUBCreator) SetMetadata(metadata Metadata) {
+	c.metadata = metadata
+}
+
+// SetCover makes books use the image data, as returned by LoadCover, as
+// their cover. Without one, a cover showing the title, volume and chapter
+// range is generated.
+func (c *EPUBCreator) SetCover(data []byte) {
+	c.cover = data
+}
+
 func (c *EPUBCreator) CreateEPUB(chapters []models.Chapter, scraper ChapterContentFetcher) error {
-	e, err := epub.NewEpub(config.EpubTitle)
+	return c.CreateEPUBContext(context.Background(), chapters, scraper)
+}
+
+// CreateEPUBContext is like CreateEPUB, but stops downloading when ctx is
+// done. The chapters completed up to that point, in order, are still written
+// as a partial EPUB, and an error wrapping ctx.Err() is returned.
+func (c *EPUBCreator) CreateEPUBContext(ctx context.Context, chapters []models.Chapter, scraper ChapterContentFetcher) error {
+	metadata, err := c.metadata.Render(chapters)
 	if err != nil {
 		return err
 	}
 
-	e.SetAuthor(config.EpubAuthor)
-	e.SetDescription(config.EpubDescription)
+	e, err := epub.NewEpub(metadata.Title)
+	if err != nil {
+		return err
+	}
 
-	for i, chapter := range chapters {
-		if c.progressCallback != nil {
-			c.progressCallback(i+1, len(chapters), chapter.Title)
+	if c.manifest != nil {
+		identifier, err := c.manifest.setIdentifier(metadata.Identifier)
+		if err != nil {
+			return fmt.Errorf("saving build manifest: %w", err)
 		}
+		metadata.Identifier = identifier
+		scraper = c.manifest.Fetcher(scraper)
+	}
 
-		content, err := scraper.FetchChapterContent(chapter.URL, chapter.Title)
-		if err != nil {
-			fmt.Printf("Warning: Failed to fetch chapter %s: %v\n", chapter.Title, err)
-			continue
+	cssPath, err := c.addCSS(e)
+	if err != nil {
+		return err
+	}
+	book := c.newBookBuilder(e, cssPath)
+
+	added, err := c.addChapters(ctx, book, chapters, scraper)
+	if err != nil {
+		return err
+	}
+
+	// A partial book is named after the chapters it actually contains, but
+	// keeps the identifier of the complete one
+	named := chapters
+	if ctx.Err() != nil {
+		named = added
+		identifier := metadata.Identifier
+		if metadata, err = c.metadata.Render(added); err != nil {
+			return err
 		}
+		metadata.Identifier = identifier
+	}
+	book.setMetadata(metadata)
 
-		_, err = e.AddSection(content, chapter.Title, "", "")
-		if err != nil {
+	if err := c.addCover(book, coverTitle(metadata), named); err != nil {
+		return err
+	}
+
+	filename, err := c.outputFilename(metadata, named)
+	if err != nil {
+		return err
+	}
+	if err := c.finish(ctx, book, filename, len(added), len(chapters)); err != nil {
+		return err
+	}
+
+	// Chapters that can never be downloaded do not keep the build unfinished
+	if c.manifest != nil && len(c.manifest.Pending()) == 0 {
+		return c.manifest.Remove()
+	}
+	return nil
+}
+
+// UpdateEPUB rewrites an existing book with the given chapters appended after
+// the sections it already contains. The book is written back to its own path
+// unless an output path was set.
+func (c *EPUBCreator) UpdateEPUB(book *Book, chapters []models.Chapter, scraper ChapterContentFetcher) error {
+	return c.UpdateEPUBContext(context.Background(), book, chapters, scraper)
+}
+
+// UpdateEPUBContext is like UpdateEPUB, but stops downloading when ctx is
+// done, writing the book with the new chapters completed so far.
+func (c *EPUBCreator) UpdateEPUBContext(ctx context.Context, book *Book, chapters []models.Chapter, scraper ChapterContentFetcher) error {
+	before := book.chapters()
+	if _, err := c.metadata.updated(book, before, append(before, chapters...)); err != nil {
+		return err
+	}
+
+	e, err := epub.NewEpub(book.Title)
+	if err != nil {
+		return err
+	}
+
+	cssPath, err := c.addCSS(e)
+	if err != nil {
+		return err
+	}
+	updated := c.newBookBuilder(e, cssPath)
+
+	for _, image := range book.Images {
+		if err := updated.images.keep(path.Base(image.Href), image.Data); err != nil {
+			return err
+		}
+	}
+	// Chapters that were left out of the book go back to their place in the
+	// table of contents; the others come after the sections it has
+	results := c.fetchChapters(ctx, chapters, scraper)
+	var after []models.Chapter
+	add := func(body string, chapter models.Chapter) error {
+		after = append(after, chapter)
+		return updated.addSection(ctx, body, chapter)
+	}
+	next := 0
+	for _, chapter := range before {
+		position := book.Sections[chapter.Index].position
+		for ; position != 0 && next < len(results) && results[next].Chapter.Index < position-1; next++ {
+			if err := add(results[next].Content, results[next].Chapter); err != nil {
+				return err
+			}
+		}
+		if err := add(book.Sections[chapter.Index].Body, chapter); err != nil {
+			return err
+		}
+	}
+	for ; next < len(results); next++ {
+		if err := add(results[next].Content, results[next].Chapter); err != nil {
 			return err
 		}
 	}
 
-	filename := utils.GenerateFilename(chapters)
-	err = e.Write(filename)
+	metadata, err := c.metadata.updated(book, before, after)
+	if err != nil {
+		return err
+	}
+	updated.setMetadata(metadata)
+
+	// Custom covers are kept; generated ones are drawn again for the new range
+	if c.cover == nil && book.Cover != nil && path.Base(book.Cover.Href) != generatedCoverFilename {
+		err = updated.setCover(path.Base(book.Cover.Href), book.Cover.Data)
+	} else {
+		err = c.addCover(updated, coverTitle(metadata), after)
+	}
+	if err != nil {
+		return err
+	}
+
+	filename := c.outputPath
+	if filename == "" {
+		filename = book.Path
+	}
+	return c.finish(ctx, updated, filename, len(results), len(chapters))
+}
+
+// addCSS embeds the formatter's stylesheet and returns its internal path for
+// linking from sections. Without a stylesheet the path is empty.
+func (c *EPUBCreator) addCSS(e *epub.Epub) (string, error) {
+	if strings.TrimSpace(c.formatter.GetCSS()) == "" {
+		return "", nil
+	}
+
+	source := "data:text/css;base64," + base64.StdEncoding.EncodeToString([]byte(c.formatter.GetCSS()))
+	return e.AddCSS(source, cssFilename)
+}
+
+// addChapters downloads the chapters and adds them as sections, returning the
+// chapters that were added.
+func (c *EPUBCreator) addChapters(ctx context.Context, book *bookBuilder, chapters []models.Chapter, fetcher ChapterContentFetcher) ([]models.Chapter, error) {
+	var added []models.Chapter
+	for _, result := range c.fetchChapters(ctx, chapters, fetcher) {
+		if err := book.addSection(ctx, result.Content, result.Chapter); err != nil {
+			return nil, err
+		}
+		added = append(added, result.Chapter)
+	}
+	return added, nil
+}
+
+// fetchChapters downloads the chapters and returns those that arrived, in
+// order. Chapters that failed are reported and left out. When ctx is done, it
+// stops at the first chapter that did not finish so the book never ends up
+// with chapters missing because of the interruption.
+func (c *EPUBCreator) fetchChapters(ctx context.Context, chapters []models.Chapter, fetcher ChapterContentFetcher) []scraper.ChapterResult {
+	results := scraper.FetchChapters(ctx, fetcher, chapters, c.concurrency, c.progressCallback)
+
+	var fetched []scraper.ChapterResult
+	failed := 0
+	for _, result := range results {
+		if ctx.Err() != nil && errors.Is(result.Err, ctx.Err()) {
+			break
+		}
+		if result.Err != nil {
+			fmt.Printf("Warning: Failed to fetch chapter %s: %v\n", result.Chapter.Title, result.Err)
+			failed++
+			continue
+		}
+		fetched = append(fetched, result)
+	}
+
+	if failed > 0 {
+		fmt.Printf("Warning: %d of %d chapters could not be fetched and were left out\n", failed, len(chapters))
+	}
+	return fetched
+}
+
+// outputFilename returns where a new book of chapters is written: the output
+// path if one was set, and otherwise a name from the filename template in the
+// output directory.
+func (c *EPUBCreator) outputFilename(metadata Metadata, chapters []models.Chapter) (string, error) {
+	if c.outputPath != "" {
+		return c.outputPath, nil
+	}
+
+	name, err := utils.GenerateFilename(c.filenameTemplate, utils.FilenameData{
+		Series:   metadata.Series,
+		Chapters: chapters,
+		Date:     time.Now(),
+		Ext:      "epub",
+	})
+	if err != nil {
+		return "", err
+	}
+
+	filename := filepath.Join(c.outputDir, name)
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return "", fmt.Errorf("creating output directory: %w", err)
+	}
+	return utils.ResolveCollision(filename, c.collision)
+}
+
+// finish writes the book, which is only partial if ctx was cancelled.
+func (c *EPUBCreator) finish(ctx context.Context, book *bookBuilder, filename string, added, total int) error {
+	if ctx.Err() == nil {
+		return c.write(book, filename)
+	}
+
+	if added == 0 {
+		return fmt.Errorf("interrupted before any chapter was downloaded: %w", ctx.Err())
+	}
+	if err := book.write(filename); err != nil {
+		return err
+	}
+	return fmt.Errorf("interrupted after %d of %d chapters, partial EPUB written to %s: %w", added, total, filename, ctx.Err())
+}
+
+func (c *EPUBCreator) write(book *bookBuilder, filename string) error {
+	err := book.write(filename)
 	if err != nil {
 		return err
 	}
@@ -64,3 +390,137 @@ func (c *EPUBCreator) CreateEPUB(chapters []models.Chapter, scraper ChapterConte
 	fmt.Printf("EPUB created successfully: %s\n", filename)
 	return nil
 }
+
+// Names of the title pages of volumes and books. ReadEPUB leaves sections
+// named like this out, as they are not chapters.
+const (
+	volumePageFormat = "volume%04d.xhtml"
+	bookPageFormat   = "book%04d.xhtml"
+)
+
+// bookBuilder is an EPUB being assembled. It remembers which page each
+// section was downloaded from, so the sources can be stored in the book.
+type bookBuilder struct {
+	epub     *epub.Epub
+	cssPath  string
+	images   *imageEmbedder
+	sources  []sectionSource
+	metadata Metadata
+
+	// The title pages of the volume and book that chapters are currently
+	// added to, and how many of them there are
+	volume, book         string
+	volumePage, bookPage string
+	volumes, books       int
+}
+
+func (c *EPUBCreator) newBookBuilder(e *epub.Epub, cssPath string) *bookBuilder {
+	return &bookBuilder{
+		epub:    e,
+		cssPath: cssPath,
+		images:  newImageEmbedder(e, c.imageFetcher, c.images),
+	}
+}
+
+// addSection adds a chapter, nested under its volume and book in the table
+// of contents.
+func (b *bookBuilder) addSection(ctx context.Context, body string, chapter models.Chapter) error {
+	parent, err := b.parent(chapter)
+	if err != nil {
+		return err
+	}
+
+	body = b.images.embed(ctx, body, chapter.URL)
+	filename, err := b.epub.AddSubSection(parent, body, chapter.Title, "", b.cssPath)
+	if err != nil {
+		return err
+	}
+
+	if chapter.URL != "" {
+		b.sources = append(b.sources, sectionSource{section: filename, url: chapter.URL})
+	}
+	return nil
+}
+
+// parent returns the title page that chapter goes under, adding one when a
+// new volume or book begins. Chapters of an unknown volume are not nested.
+func (b *bookBuilder) parent(chapter models.Chapter) (string, error) {
+	if chapter.Volume == "" {
+		b.volume, b.volumePage = "", ""
+		b.book, b.bookPage = "", ""
+		return "", nil
+	}
+
+	if chapter.Volume != b.volume || b.volumePage == "" {
+		b.volumes++
+		page, err := b.addTitlePage("", fmt.Sprintf(volumePageFormat, b.volumes), "h1", chapter.Volume)
+		if err != nil {
+			return "", err
+		}
+		b.volume, b.volumePage = chapter.Volume, page
+		b.book, b.bookPage = "", ""
+	}
+
+	// Later chapters must not go under an earlier book, or they would come
+	// before the chapters in between in the reading order
+	if chapter.Book == "" {
+		b.book, b.bookPage = "", ""
+		return b.volumePage, nil
+	}
+	if chapter.Book != b.book || b.bookPage == "" {
+		b.books++
+		page, err := b.addTitlePage(b.volumePage, fmt.Sprintf(bookPageFormat, b.books), "h2", chapter.Book)
+		if err != nil {
+			return "", err
+		}
+		b.book, b.bookPage = chapter.Book, page
+	}
+	return b.bookPage, nil
+}
+
+func (b *bookBuilder) addTitlePage(parent, filename, heading, title string) (string, error) {
+	body := fmt.Sprintf(`<div class="title-page"><%s>%s</%s></div>`, heading, html.EscapeString(title), heading)
+	return b.epub.AddSubSection(parent, body, title, filename, b.cssPath)
+}
+
+// setMetadata sets the book's metadata. What go-epub has no setters for is
+// added to the package document when the book is written.
+func (b *bookBuilder) setMetadata(m Metadata) {
+	b.epub.SetTitle(m.Title)
+	b.epub.SetAuthor(m.Author)
+	b.epub.SetDescription(m.Description)
+	if m.Language != "" {
+		b.epub.SetLang(m.Language)
+	}
+	if m.Identifier != "" {
+		b.epub.SetIdentifier(m.Identifier)
+	}
+	b.metadata = m
+}
+
+func (b *bookBuilder) write(filename string) error {
+	if err := b.epub.Write(filename); err != nil {
+		return err
+	}
+	return writeMetadata(filename, metadataElements(b.metadata)+sourceElements(b.sources))
+}
+
+// NewChapters returns the chapters of the table of contents, from the first
+// one contained in the book on, that the book is missing: those released
+// since it was made, and any that were left out because they could not be
+// downloaded. Chapters are matched by the source URLs stored in the book, or
+// by section title for sections without one.
+func NewChapters(book *Book, toc []models.Chapter) ([]models.Chapter, error) {
+	first := slices.IndexFunc(toc, book.contains)
+	if first == -1 {
+		return nil, fmt.Errorf("none of the chapters in %s appear in the table of contents", book.Path)
+	}
+
+	var missing []models.Chapter
+	for _, chapter := range toc[first+1:] {
+		if !book.contains(chapter) {
+			missing = append(missing, chapter)
+		}
+	}
+	return missing, nil
+}
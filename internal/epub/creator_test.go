@@ -1,11 +1,20 @@
 package epub
 
 import (
+	"archive/zip"
+	"context"
+	"encoding/xml"
 	"errors"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/linuxswords/wandering-inn/internal/models"
+	"github.com/linuxswords/wandering-inn/pkg/utils"
 )
 
 // Mock implementation of ChapterContentFetcher for testing
@@ -119,7 +128,7 @@ func TestEPUBCreator_CreateEPUB(t *testing.T) {
 	}
 
 	// Check that EPUB file was created
-	expectedFilename := "wandering_inn_chapter_1.epub"
+	expectedFilename := "wandering_inn_chapter_1-chapter_2.epub"
 	if _, err := os.Stat(expectedFilename); os.IsNotExist(err) {
 		t.Errorf("Expected EPUB file %s was not created", expectedFilename)
 	} else {
@@ -181,7 +190,7 @@ func TestEPUBCreator_CreateEPUB_FetchError(t *testing.T) {
 	}
 
 	// Check that EPUB file was created despite the error
-	expectedFilename := "wandering_inn_chapter_1.epub"
+	expectedFilename := "wandering_inn_chapter_1-chapter_2.epub"
 	if _, err := os.Stat(expectedFilename); os.IsNotExist(err) {
 		t.Errorf("Expected EPUB file %s was not created", expectedFilename)
 	} else {
@@ -222,12 +231,380 @@ func TestEPUBCreator_CreateEPUB_NoProgressCallback(t *testing.T) {
 	}
 }
 
+func TestEPUBCreator_CreateEPUB_OutputPath(t *testing.T) {
+	creator := NewEPUBCreator()
+
+	outputPath := filepath.Join(t.TempDir(), "custom.epub")
+	creator.SetOutputPath(outputPath)
+
+	chapters := []models.Chapter{
+		{Title: "Chapter 1", URL: "url1", Index: 0},
+	}
+
+	fetcher := &mockChapterContentFetcher{
+		chapters: map[string]string{
+			"url1": "<p>Content for chapter 1</p>",
+		},
+	}
+
+	err := creator.CreateEPUB(chapters, fetcher)
+	if err != nil {
+		t.Fatalf("CreateEPUB() with output path failed: %v", err)
+	}
+
+	if _, err := os.Stat(outputPath); os.IsNotExist(err) {
+		t.Errorf("Expected EPUB file %s was not created", outputPath)
+	}
+	if _, err := os.Stat("wandering_inn_chapter_1.epub"); err == nil {
+		os.Remove("wandering_inn_chapter_1.epub")
+		t.Error("CreateEPUB() ignored the output path and used the generated filename")
+	}
+}
+
+func TestEPUBCreator_CreateEPUB_OutputDir(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   utils.CollisionPolicy
+		expected []string
+	}{
+		{name: "suffix", policy: utils.CollisionSuffix, expected: []string{"v1_1.00-1.01.epub", "v1_1.00-1.01_2.epub"}},
+		{name: "overwrite", policy: utils.CollisionOverwrite, expected: []string{"v1_1.00-1.01.epub"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputDir := filepath.Join(t.TempDir(), "books")
+			chapters := []models.Chapter{
+				{Title: "1.00", URL: "url1", Volume: "Volume 1"},
+				{Title: "1.01", URL: "url2", Volume: "Volume 1"},
+			}
+
+			for range 2 {
+				creator := NewEPUBCreator()
+				creator.SetOutputDir(outputDir)
+				creator.SetFilenameTemplate("v{{volume}}_{{range}}.{{ext}}")
+				creator.SetCollisionPolicy(tt.policy)
+				if err := creator.CreateEPUB(chapters, &mockChapterContentFetcher{}); err != nil {
+					t.Fatalf("CreateEPUB() failed: %v", err)
+				}
+			}
+
+			entries, err := os.ReadDir(outputDir)
+			if err != nil {
+				t.Fatalf("reading output directory: %v", err)
+			}
+			var names []string
+			for _, entry := range entries {
+				names = append(names, entry.Name())
+			}
+			if strings.Join(names, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("written files = %v, want %v", names, tt.expected)
+			}
+		})
+	}
+}
+
+func readZipEntries(t *testing.T, filename string) map[string]string {
+	t.Helper()
+
+	r, err := zip.OpenReader(filename)
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", filename, err)
+	}
+	defer r.Close()
+
+	entries := make(map[string]string)
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", f.Name, err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", f.Name, err)
+		}
+		entries[f.Name] = string(data)
+	}
+	return entries
+}
+
+func TestEPUBCreator_CreateEPUB_EmbedsCSS(t *testing.T) {
+	tests := []struct {
+		name string
+		css  string
+	}{
+		{name: "default CSS", css: DefaultCSS},
+		{name: "custom CSS", css: ".red { color: darkred; }"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			formatter := NewFormatter()
+			formatter.SetCSS(tt.css)
+
+			creator := NewEPUBCreator()
+			creator.SetFormatter(formatter)
+			outputPath := filepath.Join(t.TempDir(), "styled.epub")
+			creator.SetOutputPath(outputPath)
+
+			chapters := []models.Chapter{
+				{Title: "Chapter 1", URL: "url1", Index: 0},
+			}
+			fetcher := &mockChapterContentFetcher{
+				chapters: map[string]string{
+					"url1": `<p class="red">Content for chapter 1</p>`,
+				},
+			}
+
+			if err := creator.CreateEPUB(chapters, fetcher); err != nil {
+				t.Fatalf("CreateEPUB() failed: %v", err)
+			}
+
+			entries := readZipEntries(t, outputPath)
+
+			if css := entries["EPUB/css/styles.css"]; css != tt.css {
+				t.Errorf("embedded CSS = %q, want %q", css, tt.css)
+			}
+
+			var linked bool
+			for name, content := range entries {
+				if strings.HasPrefix(name, "EPUB/xhtml/") && strings.Contains(content, "Content for chapter 1") {
+					linked = strings.Contains(content, `href="../css/styles.css"`)
+				}
+			}
+			if !linked {
+				t.Error("chapter section does not link the stylesheet")
+			}
+		})
+	}
+}
+
+func TestEPUBCreator_CreateEPUB_EmptyCSS(t *testing.T) {
+	formatter := NewFormatter()
+	formatter.SetCSS("")
+
+	creator := NewEPUBCreator()
+	creator.SetFormatter(formatter)
+	outputPath := filepath.Join(t.TempDir(), "plain.epub")
+	creator.SetOutputPath(outputPath)
+
+	err := creator.CreateEPUB([]models.Chapter{{Title: "Chapter 1", URL: "url1"}}, &mockChapterContentFetcher{})
+	if err != nil {
+		t.Fatalf("CreateEPUB() with empty CSS failed: %v", err)
+	}
+
+	if _, ok := readZipEntries(t, outputPath)["EPUB/css/styles.css"]; ok {
+		t.Error("empty CSS should not be embedded")
+	}
+}
+
+func TestEPUBCreator_CreateEPUB_Concurrent(t *testing.T) {
+	creator := NewEPUBCreator()
+	creator.SetConcurrency(4)
+	outputPath := filepath.Join(t.TempDir(), "concurrent.epub")
+	creator.SetOutputPath(outputPath)
+
+	var chapters []models.Chapter
+	for i := 0; i < 10; i++ {
+		chapters = append(chapters, models.Chapter{Title: fmt.Sprintf("1.%02d", i), URL: fmt.Sprintf("url%d", i), Index: i})
+	}
+
+	var mu sync.Mutex
+	var counts []int
+	creator.SetProgressCallback(func(current, total int, title string) {
+		mu.Lock()
+		defer mu.Unlock()
+		counts = append(counts, current)
+	})
+
+	if err := creator.CreateEPUB(chapters, &mockChapterContentFetcher{}); err != nil {
+		t.Fatalf("CreateEPUB() failed: %v", err)
+	}
+
+	for i, current := range counts {
+		if current != i+1 {
+			t.Errorf("progress counts = %v, want 1..%d", counts, len(chapters))
+			break
+		}
+	}
+
+	book, err := ReadEPUB(outputPath)
+	if err != nil {
+		t.Fatalf("ReadEPUB() failed: %v", err)
+	}
+	if len(book.Sections) != len(chapters) {
+		t.Fatalf("book has %d sections, want %d", len(book.Sections), len(chapters))
+	}
+	for i, section := range book.Sections {
+		if section.Title != chapters[i].Title {
+			t.Errorf("section %d = %q, want %q", i, section.Title, chapters[i].Title)
+		}
+	}
+}
+
+// cancellingFetcher cancels the build once it has returned the given number
+// of chapters.
+type cancellingFetcher struct {
+	mu     sync.Mutex
+	after  int
+	served int
+	cancel context.CancelFunc
+}
+
+func (f *cancellingFetcher) FetchChapterContent(url, title string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.served >= f.after {
+		f.cancel()
+		return "", context.Canceled
+	}
+	f.served++
+	return "<p>Content for " + title + "</p>", nil
+}
+
+func TestEPUBCreator_CreateEPUBContext_Interrupted(t *testing.T) {
+	chapters := []models.Chapter{
+		{Title: "1.00", URL: "url0", Index: 0},
+		{Title: "1.01", URL: "url1", Index: 1},
+		{Title: "1.02", URL: "url2", Index: 2},
+		{Title: "1.03", URL: "url3", Index: 3},
+	}
+
+	tests := []struct {
+		name     string
+		after    int
+		sections []string
+	}{
+		{name: "partial book", after: 2, sections: []string{"1.00", "1.01"}},
+		{name: "nothing downloaded", after: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			creator := NewEPUBCreator()
+			outputPath := filepath.Join(t.TempDir(), "partial.epub")
+			creator.SetOutputPath(outputPath)
+
+			err := creator.CreateEPUBContext(ctx, chapters, &cancellingFetcher{after: tt.after, cancel: cancel})
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("CreateEPUBContext() error = %v, want context.Canceled", err)
+			}
+
+			if tt.sections == nil {
+				if _, err := os.Stat(outputPath); err == nil {
+					t.Error("an empty partial EPUB was written")
+				}
+				return
+			}
+
+			book, err := ReadEPUB(outputPath)
+			if err != nil {
+				t.Fatalf("partial EPUB is not readable: %v", err)
+			}
+			var titles []string
+			for _, section := range book.Sections {
+				titles = append(titles, section.Title)
+			}
+			if strings.Join(titles, ",") != strings.Join(tt.sections, ",") {
+				t.Errorf("partial EPUB sections = %v, want %v", titles, tt.sections)
+			}
+		})
+	}
+}
+
 // Test that EPUBCreator implements the Creator interface
 func TestEPUBCreator_ImplementsInterface(t *testing.T) {
 	var _ Creator = (*EPUBCreator)(nil)
+	var _ Updater = (*EPUBCreator)(nil)
 }
 
 // Test that mockChapterContentFetcher implements ChapterContentFetcher interface
 func TestMockFetcher_ImplementsInterface(t *testing.T) {
 	var _ ChapterContentFetcher = (*mockChapterContentFetcher)(nil)
 }
+
+type navItem struct {
+	Title    string    `xml:"a"`
+	Children []navItem `xml:"ol>li"`
+}
+
+// navOutline returns the table of contents of an EPUB as nested titles, e.g.
+// "Volume 1[1.00 1.01] 2.00".
+func navOutline(t *testing.T, filename string) string {
+	t.Helper()
+
+	var nav struct {
+		Items []navItem `xml:"body>nav>ol>li"`
+	}
+	if err := xml.Unmarshal([]byte(readZipEntries(t, filename)["EPUB/nav.xhtml"]), &nav); err != nil {
+		t.Fatalf("parsing nav.xhtml: %v", err)
+	}
+
+	var outline func(items []navItem) string
+	outline = func(items []navItem) string {
+		var parts []string
+		for _, item := range items {
+			part := strings.TrimSpace(item.Title)
+			if len(item.Children) > 0 {
+				part += "[" + outline(item.Children) + "]"
+			}
+			parts = append(parts, part)
+		}
+		return strings.Join(parts, " ")
+	}
+	return outline(nav.Items)
+}
+
+func TestEPUBCreator_CreateEPUB_Navigation(t *testing.T) {
+	chapters := []models.Chapter{
+		{Title: "Prologue", URL: "url0"},
+		{Title: "1.00", URL: "url1", Volume: "Volume 1"},
+		{Title: "1.01", URL: "url2", Volume: "Volume 1"},
+		{Title: "2.00", URL: "url3", Volume: "Volume 2", Book: "Book 1"},
+		{Title: "2.01", URL: "url4", Volume: "Volume 2", Book: "Book 1"},
+		{Title: "Interlude", URL: "url5", Volume: "Volume 2"},
+		{Title: "2.02", URL: "url6", Volume: "Volume 2", Book: "Book 2"},
+	}
+	outputPath := filepath.Join(t.TempDir(), "nested.epub")
+	creator := NewEPUBCreator()
+	creator.SetOutputPath(outputPath)
+	if err := creator.CreateEPUB(chapters[:6], &mockChapterContentFetcher{}); err != nil {
+		t.Fatalf("CreateEPUB() failed: %v", err)
+	}
+
+	expected := "Prologue Volume 1[1.00 1.01] Volume 2[Book 1[2.00 2.01] Interlude]"
+	if got := navOutline(t, outputPath); got != expected {
+		t.Errorf("table of contents = %q, want %q", got, expected)
+	}
+
+	entries := readZipEntries(t, outputPath)
+	if page := entries["EPUB/xhtml/volume0001.xhtml"]; !strings.Contains(page, `<h1>Volume 1</h1>`) {
+		t.Errorf("volume title page = %q, want a heading with the volume", page)
+	}
+
+	book, err := ReadEPUB(outputPath)
+	if err != nil {
+		t.Fatalf("ReadEPUB() failed: %v", err)
+	}
+	var titles []string
+	for _, section := range book.Sections {
+		titles = append(titles, section.Title)
+	}
+	if strings.Join(titles, ",") != "Prologue,1.00,1.01,2.00,2.01,Interlude" {
+		t.Errorf("sections = %v, want only the chapters", titles)
+	}
+
+	// Updating keeps the structure and places the new chapter in it
+	book.MatchSources(chapters)
+	if err := NewEPUBCreator().UpdateEPUB(book, chapters[6:], &mockChapterContentFetcher{}); err != nil {
+		t.Fatalf("UpdateEPUB() failed: %v", err)
+	}
+	expected = "Prologue Volume 1[1.00 1.01] Volume 2[Book 1[2.00 2.01] Interlude Book 2[2.02]]"
+	if got := navOutline(t, outputPath); got != expected {
+		t.Errorf("table of contents after update = %q, want %q", got, expected)
+	}
+}
@@ -16,6 +16,13 @@ p {
 	margin-bottom: 1em;
 	text-align: justify;
 }
+.title-page {
+	margin-top: 30%;
+	text-align: center;
+}
+.title-page h1 {
+	border-bottom: none;
+}
 .red { color: #e74c3c; }
 .blue { color: #3498db; }
 .green { color: #27ae60; }
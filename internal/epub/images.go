@@ -0,0 +1,260 @@
+package epub
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/go-shiori/go-epub"
+	"github.com/linuxswords/wandering-inn/internal/config"
+	"github.com/linuxswords/wandering-inn/internal/scraper"
+	"github.com/vincent-petithory/dataurl"
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// ImageOptions controls what happens to the images in chapters.
+type ImageOptions struct {
+	// Skip leaves images out of the book. Their captions are kept.
+	Skip bool
+	// MaxWidth downscales images wider than this many pixels. 0 keeps
+	// every image at its original size.
+	MaxWidth int
+	// Quality re-encodes images as JPEG with this quality (1-100). 0 keeps
+	// the original encoding where possible.
+	Quality int
+}
+
+var (
+	imageTagPattern = regexp.MustCompile(`<img\b[^>]*>`)
+	imageSrcPattern = regexp.MustCompile(`\ssrc="([^"]*)"`)
+)
+
+var imageExtensions = map[string]string{
+	"image/jpeg":    ".jpg",
+	"image/png":     ".png",
+	"image/gif":     ".gif",
+	"image/webp":    ".webp",
+	"image/svg+xml": ".svg",
+}
+
+// imageEmbedder downloads the images of sections and stores them, in the
+// book or elsewhere. Every image URL is downloaded once, one after another,
+// so the client's rate limit keeps the requests polite.
+type imageEmbedder struct {
+	fetcher scraper.PageFetcher
+	options ImageOptions
+	// store saves an image and returns what sections refer to it by
+	store func(filename, mediaType string, data []byte) (string, error)
+	// paths maps image URLs to what sections refer to them by, or to "" if
+	// the image could not be embedded.
+	paths map[string]string
+	// files maps the filenames of stored images to the same
+	files map[string]string
+}
+
+func newImageEmbedder(e *epub.Epub, fetcher scraper.PageFetcher, options ImageOptions) *imageEmbedder {
+	m := newEmbedder(fetcher, options)
+	m.store = func(filename, mediaType string, data []byte) (string, error) {
+		source := "data:" + mediaType + ";base64," + base64.StdEncoding.EncodeToString(data)
+		return e.AddImage(source, filename)
+	}
+	return m
+}
+
+func newEmbedder(fetcher scraper.PageFetcher, options ImageOptions) *imageEmbedder {
+	return &imageEmbedder{
+		fetcher: fetcher,
+		options: options,
+		paths:   make(map[string]string),
+		files:   make(map[string]string),
+	}
+}
+
+// ImageInliner replaces the images of chapters with data URIs, for formats
+// that are a single self-contained file.
+type ImageInliner struct {
+	embedder *imageEmbedder
+}
+
+// NewImageInliner returns an inliner that downloads images from fetcher and
+// shrinks them as options say. A nil fetcher goes straight to the site.
+func NewImageInliner(fetcher scraper.PageFetcher, options ImageOptions) *ImageInliner {
+	if fetcher == nil {
+		fetcher = scraper.HTTPFetcher{}
+	}
+	m := newEmbedder(fetcher, options)
+	m.store = func(filename, mediaType string, data []byte) (string, error) {
+		return dataurl.New(data, mediaType).String(), nil
+	}
+	return &ImageInliner{embedder: m}
+}
+
+// Inline returns the chapter HTML body, downloaded from pageURL, with its
+// images as data URIs. Images that cannot be downloaded are left out with a
+// warning.
+func (i *ImageInliner) Inline(ctx context.Context, body, pageURL string) string {
+	return i.embedder.embed(ctx, body, pageURL)
+}
+
+// embed rewrites the images of a section downloaded from pageURL to point
+// into the book. Images that cannot be downloaded are left out with a
+// warning.
+func (m *imageEmbedder) embed(ctx context.Context, body, pageURL string) string {
+	return imageTagPattern.ReplaceAllStringFunc(body, func(tag string) string {
+		if m.options.Skip {
+			return ""
+		}
+
+		match := imageSrcPattern.FindStringSubmatchIndex(tag)
+		if match == nil {
+			return ""
+		}
+		src := html.UnescapeString(tag[match[2]:match[3]])
+		if strings.HasPrefix(src, "../"+epub.ImageFolderName+"/") {
+			return tag
+		}
+
+		internal := m.add(ctx, scraper.ResolveImageURL(pageURL, src))
+		if internal == "" {
+			return ""
+		}
+		return tag[:match[2]] + internal + tag[match[3]:]
+	})
+}
+
+func (m *imageEmbedder) add(ctx context.Context, imageURL string) string {
+	if internal, ok := m.paths[imageURL]; ok {
+		return internal
+	}
+
+	internal, err := m.download(ctx, imageURL)
+	if err != nil {
+		// Once interrupted, every download fails; that is not worth a warning
+		// per image, nor remembering.
+		if ctx.Err() == nil {
+			fmt.Printf("Warning: Failed to embed image %s: %v\n", imageURL, err)
+			m.paths[imageURL] = ""
+		}
+		return ""
+	}
+
+	m.paths[imageURL] = internal
+	return internal
+}
+
+func (m *imageEmbedder) download(ctx context.Context, imageURL string) (string, error) {
+	data, err := m.fetcher.Fetch(ctx, imageURL)
+	if err != nil {
+		return "", err
+	}
+
+	data, err = processImage(data, m.options)
+	if err != nil {
+		return "", err
+	}
+
+	mediaType := imageMediaType(data)
+	ext, ok := imageExtensions[mediaType]
+	if !ok {
+		return "", fmt.Errorf("not an image (%s)", mediaType)
+	}
+
+	// Named after the URL, so the same image keeps its file across updates
+	sum := sha256.Sum256([]byte(imageURL))
+	filename := fmt.Sprintf("image-%x%s", sum[:8], ext)
+	if internal, ok := m.files[filename]; ok {
+		return internal, nil
+	}
+	return m.addFile(filename, mediaType, data)
+}
+
+// keep adds an image of an existing book under its old filename, so the
+// sections that refer to it stay valid.
+func (m *imageEmbedder) keep(filename string, data []byte) error {
+	_, err := m.addFile(filename, imageMediaType(data), data)
+	return err
+}
+
+func (m *imageEmbedder) addFile(filename, mediaType string, data []byte) (string, error) {
+	internal, err := m.store(filename, mediaType, data)
+	if err != nil {
+		return "", err
+	}
+	m.files[filename] = internal
+	return internal, nil
+}
+
+func imageMediaType(data []byte) string {
+	mediaType := http.DetectContentType(data)
+	if strings.HasPrefix(mediaType, "text/") && bytes.Contains(data[:min(len(data), 1024)], []byte("<svg")) {
+		return "image/svg+xml"
+	}
+	return strings.TrimSpace(strings.Split(mediaType, ";")[0])
+}
+
+// processImage downscales and re-encodes an image as the options ask.
+// Images that cannot be decoded, such as SVGs, are returned unchanged, and so
+// are GIFs that need no downscaling, since they may be animated.
+func processImage(data []byte, options ImageOptions) ([]byte, error) {
+	if options.MaxWidth <= 0 && options.Quality <= 0 {
+		return data, nil
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return data, nil
+	}
+
+	bounds := img.Bounds()
+	scaled := options.MaxWidth > 0 && bounds.Dx() > options.MaxWidth
+	if scaled {
+		height := max(1, bounds.Dy()*options.MaxWidth/bounds.Dx())
+		dst := image.NewRGBA(image.Rect(0, 0, options.MaxWidth, height))
+		xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Over, nil)
+		img = dst
+	} else if format == "gif" {
+		return data, nil
+	}
+
+	var buf bytes.Buffer
+	quality := options.Quality
+	if quality <= 0 {
+		if !scaled {
+			return data, nil
+		}
+		if format == "png" || format == "gif" {
+			if err := png.Encode(&buf, img); err != nil {
+				return nil, err
+			}
+			return buf.Bytes(), nil
+		}
+		quality = config.DefaultImageQuality
+	}
+
+	// JPEG has no transparency; put the image on a white page instead of
+	// letting transparent areas turn black.
+	flat := image.NewRGBA(img.Bounds())
+	draw.Draw(flat, flat.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), img, img.Bounds().Min, draw.Over)
+	if err := jpeg.Encode(&buf, flat, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, err
+	}
+
+	// Re-encoding alone can make an already compressed image larger
+	if !scaled && buf.Len() >= len(data) {
+		return data, nil
+	}
+	return buf.Bytes(), nil
+}
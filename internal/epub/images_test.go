@@ -0,0 +1,293 @@
+package epub
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/linuxswords/wandering-inn/internal/models"
+	"github.com/linuxswords/wandering-inn/internal/scraper"
+)
+
+// imageFetcher serves images from memory and counts the downloads.
+type imageFetcher struct {
+	images    map[string][]byte
+	downloads map[string]int
+}
+
+func (f *imageFetcher) Fetch(ctx context.Context, url string) ([]byte, error) {
+	if f.downloads == nil {
+		f.downloads = make(map[string]int)
+	}
+	f.downloads[url]++
+
+	data, ok := f.images[url]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return data, nil
+}
+
+func testPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for x := range width {
+		for y := range height {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 200, A: 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("encoding PNG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestProcessImage(t *testing.T) {
+	wide := testPNG(t, 400, 200)
+
+	var gifData bytes.Buffer
+	if err := gif.Encode(&gifData, image.NewPaletted(image.Rect(0, 0, 50, 50), color.Palette{color.Black, color.White}), nil); err != nil {
+		t.Fatalf("encoding GIF: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		data      []byte
+		options   ImageOptions
+		format    string
+		width     int
+		unchanged bool
+	}{
+		{name: "no options", data: wide, unchanged: true},
+		{name: "downscaled PNG stays PNG", data: wide, options: ImageOptions{MaxWidth: 100}, format: "png", width: 100},
+		{name: "narrow enough", data: wide, options: ImageOptions{MaxWidth: 800}, unchanged: true},
+		{name: "re-encoded as JPEG", data: wide, options: ImageOptions{MaxWidth: 200, Quality: 60}, format: "jpeg", width: 200},
+		{name: "GIF is not re-encoded", data: gifData.Bytes(), options: ImageOptions{Quality: 60}, unchanged: true},
+		{name: "not decodable", data: []byte(`<svg xmlns="http://www.w3.org/2000/svg"/>`), options: ImageOptions{MaxWidth: 10}, unchanged: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := processImage(tt.data, tt.options)
+			if err != nil {
+				t.Fatalf("processImage() failed: %v", err)
+			}
+
+			if tt.unchanged {
+				if !bytes.Equal(result, tt.data) {
+					t.Error("processImage() changed the image, want it unchanged")
+				}
+				return
+			}
+
+			config, format, err := image.DecodeConfig(bytes.NewReader(result))
+			if err != nil {
+				t.Fatalf("result is not an image: %v", err)
+			}
+			if format != tt.format || config.Width != tt.width {
+				t.Errorf("result is a %d pixel wide %s, want a %d pixel wide %s", config.Width, format, tt.width, tt.format)
+			}
+		})
+	}
+}
+
+func TestEPUBCreator_CreateEPUB_EmbedsImages(t *testing.T) {
+	var jpegData bytes.Buffer
+	if err := jpeg.Encode(&jpegData, image.NewRGBA(image.Rect(0, 0, 10, 10)), nil); err != nil {
+		t.Fatalf("encoding JPEG: %v", err)
+	}
+	images := &imageFetcher{images: map[string][]byte{
+		"https://wanderinginn.com/art/erin.png": testPNG(t, 20, 20),
+		"https://wanderinginn.com/art/inn.jpg":  jpegData.Bytes(),
+	}}
+
+	creator := NewEPUBCreator()
+	creator.SetImageFetcher(images)
+	outputPath := filepath.Join(t.TempDir(), "images.epub")
+	creator.SetOutputPath(outputPath)
+
+	chapters := []models.Chapter{
+		{Title: "1.00", URL: "https://wanderinginn.com/2016/07/27/1-00/", Index: 0},
+		{Title: "1.01", URL: "https://wanderinginn.com/2016/07/28/1-01/", Index: 1},
+	}
+	fetcher := &mockChapterContentFetcher{chapters: map[string]string{
+		chapters[0].URL: `<figure><img src="https://wanderinginn.com/art/erin.png" alt="Erin"/><figcaption>Erin by an artist</figcaption></figure>` +
+			`<p><img src="/art/inn.jpg" alt="The inn"/></p>`,
+		chapters[1].URL: `<img src="https://wanderinginn.com/art/erin.png" alt="Erin again"/><img src="https://wanderinginn.com/art/gone.png" alt="Gone"/>`,
+	}}
+
+	if err := creator.CreateEPUB(chapters, fetcher); err != nil {
+		t.Fatalf("CreateEPUB() failed: %v", err)
+	}
+
+	if n := images.downloads["https://wanderinginn.com/art/erin.png"]; n != 1 {
+		t.Errorf("image used twice was downloaded %d times, want once", n)
+	}
+
+	entries := readZipEntries(t, outputPath)
+	var files []string
+	for name := range entries {
+		if strings.HasPrefix(name, "EPUB/images/image-") {
+			files = append(files, name)
+		}
+	}
+	if len(files) != 2 {
+		t.Fatalf("book has images %v, want 2", files)
+	}
+
+	book, err := ReadEPUB(outputPath)
+	if err != nil {
+		t.Fatalf("ReadEPUB() failed: %v", err)
+	}
+	first, second := book.Sections[0].Body, book.Sections[1].Body
+	if strings.Contains(first, "https://") || strings.Count(first, `src="../images/image-`) != 2 {
+		t.Errorf("first section = %q, want both images pointing into the book", first)
+	}
+	if !strings.Contains(first, `alt="Erin"`) || !strings.Contains(first, "<figcaption>Erin by an artist</figcaption>") {
+		t.Errorf("first section = %q, want alt text and caption kept", first)
+	}
+	if strings.Contains(second, "gone.png") || strings.Count(second, "<img") != 1 {
+		t.Errorf("second section = %q, want only the image that could be downloaded", second)
+	}
+}
+
+func TestEPUBCreator_CreateEPUB_SkipImages(t *testing.T) {
+	images := &imageFetcher{}
+	creator := NewEPUBCreator()
+	creator.SetImageFetcher(images)
+	creator.SetImageOptions(ImageOptions{Skip: true})
+	outputPath := filepath.Join(t.TempDir(), "no-images.epub")
+	creator.SetOutputPath(outputPath)
+
+	fetcher := &mockChapterContentFetcher{chapters: map[string]string{
+		"url1": `<figure><img src="https://wanderinginn.com/art/erin.png" alt="Erin"/><figcaption>Erin</figcaption></figure>`,
+	}}
+	if err := creator.CreateEPUB([]models.Chapter{{Title: "1.00", URL: "url1"}}, fetcher); err != nil {
+		t.Fatalf("CreateEPUB() failed: %v", err)
+	}
+
+	if len(images.downloads) != 0 {
+		t.Errorf("downloaded %v, want no image downloads", images.downloads)
+	}
+	book, err := ReadEPUB(outputPath)
+	if err != nil {
+		t.Fatalf("ReadEPUB() failed: %v", err)
+	}
+	if body := book.Sections[0].Body; strings.Contains(body, "<img") || !strings.Contains(body, "<figcaption>Erin</figcaption>") {
+		t.Errorf("section = %q, want the caption without the image", body)
+	}
+}
+
+func TestEPUBCreator_UpdateEPUB_KeepsImages(t *testing.T) {
+	images := &imageFetcher{images: map[string][]byte{
+		"https://wanderinginn.com/art/erin.png": testPNG(t, 20, 20),
+	}}
+	creator := NewEPUBCreator()
+	creator.SetImageFetcher(images)
+	outputPath := filepath.Join(t.TempDir(), "update.epub")
+	creator.SetOutputPath(outputPath)
+
+	fetcher := &mockChapterContentFetcher{chapters: map[string]string{
+		"url1": `<img src="https://wanderinginn.com/art/erin.png" alt="Erin"/>`,
+		"url2": `<img src="https://wanderinginn.com/art/erin.png" alt="Erin again"/>`,
+	}}
+	if err := creator.CreateEPUB([]models.Chapter{{Title: "1.00", URL: "url1"}}, fetcher); err != nil {
+		t.Fatalf("CreateEPUB() failed: %v", err)
+	}
+
+	book, err := ReadEPUB(outputPath)
+	if err != nil {
+		t.Fatalf("ReadEPUB() failed: %v", err)
+	}
+	if len(book.Images) != 1 {
+		t.Fatalf("ReadEPUB() found %d images, want 1", len(book.Images))
+	}
+
+	creator = NewEPUBCreator()
+	creator.SetImageFetcher(images)
+	if err := creator.UpdateEPUB(book, []models.Chapter{{Title: "1.01", URL: "url2"}}, fetcher); err != nil {
+		t.Fatalf("UpdateEPUB() failed: %v", err)
+	}
+
+	updated, err := ReadEPUB(outputPath)
+	if err != nil {
+		t.Fatalf("ReadEPUB() of updated book failed: %v", err)
+	}
+	if len(updated.Images) != 1 || updated.Images[0].Href != book.Images[0].Href {
+		t.Errorf("updated book has images %v, want the original %s only", updated.Images, book.Images[0].Href)
+	}
+	for _, section := range updated.Sections {
+		if !strings.Contains(section.Body, "../"+book.Images[0].Href) {
+			t.Errorf("section %s = %q, want it to show %s", section.Title, section.Body, book.Images[0].Href)
+		}
+	}
+}
+
+func TestEPUBCreator_OfflineImages(t *testing.T) {
+	chapter := models.Chapter{Title: "1.00", URL: "https://wanderinginn.com/2017/03/03/1-00/"}
+	source := &imageFetcher{images: map[string][]byte{
+		chapter.URL:                             []byte(`<div class="entry-content"><p><img src="/art/erin.png" alt="Erin"/></p></div>`),
+		"https://wanderinginn.com/art/erin.png": testPNG(t, 20, 20),
+	}}
+
+	// What the fetch command does
+	archive := scraper.NewArchive(t.TempDir())
+	if err := archive.Save(context.Background(), source, chapter.URL); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+	if _, err := archive.SaveImages(context.Background(), source, chapter); err != nil {
+		t.Fatalf("SaveImages() failed: %v", err)
+	}
+
+	offline := scraper.NewWanderingInnScraper()
+	offline.SetPageFetcher(archive)
+	creator := NewEPUBCreator()
+	creator.SetImageFetcher(archive)
+	outputPath := filepath.Join(t.TempDir(), "offline.epub")
+	creator.SetOutputPath(outputPath)
+	if err := creator.CreateEPUB([]models.Chapter{chapter}, offline); err != nil {
+		t.Fatalf("CreateEPUB() failed: %v", err)
+	}
+
+	if n := source.downloads["https://wanderinginn.com/art/erin.png"]; n != 1 {
+		t.Errorf("image was downloaded %d times, want once by the fetch", n)
+	}
+	book, err := ReadEPUB(outputPath)
+	if err != nil {
+		t.Fatalf("ReadEPUB() failed: %v", err)
+	}
+	if len(book.Images) != 1 || !strings.Contains(book.Sections[0].Body, "../"+book.Images[0].Href) {
+		t.Errorf("offline book has images %v and section %q, want the archived image shown", book.Images, book.Sections[0].Body)
+	}
+}
+
+func TestImageInliner_Inline(t *testing.T) {
+	data := testPNG(t, 20, 20)
+	fetcher := &imageFetcher{images: map[string][]byte{
+		"https://wanderinginn.com/art/erin.png": data,
+	}}
+	inliner := NewImageInliner(fetcher, ImageOptions{})
+
+	body := `<p><img src="/art/erin.png" alt="Erin"/><img src="https://wanderinginn.com/art/missing.png"/></p>`
+	want := `<p><img src="data:image/png;base64,` + base64.StdEncoding.EncodeToString(data) + `" alt="Erin"/></p>`
+	for range 2 {
+		if got := inliner.Inline(context.Background(), body, "https://wanderinginn.com/2017/03/03/1-00/"); got != want {
+			t.Errorf("Inline() = %q, want %q", got, want)
+		}
+	}
+	if n := fetcher.downloads["https://wanderinginn.com/art/erin.png"]; n != 1 {
+		t.Errorf("image was downloaded %d times, want once", n)
+	}
+}
@@ -0,0 +1,305 @@
+package epub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/linuxswords/wandering-inn/internal/config"
+	"github.com/linuxswords/wandering-inn/internal/models"
+	"github.com/linuxswords/wandering-inn/internal/scraper"
+	"github.com/linuxswords/wandering-inn/pkg/utils"
+)
+
+// ErrUnfinishedBuild is returned when starting a build in a work directory
+// that holds the progress of another build.
+var ErrUnfinishedBuild = errors.New("unfinished build")
+
+const (
+	manifestFilename = "manifest.json"
+	chaptersDirname  = "chapters"
+)
+
+// Manifest records the progress of a build in a work directory: the selected
+// chapters, and for each downloaded chapter the file holding its processed
+// HTML. A build that failed or was interrupted can be resumed from it without
+// downloading those chapters again.
+type Manifest struct {
+	Output string `json:"output,omitempty"`
+	// Format is the output format, if not EPUB.
+	Format string `json:"format,omitempty"`
+	// Flags are the command-line settings the build was started with, so a
+	// resumed build writes the same book.
+	Flags      []Flag           `json:"flags,omitempty"`
+	Identifier string           `json:"identifier,omitempty"`
+	Chapters   []models.Chapter `json:"chapters"`
+	// Fetched maps chapter URLs to their HTML file, relative to the work
+	// directory.
+	Fetched map[string]string `json:"fetched"`
+	// Missing maps the URLs of chapters that can never be downloaded, such
+	// as deleted pages, to the reason. They are left out of the book rather
+	// than keeping the build unfinished.
+	Missing map[string]string `json:"missing,omitempty"`
+
+	dir string
+	mu  sync.Mutex
+}
+
+// Flag is a command-line flag and its value.
+type Flag struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// DefaultWorkDir returns the work directory for builds below the user's
+// cache directory.
+func DefaultWorkDir() (string, error) {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, config.CacheDirName, "build"), nil
+}
+
+// NewManifest starts a new build of chapters in dir. It fails with
+// ErrUnfinishedBuild if dir already holds the manifest of a build that has
+// not finished, which is either still running or can be resumed; call
+// DiscardManifest first to start over.
+func NewManifest(dir string, chapters []models.Chapter, output string) (*Manifest, error) {
+	m := &Manifest{
+		Output:   output,
+		Chapters: chapters,
+		Fetched:  make(map[string]string),
+		Missing:  make(map[string]string),
+		dir:      dir,
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	// Creating the manifest exclusively claims the directory, so two builds
+	// never write their chapters to the same place
+	f, err := os.OpenFile(filepath.Join(dir, manifestFilename), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if errors.Is(err, os.ErrExist) {
+		return nil, fmt.Errorf("%w in %s", ErrUnfinishedBuild, dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+
+	// Chapters left behind by a build whose removal was cut short
+	if err := os.RemoveAll(filepath.Join(dir, chaptersDirname)); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Join(dir, chaptersDirname), 0755); err != nil {
+		return nil, err
+	}
+	if err := m.save(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// DiscardManifest deletes the progress of any unfinished build in dir.
+func DiscardManifest(dir string) error {
+	return (&Manifest{dir: dir}).Remove()
+}
+
+// LoadManifest reads the manifest of an unfinished build in dir.
+func LoadManifest(dir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, manifestFilename))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no unfinished build in %s", dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{dir: dir}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("reading build manifest: %w", err)
+	}
+	if m.Fetched == nil {
+		m.Fetched = make(map[string]string)
+	}
+	if m.Missing == nil {
+		m.Missing = make(map[string]string)
+	}
+	return m, nil
+}
+
+func (m *Manifest) Dir() string {
+	return m.dir
+}
+
+// Pending returns the chapters that have not been downloaded yet and may
+// still be. The build is finished when there are none.
+func (m *Manifest) Pending() []models.Chapter {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var pending []models.Chapter
+	for _, chapter := range m.Chapters {
+		_, fetched := m.Fetched[chapter.URL]
+		_, missing := m.Missing[chapter.URL]
+		if !fetched && !missing {
+			pending = append(pending, chapter)
+		}
+	}
+	return pending
+}
+
+// Remove deletes the manifest and the stored chapters once a build is done.
+// Other files in the work directory are left alone.
+func (m *Manifest) Remove() error {
+	if err := os.RemoveAll(filepath.Join(m.dir, chaptersDirname)); err != nil {
+		return err
+	}
+	err := os.Remove(filepath.Join(m.dir, manifestFilename))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Fetcher wraps fetcher so chapters recorded in the manifest are read from the
+// work directory, and newly downloaded chapters are recorded as they arrive.
+func (m *Manifest) Fetcher(fetcher ChapterContentFetcher) ChapterContentFetcher {
+	return &manifestFetcher{manifest: m, fetcher: fetcher}
+}
+
+func (m *Manifest) content(url string) (string, bool) {
+	m.mu.Lock()
+	file, ok := m.Fetched[url]
+	m.mu.Unlock()
+	if !ok {
+		return "", false
+	}
+
+	content, err := os.ReadFile(filepath.Join(m.dir, file))
+	if err != nil {
+		return "", false
+	}
+	return string(content), true
+}
+
+func (m *Manifest) record(url, content string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	position := -1
+	for i, chapter := range m.Chapters {
+		if chapter.URL == url {
+			position = i
+			break
+		}
+	}
+	if position == -1 {
+		return nil
+	}
+
+	file := filepath.Join(chaptersDirname, fmt.Sprintf("%04d.html", position))
+	if err := utils.WriteFileAtomic(filepath.Join(m.dir, file), []byte(content)); err != nil {
+		return err
+	}
+	m.Fetched[url] = file
+	delete(m.Missing, url)
+	return m.save()
+}
+
+// recordMissing records that the chapter at url can never be downloaded.
+func (m *Manifest) recordMissing(url string, reason error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !slices.ContainsFunc(m.Chapters, func(chapter models.Chapter) bool { return chapter.URL == url }) {
+		return nil
+	}
+	m.Missing[url] = reason.Error()
+	return m.save()
+}
+
+// permanentFailure reports whether a chapter that failed with err would fail
+// the same way however often it is tried again.
+func permanentFailure(err error) bool {
+	return errors.Is(err, utils.ErrNotFound) ||
+		errors.Is(err, utils.ErrDisallowed) ||
+		errors.Is(err, scraper.ErrNoContent)
+}
+
+// setIdentifier records the book identifier the first time and returns the
+// recorded one, so a resumed build produces the same book.
+func (m *Manifest) setIdentifier(identifier string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.Identifier != "" {
+		return m.Identifier, nil
+	}
+	m.Identifier = identifier
+	return identifier, m.save()
+}
+
+// SetSettings records the output format and the flags of the build, so it is
+// resumed with the same ones.
+func (m *Manifest) SetSettings(format string, flags []Flag) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if format != "epub" {
+		m.Format = format
+	}
+	m.Flags = flags
+	return m.save()
+}
+
+// save writes the manifest; callers other than NewManifest hold m.mu.
+func (m *Manifest) save() error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(filepath.Join(m.dir, manifestFilename), data)
+}
+
+type manifestFetcher struct {
+	manifest *Manifest
+	fetcher  ChapterContentFetcher
+}
+
+func (f *manifestFetcher) FetchChapterContent(url, title string) (string, error) {
+	return f.FetchChapterContentContext(context.Background(), url, title)
+}
+
+func (f *manifestFetcher) FetchChapterContentContext(ctx context.Context, url, title string) (string, error) {
+	if content, ok := f.manifest.content(url); ok {
+		return content, nil
+	}
+
+	var content string
+	var err error
+	if contextFetcher, ok := f.fetcher.(scraper.ContextChapterFetcher); ok {
+		content, err = contextFetcher.FetchChapterContentContext(ctx, url, title)
+	} else {
+		content, err = f.fetcher.FetchChapterContent(url, title)
+	}
+	if err != nil {
+		if permanentFailure(err) {
+			if err := f.manifest.recordMissing(url, err); err != nil {
+				fmt.Printf("Warning: Failed to save progress for chapter %s: %v\n", title, err)
+			}
+		}
+		return "", err
+	}
+
+	if err := f.manifest.record(url, content); err != nil {
+		fmt.Printf("Warning: Failed to save progress for chapter %s: %v\n", title, err)
+	}
+	return content, nil
+}
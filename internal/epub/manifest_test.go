@@ -0,0 +1,315 @@
+package epub
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/linuxswords/wandering-inn/internal/models"
+	"github.com/linuxswords/wandering-inn/internal/scraper"
+	"github.com/linuxswords/wandering-inn/pkg/utils"
+)
+
+var manifestChapters = []models.Chapter{
+	{Title: "1.00", URL: "url0", Index: 0, Volume: "Volume 1"},
+	{Title: "1.01", URL: "url1", Index: 1, Volume: "Volume 1"},
+	{Title: "1.02", URL: "url2", Index: 2, Volume: "Volume 1"},
+}
+
+// countingFetcher counts downloads per URL and fails the URLs in fail, with
+// err if it is set.
+type countingFetcher struct {
+	mu     sync.Mutex
+	calls  map[string]int
+	fail   map[string]bool
+	err    error
+	prefix string
+}
+
+func (f *countingFetcher) FetchChapterContent(url, title string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.calls == nil {
+		f.calls = make(map[string]int)
+	}
+	f.calls[url]++
+	if f.fail[url] {
+		if f.err != nil {
+			return "", f.err
+		}
+		return "", errors.New("connection reset")
+	}
+	return "<p>" + f.prefix + title + "</p>", nil
+}
+
+func TestManifest_RecordAndLoad(t *testing.T) {
+	dir := t.TempDir()
+	manifest, err := NewManifest(dir, manifestChapters, "out.epub")
+	if err != nil {
+		t.Fatalf("NewManifest() failed: %v", err)
+	}
+
+	fetcher := manifest.Fetcher(&countingFetcher{})
+	if _, err := fetcher.FetchChapterContent("url1", "1.01"); err != nil {
+		t.Fatalf("FetchChapterContent() failed: %v", err)
+	}
+
+	loaded, err := LoadManifest(dir)
+	if err != nil {
+		t.Fatalf("LoadManifest() failed: %v", err)
+	}
+	if loaded.Output != "out.epub" || len(loaded.Chapters) != 3 || loaded.Chapters[0].Volume != "Volume 1" {
+		t.Errorf("LoadManifest() = %+v, want the saved build", loaded)
+	}
+
+	pending := loaded.Pending()
+	if len(pending) != 2 || pending[0].URL != "url0" || pending[1].URL != "url2" {
+		t.Errorf("Pending() = %+v, want chapters 1.00 and 1.02", pending)
+	}
+
+	content, ok := loaded.content("url1")
+	if !ok || content != "<p>1.01</p>" {
+		t.Errorf("content(url1) = (%q, %v), want the recorded chapter", content, ok)
+	}
+}
+
+func TestManifest_SetSettings(t *testing.T) {
+	dir := t.TempDir()
+	manifest, err := NewManifest(dir, manifestChapters, "out.pdf")
+	if err != nil {
+		t.Fatalf("NewManifest() failed: %v", err)
+	}
+
+	flags := []Flag{{Name: "title", Value: "Inn {{range}}"}, {Name: "subject", Value: "Fantasy"}, {Name: "subject", Value: "LitRPG"}}
+	if err := manifest.SetSettings("pdf", flags); err != nil {
+		t.Fatalf("SetSettings() failed: %v", err)
+	}
+
+	loaded, err := LoadManifest(dir)
+	if err != nil {
+		t.Fatalf("LoadManifest() failed: %v", err)
+	}
+	if loaded.Format != "pdf" {
+		t.Errorf("Format = %q, want pdf", loaded.Format)
+	}
+	if fmt.Sprint(loaded.Flags) != fmt.Sprint(flags) {
+		t.Errorf("Flags = %+v, want %+v", loaded.Flags, flags)
+	}
+}
+
+func TestManifest_FetcherReusesRecordedChapters(t *testing.T) {
+	manifest, err := NewManifest(t.TempDir(), manifestChapters, "")
+	if err != nil {
+		t.Fatalf("NewManifest() failed: %v", err)
+	}
+
+	inner := &countingFetcher{}
+	fetcher := manifest.Fetcher(inner)
+	for i := 0; i < 2; i++ {
+		if _, err := fetcher.FetchChapterContent("url0", "1.00"); err != nil {
+			t.Fatalf("FetchChapterContent() failed: %v", err)
+		}
+	}
+
+	if inner.calls["url0"] != 1 {
+		t.Errorf("chapter downloaded %d times, want 1", inner.calls["url0"])
+	}
+}
+
+func TestManifest_FailedChapterStaysPending(t *testing.T) {
+	manifest, err := NewManifest(t.TempDir(), manifestChapters, "")
+	if err != nil {
+		t.Fatalf("NewManifest() failed: %v", err)
+	}
+
+	fetcher := manifest.Fetcher(&countingFetcher{fail: map[string]bool{"url0": true}})
+	if _, err := fetcher.FetchChapterContent("url0", "1.00"); err == nil {
+		t.Fatal("FetchChapterContent() expected error")
+	}
+	if len(manifest.Pending()) != 3 {
+		t.Errorf("Pending() = %d chapters, want 3", len(manifest.Pending()))
+	}
+}
+
+func TestNewManifest_RefusesUnfinishedBuild(t *testing.T) {
+	dir := t.TempDir()
+	old, err := NewManifest(dir, manifestChapters, "old.epub")
+	if err != nil {
+		t.Fatalf("NewManifest() failed: %v", err)
+	}
+	old.Fetcher(&countingFetcher{}).FetchChapterContent("url0", "1.00")
+
+	if _, err := NewManifest(dir, manifestChapters[:1], "new.epub"); !errors.Is(err, ErrUnfinishedBuild) {
+		t.Fatalf("NewManifest() over an unfinished build error = %v, want ErrUnfinishedBuild", err)
+	}
+
+	loaded, err := LoadManifest(dir)
+	if err != nil {
+		t.Fatalf("LoadManifest() failed: %v", err)
+	}
+	if loaded.Output != "old.epub" || len(loaded.Pending()) != 2 {
+		t.Errorf("unfinished build was changed: output %q, %d pending", loaded.Output, len(loaded.Pending()))
+	}
+}
+
+func TestDiscardManifest(t *testing.T) {
+	dir := t.TempDir()
+	old, err := NewManifest(dir, manifestChapters, "old.epub")
+	if err != nil {
+		t.Fatalf("NewManifest() failed: %v", err)
+	}
+	old.Fetcher(&countingFetcher{}).FetchChapterContent("url0", "1.00")
+
+	other := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(other, []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := DiscardManifest(dir); err != nil {
+		t.Fatalf("DiscardManifest() failed: %v", err)
+	}
+	manifest, err := NewManifest(dir, manifestChapters[:1], "new.epub")
+	if err != nil {
+		t.Fatalf("NewManifest() failed: %v", err)
+	}
+	if len(manifest.Pending()) != 1 {
+		t.Errorf("new build has %d pending chapters, want 1", len(manifest.Pending()))
+	}
+	if _, ok := manifest.content("url0"); ok {
+		t.Error("new build reused a chapter of the previous one")
+	}
+
+	if err := manifest.Remove(); err != nil {
+		t.Fatalf("Remove() failed: %v", err)
+	}
+	if _, err := LoadManifest(dir); err == nil {
+		t.Error("LoadManifest() after Remove() expected error")
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Error("Remove() deleted a file it did not create")
+	}
+}
+
+func TestManifest_PermanentFailureIsNotPending(t *testing.T) {
+	dir := t.TempDir()
+	manifest, err := NewManifest(dir, manifestChapters, "")
+	if err != nil {
+		t.Fatalf("NewManifest() failed: %v", err)
+	}
+
+	fetcher := manifest.Fetcher(&countingFetcher{
+		fail: map[string]bool{"url0": true},
+		err:  fmt.Errorf("fetching url0: %w", utils.ErrNotFound),
+	})
+	if _, err := fetcher.FetchChapterContent("url0", "1.00"); err == nil {
+		t.Fatal("FetchChapterContent() expected error")
+	}
+
+	loaded, err := LoadManifest(dir)
+	if err != nil {
+		t.Fatalf("LoadManifest() failed: %v", err)
+	}
+	if pending := loaded.Pending(); len(pending) != 2 || pending[0].URL != "url1" {
+		t.Errorf("Pending() = %+v, want the chapters other than the missing one", pending)
+	}
+}
+
+func TestEPUBCreator_CreateEPUB_PermanentFailureFinishesBuild(t *testing.T) {
+	dir := t.TempDir()
+	outputPath := filepath.Join(t.TempDir(), "book.epub")
+	manifest, err := NewManifest(dir, manifestChapters, outputPath)
+	if err != nil {
+		t.Fatalf("NewManifest() failed: %v", err)
+	}
+
+	creator := NewEPUBCreator()
+	creator.SetOutputPath(outputPath)
+	creator.SetManifest(manifest)
+	deleted := &countingFetcher{fail: map[string]bool{"url1": true}, err: scraper.ErrNoContent}
+	if err := creator.CreateEPUB(manifestChapters, deleted); err != nil {
+		t.Fatalf("CreateEPUB() failed: %v", err)
+	}
+
+	if _, err := LoadManifest(dir); err == nil {
+		t.Error("manifest was kept although the only missing chapter can never be downloaded")
+	}
+	book, err := ReadEPUB(outputPath)
+	if err != nil {
+		t.Fatalf("ReadEPUB() failed: %v", err)
+	}
+	if len(book.Sections) != 2 {
+		t.Errorf("book has %d sections, want 2", len(book.Sections))
+	}
+}
+
+func TestLoadManifest_Missing(t *testing.T) {
+	_, err := LoadManifest(t.TempDir())
+	if err == nil || !strings.Contains(err.Error(), "no unfinished build") {
+		t.Errorf("LoadManifest() of empty dir error = %v, want no unfinished build", err)
+	}
+}
+
+func TestEPUBCreator_CreateEPUB_Resume(t *testing.T) {
+	dir := t.TempDir()
+	outputPath := filepath.Join(t.TempDir(), "resumed.epub")
+
+	manifest, err := NewManifest(dir, manifestChapters, outputPath)
+	if err != nil {
+		t.Fatalf("NewManifest() failed: %v", err)
+	}
+
+	creator := NewEPUBCreator()
+	creator.SetOutputPath(outputPath)
+	creator.SetManifest(manifest)
+	failing := &countingFetcher{fail: map[string]bool{"url1": true}}
+	if err := creator.CreateEPUB(manifestChapters, failing); err != nil {
+		t.Fatalf("first CreateEPUB() failed: %v", err)
+	}
+	first, err := ReadEPUB(outputPath)
+	if err != nil {
+		t.Fatalf("ReadEPUB() failed: %v", err)
+	}
+
+	resumed, err := LoadManifest(dir)
+	if err != nil {
+		t.Fatalf("manifest was not kept after a failed chapter: %v", err)
+	}
+
+	creator = NewEPUBCreator()
+	creator.SetOutputPath(resumed.Output)
+	creator.SetManifest(resumed)
+	// Downloads now return different content, so reused chapters can be told apart
+	retry := &countingFetcher{prefix: "retried "}
+	if err := creator.CreateEPUB(resumed.Chapters, retry); err != nil {
+		t.Fatalf("resumed CreateEPUB() failed: %v", err)
+	}
+
+	if len(retry.calls) != 1 || retry.calls["url1"] != 1 {
+		t.Errorf("resumed build downloaded %v, want only url1", retry.calls)
+	}
+
+	book, err := ReadEPUB(outputPath)
+	if err != nil {
+		t.Fatalf("ReadEPUB() failed: %v", err)
+	}
+	if len(book.Sections) != 3 {
+		t.Fatalf("resumed book has %d sections, want 3", len(book.Sections))
+	}
+	expected := []string{"<p>1.00</p>", "<p>retried 1.01</p>", "<p>1.02</p>"}
+	for i, section := range book.Sections {
+		if section.Title != manifestChapters[i].Title || !strings.Contains(section.Body, expected[i]) {
+			t.Errorf("section %d = %q %q, want %q %q", i, section.Title, section.Body, manifestChapters[i].Title, expected[i])
+		}
+	}
+	if book.Identifier != first.Identifier {
+		t.Errorf("resumed book identifier = %q, want %q from the first attempt", book.Identifier, first.Identifier)
+	}
+
+	if _, err := LoadManifest(dir); err == nil {
+		t.Error("manifest was kept after the book was completed")
+	}
+}
@@ -0,0 +1,246 @@
+package epub
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/linuxswords/wandering-inn/internal/config"
+	"github.com/linuxswords/wandering-inn/internal/models"
+	"github.com/linuxswords/wandering-inn/internal/scraper"
+)
+
+// Metadata describes the books a creator writes. Title and Description are
+// text/template templates executed with the TitleData of the book's
+// chapters; the other fields are used as they are.
+type Metadata struct {
+	Title       string
+	Author      string
+	Description string
+	Series      string
+	// SeriesIndex is the book's position in the series. It defaults to the
+	// volume number if all chapters are from one volume.
+	SeriesIndex string
+	Language    string
+	Publisher   string
+	Subjects    []string
+	// Identifier defaults to one derived from the series and the first and
+	// last chapter, so building the same chapters again gives the same book.
+	Identifier string
+	// Date is the publication date, as 2006-01-02 or RFC 3339. It defaults
+	// to when the last chapter was published, if that is known.
+	Date string
+}
+
+// TitleData is what the Title and Description templates can refer to, e.g.
+// "{{.Series}} – {{.Volume}} ({{.First}}–{{.Last}})".
+type TitleData struct {
+	Series string
+	// Volume is "Volume 8" for chapters of one volume, "Volumes 3–5" for
+	// several, and empty if a chapter's volume is unknown.
+	Volume       string
+	VolumeNumber int
+	First        string
+	Last         string
+	// Range is "First–Last", or just First for a single chapter.
+	Range string
+	Count int
+}
+
+// DefaultMetadata returns the metadata of books unless configured otherwise.
+func DefaultMetadata() Metadata {
+	return Metadata{
+		Title:       config.TitleTemplate,
+		Author:      config.EpubAuthor,
+		Description: config.EpubDescription,
+		Series:      config.EpubTitle,
+		Language:    config.EpubLanguage,
+	}
+}
+
+// NewTitleData describes chapters for the title templates.
+func NewTitleData(series string, chapters []models.Chapter) TitleData {
+	data := TitleData{Series: series, Count: len(chapters)}
+	if len(chapters) == 0 {
+		return data
+	}
+
+	data.First = strings.TrimSpace(chapters[0].Title)
+	data.Last = strings.TrimSpace(chapters[len(chapters)-1].Title)
+	data.Range = data.First
+	if len(chapters) > 1 {
+		data.Range += "–" + data.Last
+	}
+
+	volumes := scraper.GroupByVolume(chapters)
+	for _, volume := range volumes {
+		if volume.Title == "" {
+			return data
+		}
+	}
+	first, last := volumes[0], volumes[len(volumes)-1]
+	switch {
+	case len(volumes) == 1:
+		data.Volume = first.Title
+		data.VolumeNumber = first.Number
+	case first.Number > 0 && last.Number > 0:
+		data.Volume = fmt.Sprintf("Volumes %d–%d", first.Number, last.Number)
+	default:
+		data.Volume = first.Title + "–" + last.Title
+	}
+	return data
+}
+
+// Render fills in the metadata for a book of chapters: the templates are
+// executed and empty fields that have defaults get them.
+func (m Metadata) Render(chapters []models.Chapter) (Metadata, error) {
+	data := NewTitleData(m.Series, chapters)
+
+	var err error
+	if m.Title, err = executeTemplate("title", m.Title, data); err != nil {
+		return Metadata{}, err
+	}
+	if m.Description, err = executeTemplate("description", m.Description, data); err != nil {
+		return Metadata{}, err
+	}
+
+	if m.SeriesIndex == "" && data.VolumeNumber > 0 {
+		m.SeriesIndex = fmt.Sprint(data.VolumeNumber)
+	}
+	if m.Identifier == "" && len(chapters) > 0 {
+		m.Identifier = stableIdentifier(m.Series, chapters[0], chapters[len(chapters)-1])
+	}
+	if m.Date == "" && len(chapters) > 0 {
+		if published := chapters[len(chapters)-1].Published; !published.IsZero() {
+			m.Date = published.UTC().Format(time.DateOnly)
+		}
+	}
+	if err := checkDate(m.Date); err != nil {
+		return Metadata{}, err
+	}
+	m.Subjects = slices.Clone(m.Subjects)
+	return m, nil
+}
+
+func executeTemplate(name, text string, data TitleData) (string, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("parsing %s template: %w", name, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("executing %s template: %w", name, err)
+	}
+	return strings.Join(strings.Fields(buf.String()), " "), nil
+}
+
+// CheckTemplate reports whether text is a valid title or description
+// template.
+func CheckTemplate(text string) error {
+	_, err := executeTemplate("title", text, TitleData{})
+	return err
+}
+
+func checkDate(date string) error {
+	if date == "" {
+		return nil
+	}
+	if _, err := time.Parse(time.DateOnly, date); err == nil {
+		return nil
+	}
+	if _, err := time.Parse(time.RFC3339, date); err == nil {
+		return nil
+	}
+	return fmt.Errorf("invalid publication date %q, want YYYY-MM-DD", date)
+}
+
+func stableIdentifier(series string, first, last models.Chapter) string {
+	name := strings.Join([]string{series, first.URL, first.Title, last.URL, last.Title}, "\n")
+	return "urn:uuid:" + uuid.NewV5(uuid.NamespaceURL, name).String()
+}
+
+// updated returns the metadata of a book after an update. A value of the
+// book is kept unless it is empty or what m renders to for the chapters the
+// book had before, in which case it is rendered again for all chapters, so
+// generated titles follow the new chapter range. The identifier never
+// changes once the book has one.
+func (m Metadata) updated(book *Book, before, after []models.Chapter) (Metadata, error) {
+	old, err := m.Render(before)
+	if err != nil {
+		return Metadata{}, err
+	}
+	now, err := m.Render(after)
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	pick := func(value, old, now string) string {
+		if value == "" || value == old {
+			return now
+		}
+		return value
+	}
+
+	result := Metadata{
+		Title:       pick(book.Title, old.Title, now.Title),
+		Author:      pick(book.Author, old.Author, now.Author),
+		Description: pick(book.Description, old.Description, now.Description),
+		Series:      pick(book.Series, old.Series, now.Series),
+		SeriesIndex: pick(book.SeriesIndex, old.SeriesIndex, now.SeriesIndex),
+		Language:    pick(book.Language, old.Language, now.Language),
+		Publisher:   pick(book.Publisher, old.Publisher, now.Publisher),
+		Identifier:  pick(book.Identifier, "", now.Identifier),
+		Date:        pick(book.Date, old.Date, now.Date),
+		Subjects:    book.Subjects,
+	}
+	if len(book.Subjects) == 0 || slices.Equal(book.Subjects, old.Subjects) {
+		result.Subjects = now.Subjects
+	}
+	return result, nil
+}
+
+// metadataElements returns the package metadata that go-epub cannot write
+// itself: publisher, subjects, date and the series, both as an EPUB 3
+// collection and in calibre's form.
+func metadataElements(m Metadata) string {
+	var b strings.Builder
+	element := func(open, value, end string) {
+		b.WriteString("    " + open)
+		xml.EscapeText(&b, []byte(value))
+		b.WriteString(end + "\n")
+	}
+
+	if m.Publisher != "" {
+		element("<dc:publisher>", m.Publisher, "</dc:publisher>")
+	}
+	for _, subject := range m.Subjects {
+		element("<dc:subject>", subject, "</dc:subject>")
+	}
+	if m.Date != "" {
+		element("<dc:date>", m.Date, "</dc:date>")
+	}
+	if m.Series != "" {
+		element(`<meta property="belongs-to-collection" id="series">`, m.Series, "</meta>")
+		b.WriteString(`    <meta refines="#series" property="collection-type">series</meta>` + "\n")
+		if m.SeriesIndex != "" {
+			element(`<meta refines="#series" property="group-position">`, m.SeriesIndex, "</meta>")
+		}
+		b.WriteString(`    <meta name="calibre:series" content="` + escapeAttr(m.Series) + `"/>` + "\n")
+		if m.SeriesIndex != "" {
+			b.WriteString(`    <meta name="calibre:series_index" content="` + escapeAttr(m.SeriesIndex) + `"/>` + "\n")
+		}
+	}
+	return b.String()
+}
+
+func escapeAttr(value string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(value))
+	return b.String()
+}
@@ -0,0 +1,221 @@
+package epub
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/linuxswords/wandering-inn/internal/models"
+)
+
+func TestNewTitleData(t *testing.T) {
+	tests := []struct {
+		name     string
+		chapters []models.Chapter
+		want     TitleData
+	}{
+		{
+			name: "one volume",
+			chapters: []models.Chapter{
+				{Title: "8.00", Volume: "Volume 8"},
+				{Title: "8.12", Volume: "Volume 8"},
+			},
+			want: TitleData{Series: "TWI", Volume: "Volume 8", VolumeNumber: 8, First: "8.00", Last: "8.12", Range: "8.00–8.12", Count: 2},
+		},
+		{
+			name: "several volumes",
+			chapters: []models.Chapter{
+				{Title: "3.00", Volume: "Volume 3"},
+				{Title: "5.00", Volume: "Volume 5"},
+			},
+			want: TitleData{Series: "TWI", Volume: "Volumes 3–5", First: "3.00", Last: "5.00", Range: "3.00–5.00", Count: 2},
+		},
+		{
+			name:     "unknown volume",
+			chapters: []models.Chapter{{Title: "1.00"}},
+			want:     TitleData{Series: "TWI", First: "1.00", Last: "1.00", Range: "1.00", Count: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewTitleData("TWI", tt.chapters); got != tt.want {
+				t.Errorf("NewTitleData() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMetadata_Render(t *testing.T) {
+	chapters := []models.Chapter{
+		{Title: "8.00", URL: "https://wanderinginn.com/8-00/", Volume: "Volume 8"},
+		{Title: "8.12", URL: "https://wanderinginn.com/8-12/", Volume: "Volume 8", Published: time.Date(2021, 3, 14, 23, 0, 0, 0, time.UTC)},
+	}
+	metadata := DefaultMetadata()
+	metadata.Title = "{{.Series}} – {{.Volume}} ({{.First}}–{{.Last}})"
+
+	rendered, err := metadata.Render(chapters)
+	if err != nil {
+		t.Fatalf("Render() failed: %v", err)
+	}
+	if rendered.Title != "The Wandering Inn – Volume 8 (8.00–8.12)" {
+		t.Errorf("Title = %q, want the template filled in", rendered.Title)
+	}
+	if rendered.SeriesIndex != "8" {
+		t.Errorf("SeriesIndex = %q, want the volume number", rendered.SeriesIndex)
+	}
+	if rendered.Date != "2021-03-14" {
+		t.Errorf("Date = %q, want the publication date of the last chapter", rendered.Date)
+	}
+	if !strings.HasPrefix(rendered.Identifier, "urn:uuid:") {
+		t.Errorf("Identifier = %q, want a UUID URN", rendered.Identifier)
+	}
+
+	again, err := metadata.Render(chapters)
+	if err != nil {
+		t.Fatalf("Render() failed: %v", err)
+	}
+	if again.Identifier != rendered.Identifier {
+		t.Errorf("Identifier changed between renders of the same chapters: %q, %q", rendered.Identifier, again.Identifier)
+	}
+	shorter, err := metadata.Render(chapters[:1])
+	if err != nil {
+		t.Fatalf("Render() failed: %v", err)
+	}
+	if shorter.Identifier == rendered.Identifier {
+		t.Error("different chapter ranges got the same identifier")
+	}
+
+	for name, broken := range map[string]Metadata{
+		"bad template":   {Title: "{{.Series"},
+		"unknown field":  {Title: "{{.Author}}"},
+		"bad date":       {Title: "x", Date: "14/03/2021"},
+		"bad desc field": {Title: "x", Description: "{{.Nope}}"},
+	} {
+		if _, err := broken.Render(chapters); err == nil {
+			t.Errorf("%s: Render() succeeded, want an error", name)
+		}
+	}
+}
+
+func TestEPUBCreator_CreateEPUB_Metadata(t *testing.T) {
+	creator := NewEPUBCreator()
+	outputPath := filepath.Join(t.TempDir(), "metadata.epub")
+	creator.SetOutputPath(outputPath)
+	creator.SetMetadata(Metadata{
+		Title:       "{{.Series}} {{.Volume}}",
+		Author:      "pirateaba",
+		Description: "Chapters {{.Range}} & more",
+		Series:      "The Wandering Inn",
+		Language:    "de",
+		Publisher:   "Self <published>",
+		Subjects:    []string{"Fantasy", "LitRPG"},
+		Identifier:  "urn:isbn:0000000000",
+		Date:        "2022-01-01",
+	})
+
+	chapters := []models.Chapter{
+		{Title: "2.00", URL: "url1", Volume: "Volume 2"},
+		{Title: "2.01", URL: "url2", Volume: "Volume 2"},
+	}
+	if err := creator.CreateEPUB(chapters, &mockChapterContentFetcher{}); err != nil {
+		t.Fatalf("CreateEPUB() failed: %v", err)
+	}
+
+	book, err := ReadEPUB(outputPath)
+	if err != nil {
+		t.Fatalf("ReadEPUB() failed: %v", err)
+	}
+
+	want := Book{
+		Title:       "The Wandering Inn Volume 2",
+		Author:      "pirateaba",
+		Description: "Chapters 2.00–2.01 & more",
+		Series:      "The Wandering Inn",
+		SeriesIndex: "2",
+		Language:    "de",
+		Publisher:   "Self <published>",
+		Identifier:  "urn:isbn:0000000000",
+		Date:        "2022-01-01",
+	}
+	got := Book{
+		Title:       book.Title,
+		Author:      book.Author,
+		Description: book.Description,
+		Series:      book.Series,
+		SeriesIndex: book.SeriesIndex,
+		Language:    book.Language,
+		Publisher:   book.Publisher,
+		Identifier:  book.Identifier,
+		Date:        book.Date,
+	}
+	if got.Title != want.Title || got.Author != want.Author || got.Description != want.Description ||
+		got.Series != want.Series || got.SeriesIndex != want.SeriesIndex || got.Language != want.Language ||
+		got.Publisher != want.Publisher || got.Identifier != want.Identifier || got.Date != want.Date {
+		t.Errorf("metadata = %+v, want %+v", got, want)
+	}
+	if !slices.Equal(book.Subjects, []string{"Fantasy", "LitRPG"}) {
+		t.Errorf("Subjects = %v, want [Fantasy LitRPG]", book.Subjects)
+	}
+
+	opf := readZipEntries(t, outputPath)["EPUB/package.opf"]
+	if !strings.Contains(opf, `<meta name="calibre:series" content="The Wandering Inn"/>`) ||
+		!strings.Contains(opf, `<meta name="calibre:series_index" content="2"/>`) {
+		t.Error("package document has no calibre series metadata")
+	}
+}
+
+func TestEPUBCreator_UpdateEPUB_Metadata(t *testing.T) {
+	tests := []struct {
+		name      string
+		title     string
+		wantTitle string
+	}{
+		{name: "generated title follows the range", wantTitle: "The Wandering Inn – Volume 1 (1.00–1.02)"},
+		{name: "custom title is kept", title: "My Book", wantTitle: "My Book"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chapters := []models.Chapter{
+				{Title: "1.00", URL: "url1", Volume: "Volume 1"},
+				{Title: "1.01", URL: "url2", Volume: "Volume 1"},
+				{Title: "1.02", URL: "url3", Volume: "Volume 1"},
+			}
+			outputPath := filepath.Join(t.TempDir(), "book.epub")
+			creator := NewEPUBCreator()
+			creator.SetOutputPath(outputPath)
+			if tt.title != "" {
+				metadata := DefaultMetadata()
+				metadata.Title = tt.title
+				creator.SetMetadata(metadata)
+			}
+			if err := creator.CreateEPUB(chapters[:2], &mockChapterContentFetcher{}); err != nil {
+				t.Fatalf("CreateEPUB() failed: %v", err)
+			}
+
+			book, err := ReadEPUB(outputPath)
+			if err != nil {
+				t.Fatalf("ReadEPUB() failed: %v", err)
+			}
+			book.MatchSources(chapters)
+
+			if err := NewEPUBCreator().UpdateEPUB(book, chapters[2:], &mockChapterContentFetcher{}); err != nil {
+				t.Fatalf("UpdateEPUB() failed: %v", err)
+			}
+
+			updated, err := ReadEPUB(outputPath)
+			if err != nil {
+				t.Fatalf("ReadEPUB() of updated book failed: %v", err)
+			}
+			if updated.Title != tt.wantTitle {
+				t.Errorf("Title = %q, want %q", updated.Title, tt.wantTitle)
+			}
+			if updated.Identifier != book.Identifier {
+				t.Errorf("Identifier changed from %q to %q", book.Identifier, updated.Identifier)
+			}
+		})
+	}
+}
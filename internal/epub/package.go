@@ -0,0 +1,143 @@
+package epub
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sourceProperty is the metadata property that records, for each section,
+// the page it was downloaded from. It refines the section's manifest item.
+const sourceProperty = "dcterms:source"
+
+type sectionSource struct {
+	section string
+	url     string
+}
+
+// sourceElements returns the metadata storing the source URL of each
+// section.
+func sourceElements(sources []sectionSource) string {
+	var metas strings.Builder
+	for _, source := range sources {
+		metas.WriteString(`    <meta refines="#`)
+		xml.EscapeText(&metas, []byte(source.section))
+		metas.WriteString(`" property="` + sourceProperty + `">`)
+		xml.EscapeText(&metas, []byte(source.url))
+		metas.WriteString("</meta>\n")
+	}
+	return metas.String()
+}
+
+// writeMetadata adds raw metadata elements to the package document of the
+// EPUB at filename.
+func writeMetadata(filename, elements string) error {
+	if elements == "" {
+		return nil
+	}
+
+	return patchPackage(filename, func(opf []byte) ([]byte, error) {
+		return insertMetadata(opf, elements)
+	})
+}
+
+// insertMetadata adds raw elements at the end of the package's <metadata>.
+func insertMetadata(opf []byte, elements string) ([]byte, error) {
+	end := bytes.LastIndex(opf, []byte("</metadata>"))
+	if end == -1 {
+		return nil, fmt.Errorf("package document has no metadata")
+	}
+
+	var patched bytes.Buffer
+	patched.Write(opf[:end])
+	patched.WriteString(strings.TrimLeft(elements, " "))
+	patched.WriteString("  ")
+	patched.Write(opf[end:])
+	return patched.Bytes(), nil
+}
+
+// patchPackage rewrites the package document of the EPUB at filename with
+// patch. All other entries are copied unchanged and in order, so the stored
+// mimetype entry stays first.
+func patchPackage(filename string, patch func(opf []byte) ([]byte, error)) error {
+	r, err := zip.OpenReader(filename)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	files := make(map[string]*zip.File, len(r.File))
+	for _, f := range r.File {
+		files[f.Name] = f
+	}
+	var container containerXML
+	if err := decodeZipXML(files, "META-INF/container.xml", &container); err != nil {
+		return err
+	}
+	if len(container.Rootfiles) == 0 {
+		return fmt.Errorf("%s: no package document in container.xml", filename)
+	}
+	pkgPath := container.Rootfiles[0].FullPath
+
+	tmp, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := zip.NewWriter(tmp)
+	for _, f := range r.File {
+		if f.Name != pkgPath {
+			if err := w.Copy(f); err != nil {
+				tmp.Close()
+				return err
+			}
+			continue
+		}
+
+		if err := writePatched(w, f, patch); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	r.Close()
+	return os.Rename(tmp.Name(), filename)
+}
+
+func writePatched(w *zip.Writer, f *zip.File, patch func([]byte) ([]byte, error)) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	opf, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		return err
+	}
+
+	opf, err = patch(opf)
+	if err != nil {
+		return fmt.Errorf("patching %s: %w", f.Name, err)
+	}
+
+	header := f.FileHeader
+	out, err := w.CreateHeader(&header)
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(opf)
+	return err
+}
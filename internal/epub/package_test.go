@@ -0,0 +1,70 @@
+package epub
+
+import (
+	"archive/zip"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/linuxswords/wandering-inn/internal/models"
+)
+
+func TestPatchPackage_KeepsContainerValid(t *testing.T) {
+	filename := createTestBook(t, []models.Chapter{{Title: "1.00", URL: "https://wanderinginn.com/1-00/"}})
+
+	err := patchPackage(filename, func(opf []byte) ([]byte, error) {
+		return insertMetadata(opf, `<meta property="test:marker">patched</meta>`+"\n")
+	})
+	if err != nil {
+		t.Fatalf("patchPackage() failed: %v", err)
+	}
+
+	r, err := zip.OpenReader(filename)
+	if err != nil {
+		t.Fatalf("patched EPUB is not a valid zip: %v", err)
+	}
+	defer r.Close()
+
+	first := r.File[0]
+	if first.Name != "mimetype" || first.Method != zip.Store {
+		t.Errorf("first entry = %s (method %d), want the stored mimetype", first.Name, first.Method)
+	}
+
+	entries := readZipEntries(t, filename)
+	if !strings.Contains(entries["EPUB/package.opf"], `<meta property="test:marker">patched</meta>`) {
+		t.Error("package document was not patched")
+	}
+
+	book, err := ReadEPUB(filename)
+	if err != nil {
+		t.Fatalf("ReadEPUB() of patched book failed: %v", err)
+	}
+	if len(book.Sections) != 1 || book.Sections[0].URL != "https://wanderinginn.com/1-00/" {
+		t.Errorf("patched book sections = %+v, want the chapter with its source", book.Sections)
+	}
+}
+
+func TestInsertMetadata_NoMetadata(t *testing.T) {
+	if _, err := insertMetadata([]byte("<package></package>"), "<meta/>"); err == nil {
+		t.Error("insertMetadata() without <metadata> expected error")
+	}
+}
+
+func TestWriteSources_EscapesURLs(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "book.epub")
+	creator := NewEPUBCreator()
+	creator.SetOutputPath(filename)
+
+	url := "https://wanderinginn.com/?p=1&chapter=<1>"
+	if err := creator.CreateEPUB([]models.Chapter{{Title: "1.00", URL: url}}, &mockChapterContentFetcher{}); err != nil {
+		t.Fatalf("CreateEPUB() failed: %v", err)
+	}
+
+	book, err := ReadEPUB(filename)
+	if err != nil {
+		t.Fatalf("ReadEPUB() failed: %v", err)
+	}
+	if book.Sections[0].URL != url {
+		t.Errorf("section URL = %q, want %q", book.Sections[0].URL, url)
+	}
+}
@@ -0,0 +1,294 @@
+package epub
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/linuxswords/wandering-inn/internal/models"
+)
+
+type Book struct {
+	Path        string
+	Title       string
+	Author      string
+	Identifier  string
+	Language    string
+	Description string
+	Publisher   string
+	Subjects    []string
+	Date        string
+	Series      string
+	SeriesIndex string
+	Modified    string
+	Sections    []Section
+	Images      []Image
+	Cover       *Image
+}
+
+type Section struct {
+	Title string
+	Href  string
+	Body  string
+	// URL is the page the section was downloaded from, if the book records it.
+	URL string
+	// Volume and Book are filled in by MatchSources from the table of
+	// contents.
+	Volume string
+	Book   string
+
+	// position is one more than the index of the section's chapter in the
+	// table of contents, as found by MatchSources, or zero if unknown.
+	position int
+}
+
+// Image is an image file of a book, with its path relative to the package
+// document.
+type Image struct {
+	Href string
+	Data []byte
+}
+
+// go-epub puts the page showing the cover in the reading order under this
+// name. It is not a chapter.
+const coverSectionFilename = "cover.xhtml"
+
+// titlePagePattern matches the title pages of volumes and books.
+var titlePagePattern = regexp.MustCompile(`^(volume|book)\d{4}\.xhtml$`)
+
+type containerXML struct {
+	Rootfiles []struct {
+		FullPath string `xml:"full-path,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+type packageXML struct {
+	Metadata struct {
+		Title       string   `xml:"title"`
+		Creator     string   `xml:"creator"`
+		Identifier  string   `xml:"identifier"`
+		Language    string   `xml:"language"`
+		Description string   `xml:"description"`
+		Publisher   string   `xml:"publisher"`
+		Subjects    []string `xml:"subject"`
+		Date        string   `xml:"date"`
+		Meta        []struct {
+			ID       string `xml:"id,attr"`
+			Property string `xml:"property,attr"`
+			Refines  string `xml:"refines,attr"`
+			Name     string `xml:"name,attr"`
+			Content  string `xml:"content,attr"`
+			Value    string `xml:",chardata"`
+		} `xml:"meta"`
+	} `xml:"metadata"`
+	Manifest []struct {
+		ID         string `xml:"id,attr"`
+		Href       string `xml:"href,attr"`
+		MediaType  string `xml:"media-type,attr"`
+		Properties string `xml:"properties,attr"`
+	} `xml:"manifest>item"`
+	Spine []struct {
+		IDRef string `xml:"idref,attr"`
+	} `xml:"spine>itemref"`
+}
+
+type sectionXML struct {
+	Title string `xml:"head>title"`
+	Body  struct {
+		Inner string `xml:",innerxml"`
+	} `xml:"body"`
+}
+
+// ReadEPUB opens an EPUB file and returns its metadata and the sections of its
+// reading order.
+func ReadEPUB(filename string) (*Book, error) {
+	r, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	files := make(map[string]*zip.File, len(r.File))
+	for _, f := range r.File {
+		files[f.Name] = f
+	}
+
+	var container containerXML
+	if err := decodeZipXML(files, "META-INF/container.xml", &container); err != nil {
+		return nil, err
+	}
+	if len(container.Rootfiles) == 0 {
+		return nil, fmt.Errorf("%s: no package document in container.xml", filename)
+	}
+
+	pkgPath := container.Rootfiles[0].FullPath
+	var pkg packageXML
+	if err := decodeZipXML(files, pkgPath, &pkg); err != nil {
+		return nil, err
+	}
+
+	book := &Book{
+		Path:        filename,
+		Title:       strings.TrimSpace(pkg.Metadata.Title),
+		Author:      strings.TrimSpace(pkg.Metadata.Creator),
+		Identifier:  strings.TrimSpace(pkg.Metadata.Identifier),
+		Language:    strings.TrimSpace(pkg.Metadata.Language),
+		Description: strings.TrimSpace(pkg.Metadata.Description),
+		Publisher:   strings.TrimSpace(pkg.Metadata.Publisher),
+		Date:        strings.TrimSpace(pkg.Metadata.Date),
+	}
+	for _, subject := range pkg.Metadata.Subjects {
+		book.Subjects = append(book.Subjects, strings.TrimSpace(subject))
+	}
+
+	sources := make(map[string]string)
+	seriesID := ""
+	for _, meta := range pkg.Metadata.Meta {
+		value := strings.TrimSpace(meta.Value)
+		switch {
+		case meta.Property == "dcterms:modified" && meta.Refines == "":
+			book.Modified = value
+		case meta.Property == sourceProperty && strings.HasPrefix(meta.Refines, "#"):
+			sources[strings.TrimPrefix(meta.Refines, "#")] = value
+		case meta.Property == "belongs-to-collection" && book.Series == "":
+			book.Series, seriesID = value, meta.ID
+		case meta.Name == "calibre:series" && book.Series == "":
+			book.Series = strings.TrimSpace(meta.Content)
+		case meta.Name == "calibre:series_index" && book.SeriesIndex == "":
+			book.SeriesIndex = strings.TrimSpace(meta.Content)
+		}
+	}
+	for _, meta := range pkg.Metadata.Meta {
+		if meta.Property == "group-position" && seriesID != "" && meta.Refines == "#"+seriesID {
+			book.SeriesIndex = strings.TrimSpace(meta.Value)
+		}
+	}
+
+	baseDir := path.Dir(pkgPath)
+	hrefs := make(map[string]string, len(pkg.Manifest))
+	for _, item := range pkg.Manifest {
+		switch {
+		case item.MediaType == "application/xhtml+xml" && !strings.Contains(item.Properties, "nav"):
+			hrefs[item.ID] = item.Href
+		case strings.HasPrefix(item.MediaType, "image/"):
+			data, err := readZipFile(files, path.Join(baseDir, item.Href))
+			if err != nil {
+				return nil, err
+			}
+			if strings.Contains(item.Properties, "cover-image") {
+				book.Cover = &Image{Href: item.Href, Data: data}
+			} else {
+				book.Images = append(book.Images, Image{Href: item.Href, Data: data})
+			}
+		}
+	}
+
+	for _, itemref := range pkg.Spine {
+		href, ok := hrefs[itemref.IDRef]
+		if !ok || path.Base(href) == coverSectionFilename || titlePagePattern.MatchString(path.Base(href)) {
+			continue
+		}
+
+		var section sectionXML
+		if err := decodeZipXML(files, path.Join(baseDir, href), &section); err != nil {
+			return nil, err
+		}
+
+		book.Sections = append(book.Sections, Section{
+			Title: strings.TrimSpace(section.Title),
+			Href:  href,
+			Body:  strings.TrimSpace(section.Body.Inner),
+			URL:   sources[itemref.IDRef],
+		})
+	}
+
+	return book, nil
+}
+
+// MatchSources fills in the source URL of sections without one from the
+// chapter of the table of contents with the same title, so books made before
+// sources were recorded get them on their next update. The volume of every
+// section found in the table of contents is filled in as well.
+func (b *Book) MatchSources(toc []models.Chapter) {
+	for i := range b.Sections {
+		for _, chapter := range toc {
+			if b.Sections[i].matches(chapter) {
+				if b.Sections[i].URL == "" {
+					b.Sections[i].URL = chapter.URL
+				}
+				b.Sections[i].Volume = chapter.Volume
+				b.Sections[i].Book = chapter.Book
+				b.Sections[i].position = chapter.Index + 1
+				break
+			}
+		}
+	}
+}
+
+// chapters returns the sections of the book as chapters.
+func (b *Book) chapters() []models.Chapter {
+	chapters := make([]models.Chapter, len(b.Sections))
+	for i, section := range b.Sections {
+		chapters[i] = models.Chapter{Title: section.Title, URL: section.URL, Index: i, Volume: section.Volume, Book: section.Book}
+	}
+	return chapters
+}
+
+// contains reports whether any section of the book holds chapter.
+func (b *Book) contains(chapter models.Chapter) bool {
+	for _, section := range b.Sections {
+		if section.matches(chapter) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether the section holds chapter, by source URL if the
+// section has one and by title otherwise.
+func (s Section) matches(chapter models.Chapter) bool {
+	if s.URL != "" {
+		return strings.TrimSuffix(s.URL, "/") == strings.TrimSuffix(chapter.URL, "/")
+	}
+	return strings.EqualFold(strings.TrimSpace(chapter.Title), s.Title)
+}
+
+func readZipFile(files map[string]*zip.File, name string) ([]byte, error) {
+	f, ok := files[name]
+	if !ok {
+		return nil, fmt.Errorf("missing %s in EPUB", name)
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+func decodeZipXML(files map[string]*zip.File, name string, v interface{}) error {
+	f, ok := files[name]
+	if !ok {
+		return fmt.Errorf("missing %s in EPUB", name)
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	decoder := xml.NewDecoder(rc)
+	decoder.Strict = false
+	decoder.Entity = xml.HTMLEntity
+
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("parsing %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,256 @@
+package epub
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/linuxswords/wandering-inn/internal/config"
+	"github.com/linuxswords/wandering-inn/internal/models"
+)
+
+func createTestBook(t *testing.T, chapters []models.Chapter) string {
+	t.Helper()
+
+	filename := filepath.Join(t.TempDir(), "book.epub")
+	creator := NewEPUBCreator()
+	creator.SetOutputPath(filename)
+
+	fetcher := &mockChapterContentFetcher{}
+	if err := creator.CreateEPUB(chapters, fetcher); err != nil {
+		t.Fatalf("CreateEPUB() failed: %v", err)
+	}
+	return filename
+}
+
+func TestReadEPUB(t *testing.T) {
+	chapters := []models.Chapter{
+		{Title: "1.00", URL: "url1", Index: 0},
+		{Title: "Interlude - Pawn", URL: "url2", Index: 1},
+	}
+	filename := createTestBook(t, chapters)
+
+	book, err := ReadEPUB(filename)
+	if err != nil {
+		t.Fatalf("ReadEPUB() failed: %v", err)
+	}
+
+	if book.Path != filename {
+		t.Errorf("Path = %q, want %q", book.Path, filename)
+	}
+	if want := config.EpubTitle + " (1.00–Interlude - Pawn)"; book.Title != want {
+		t.Errorf("Title = %q, want %q", book.Title, want)
+	}
+	if book.Series != config.EpubTitle {
+		t.Errorf("Series = %q, want %q", book.Series, config.EpubTitle)
+	}
+	if book.Author != config.EpubAuthor {
+		t.Errorf("Author = %q, want %q", book.Author, config.EpubAuthor)
+	}
+	if book.Identifier == "" {
+		t.Error("Identifier is empty")
+	}
+	if book.Modified == "" {
+		t.Error("Modified is empty")
+	}
+
+	if len(book.Sections) != len(chapters) {
+		t.Fatalf("got %d sections, want %d", len(book.Sections), len(chapters))
+	}
+	for i, chapter := range chapters {
+		section := book.Sections[i]
+		if section.Title != chapter.Title {
+			t.Errorf("section %d title = %q, want %q", i, section.Title, chapter.Title)
+		}
+		if !strings.Contains(section.Body, "Default chapter content for "+chapter.Title) {
+			t.Errorf("section %d body = %q, missing chapter content", i, section.Body)
+		}
+		if section.URL != chapter.URL {
+			t.Errorf("section %d URL = %q, want %q", i, section.URL, chapter.URL)
+		}
+	}
+}
+
+func TestReadEPUB_MissingFile(t *testing.T) {
+	if _, err := ReadEPUB(filepath.Join(t.TempDir(), "missing.epub")); err == nil {
+		t.Error("ReadEPUB() on missing file expected error")
+	}
+}
+
+func TestEPUBCreator_UpdateEPUB(t *testing.T) {
+	filename := createTestBook(t, []models.Chapter{
+		{Title: "1.00", URL: "url1", Index: 0},
+	})
+
+	book, err := ReadEPUB(filename)
+	if err != nil {
+		t.Fatalf("ReadEPUB() failed: %v", err)
+	}
+
+	// Book timestamps have second precision
+	time.Sleep(time.Second)
+	before := time.Now().UTC().Truncate(time.Second)
+
+	creator := NewEPUBCreator()
+	err = creator.UpdateEPUB(book, []models.Chapter{
+		{Title: "1.01", URL: "url2", Index: 1},
+	}, &mockChapterContentFetcher{})
+	if err != nil {
+		t.Fatalf("UpdateEPUB() failed: %v", err)
+	}
+
+	updated, err := ReadEPUB(filename)
+	if err != nil {
+		t.Fatalf("ReadEPUB() of updated book failed: %v", err)
+	}
+
+	if updated.Identifier != book.Identifier {
+		t.Errorf("Identifier changed from %q to %q", book.Identifier, updated.Identifier)
+	}
+
+	modified, err := time.Parse(time.RFC3339, updated.Modified)
+	if err != nil {
+		t.Fatalf("Modified = %q is not a timestamp: %v", updated.Modified, err)
+	}
+	if modified.Before(before) || updated.Modified == book.Modified {
+		t.Errorf("Modified = %q, want the time of the update (original %q)", updated.Modified, book.Modified)
+	}
+
+	var titles, urls []string
+	for _, section := range updated.Sections {
+		titles = append(titles, section.Title)
+		urls = append(urls, section.URL)
+	}
+	if strings.Join(titles, ",") != "1.00,1.01" {
+		t.Errorf("section titles = %v, want [1.00 1.01]", titles)
+	}
+	if strings.Join(urls, ",") != "url1,url2" {
+		t.Errorf("section URLs = %v, want [url1 url2]", urls)
+	}
+}
+
+func TestEPUBCreator_UpdateEPUB_FillsGaps(t *testing.T) {
+	toc := []models.Chapter{
+		{Title: "1.00", URL: "url1", Index: 0},
+		{Title: "1.01", URL: "url2", Index: 1},
+		{Title: "1.02", URL: "url3", Index: 2},
+		{Title: "1.03", URL: "url4", Index: 3},
+	}
+	// 1.01 failed to download when the book was made
+	filename := createTestBook(t, []models.Chapter{toc[0], toc[2]})
+
+	book, err := ReadEPUB(filename)
+	if err != nil {
+		t.Fatalf("ReadEPUB() failed: %v", err)
+	}
+	book.MatchSources(toc)
+	missing, err := NewChapters(book, toc)
+	if err != nil {
+		t.Fatalf("NewChapters() failed: %v", err)
+	}
+
+	if err := NewEPUBCreator().UpdateEPUB(book, missing, &mockChapterContentFetcher{}); err != nil {
+		t.Fatalf("UpdateEPUB() failed: %v", err)
+	}
+
+	updated, err := ReadEPUB(filename)
+	if err != nil {
+		t.Fatalf("ReadEPUB() of updated book failed: %v", err)
+	}
+	var titles []string
+	for _, section := range updated.Sections {
+		titles = append(titles, section.Title)
+	}
+	if strings.Join(titles, ",") != "1.00,1.01,1.02,1.03" {
+		t.Errorf("section titles = %v, want [1.00 1.01 1.02 1.03]", titles)
+	}
+}
+
+func TestBook_MatchSources(t *testing.T) {
+	toc := []models.Chapter{
+		{Title: "1.00", URL: "https://wanderinginn.com/2016/07/27/1-00/"},
+		{Title: "1.01", URL: "https://wanderinginn.com/2016/07/27/1-01/"},
+	}
+	book := &Book{Sections: []Section{
+		{Title: "1.00"},
+		{Title: "1.01 (renamed)", URL: "https://wanderinginn.com/2016/07/27/1-01/"},
+		{Title: "Author's note"},
+	}}
+
+	book.MatchSources(toc)
+
+	expected := []string{toc[0].URL, toc[1].URL, ""}
+	for i, section := range book.Sections {
+		if section.URL != expected[i] {
+			t.Errorf("section %d URL = %q, want %q", i, section.URL, expected[i])
+		}
+	}
+}
+
+func TestNewChapters(t *testing.T) {
+	toc := []models.Chapter{
+		{Title: "1.00", URL: "https://wanderinginn.com/1-00/", Index: 0},
+		{Title: "1.01", URL: "https://wanderinginn.com/1-01/", Index: 1},
+		{Title: "1.02", URL: "https://wanderinginn.com/1-02/", Index: 2},
+		{Title: "1.03", URL: "https://wanderinginn.com/1-03/", Index: 3},
+	}
+
+	tests := []struct {
+		name        string
+		sections    []Section
+		expected    []string
+		expectError bool
+	}{
+		{name: "chapters after last section", sections: []Section{{Title: "1.00"}, {Title: "1.01"}}, expected: []string{"1.02", "1.03"}},
+		{name: "up to date", sections: []Section{{Title: "1.02"}, {Title: "1.03"}}, expected: nil},
+		{name: "gap in the middle", sections: []Section{{Title: "1.00"}, {Title: "1.02"}}, expected: []string{"1.01", "1.03"}},
+		{
+			name:     "gap by source URL",
+			sections: []Section{{Title: "1.01", URL: "https://wanderinginn.com/1-01/"}, {Title: "1.03", URL: "https://wanderinginn.com/1-03/"}},
+			expected: []string{"1.02"},
+		},
+		{name: "case insensitive titles", sections: []Section{{Title: "1.02"}}, expected: []string{"1.03"}},
+		{name: "no matching sections", sections: []Section{{Title: "Cover"}, {Title: "Afterword"}}, expectError: true},
+		{
+			name:     "source URL wins over a renamed title",
+			sections: []Section{{Title: "1.01 - Old name", URL: "https://wanderinginn.com/1-01/"}},
+			expected: []string{"1.02", "1.03"},
+		},
+		{
+			name:     "source URL without trailing slash",
+			sections: []Section{{Title: "1.02", URL: "https://wanderinginn.com/1-02"}},
+			expected: []string{"1.03"},
+		},
+		{
+			name:     "title is ignored when the source URL differs",
+			sections: []Section{{Title: "1.03", URL: "https://wanderinginn.com/1-00/"}},
+			expected: []string{"1.01", "1.02", "1.03"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			book := &Book{Path: "book.epub", Sections: tt.sections}
+
+			result, err := NewChapters(book, toc)
+			if tt.expectError {
+				if err == nil {
+					t.Error("NewChapters() expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewChapters() unexpected error: %v", err)
+			}
+
+			var titles []string
+			for _, chapter := range result {
+				titles = append(titles, chapter.Title)
+			}
+			if strings.Join(titles, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("NewChapters() = %v, want %v", titles, tt.expected)
+			}
+		})
+	}
+}
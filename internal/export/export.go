@@ -0,0 +1,250 @@
+// Package export writes chapters in formats other than EPUB.
+package export
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/linuxswords/wandering-inn/internal/config"
+	"github.com/linuxswords/wandering-inn/internal/epub"
+	"github.com/linuxswords/wandering-inn/internal/models"
+	"github.com/linuxswords/wandering-inn/internal/scraper"
+	"github.com/linuxswords/wandering-inn/pkg/utils"
+)
+
+// Chapter is a downloaded chapter.
+type Chapter struct {
+	models.Chapter
+	// Content is the chapter HTML from the scraper, starting with the title
+	// as <h1>.
+	Content   string
+	FetchedAt time.Time
+}
+
+// Document is what a renderer writes: the chapters of one output file, and
+// the metadata of the whole export.
+type Document struct {
+	Metadata epub.Metadata
+	Chapters []Chapter
+}
+
+// Renderer writes documents in one output format.
+type Renderer interface {
+	// Ext is the file name extension of the format, without the dot.
+	Ext() string
+	// Render writes doc to w. Renderers that download more, such as images,
+	// stop when ctx is done.
+	Render(ctx context.Context, w io.Writer, doc Document) error
+}
+
+// Exporter downloads chapters and writes them with a Renderer, either into
+// one file or into one file per chapter.
+type Exporter struct {
+	renderer         Renderer
+	progressCallback func(current, total int, title string)
+	outputPath       string
+	outputDir        string
+	filenameTemplate string
+	collision        utils.CollisionPolicy
+	split            bool
+	concurrency      int
+	manifest         *epub.Manifest
+	metadata         epub.Metadata
+}
+
+func NewExporter(renderer Renderer) *Exporter {
+	return &Exporter{
+		renderer:         renderer,
+		filenameTemplate: config.FilenameTemplate,
+		collision:        utils.CollisionOverwrite,
+		concurrency:      1,
+		metadata:         epub.DefaultMetadata(),
+	}
+}
+
+func (e *Exporter) SetProgressCallback(callback func(current, total int, title string)) {
+	e.progressCallback = callback
+}
+
+// SetOutputPath sets the file to write. It is ignored when writing one file
+// per chapter.
+func (e *Exporter) SetOutputPath(path string) {
+	e.outputPath = path
+}
+
+// SetOutputDir sets the directory that files without an output path are
+// written to. The default is the current directory.
+func (e *Exporter) SetOutputDir(dir string) {
+	e.outputDir = dir
+}
+
+// SetFilenameTemplate sets how files without an output path are named; see
+// utils.GenerateFilename. With one file per chapter, each file is named as if
+// it held only its chapter.
+func (e *Exporter) SetFilenameTemplate(template string) {
+	e.filenameTemplate = template
+}
+
+// SetCollisionPolicy sets what happens when a generated file name is taken.
+// The default overwrites the existing file.
+func (e *Exporter) SetCollisionPolicy(policy utils.CollisionPolicy) {
+	e.collision = policy
+}
+
+// SetSplit makes the exporter write one file per chapter instead of one
+// file for all of them.
+func (e *Exporter) SetSplit(split bool) {
+	e.split = split
+}
+
+// SetConcurrency sets how many chapters are downloaded in parallel.
+func (e *Exporter) SetConcurrency(n int) {
+	e.concurrency = max(1, n)
+}
+
+// SetManifest makes the exporter record its progress in manifest and reuse
+// the chapters already downloaded there, like EPUBCreator.SetManifest.
+func (e *Exporter) SetManifest(manifest *epub.Manifest) {
+	e.manifest = manifest
+}
+
+// SetMetadata sets the metadata of the export; formats that have a title or
+// front matter use it.
+func (e *Exporter) SetMetadata(metadata epub.Metadata) {
+	e.metadata = metadata
+}
+
+// Export downloads the chapters and writes them.
+func (e *Exporter) Export(chapters []models.Chapter, fetcher epub.ChapterContentFetcher) error {
+	return e.ExportContext(context.Background(), chapters, fetcher)
+}
+
+// ExportContext downloads the chapters and writes them. Chapters that fail to
+// download are left out with a warning. When ctx is done, the chapters
+// completed up to that point are written and an error wrapping ctx.Err() is
+// returned.
+func (e *Exporter) ExportContext(ctx context.Context, chapters []models.Chapter, fetcher epub.ChapterContentFetcher) error {
+	if e.manifest != nil {
+		fetcher = e.manifest.Fetcher(fetcher)
+	}
+
+	added := e.fetch(ctx, chapters, fetcher)
+	if ctx.Err() != nil && len(added) == 0 {
+		return fmt.Errorf("interrupted before any chapter was downloaded: %w", ctx.Err())
+	}
+
+	named := chapters
+	if ctx.Err() != nil {
+		named = make([]models.Chapter, len(added))
+		for i, chapter := range added {
+			named[i] = chapter.Chapter
+		}
+	}
+	metadata, err := e.metadata.Render(named)
+	if err != nil {
+		return err
+	}
+
+	var written []string
+	if e.split {
+		for _, chapter := range added {
+			filename, err := e.write(ctx, Document{Metadata: metadata, Chapters: []Chapter{chapter}}, "")
+			if err != nil {
+				return err
+			}
+			written = append(written, filename)
+		}
+	} else {
+		filename, err := e.write(ctx, Document{Metadata: metadata, Chapters: added}, e.outputPath)
+		if err != nil {
+			return err
+		}
+		written = append(written, filename)
+	}
+
+	if ctx.Err() != nil {
+		return fmt.Errorf("interrupted after %d of %d chapters, partial export written: %w", len(added), len(chapters), ctx.Err())
+	}
+	switch len(written) {
+	case 0:
+		fmt.Println("No chapters to export")
+	case 1:
+		fmt.Printf("Export created successfully: %s\n", written[0])
+	default:
+		fmt.Printf("Export created successfully: %d files in %s\n", len(written), filepath.Dir(written[0]))
+	}
+
+	// Chapters that can never be downloaded do not keep the build unfinished
+	if e.manifest != nil && len(e.manifest.Pending()) == 0 {
+		return e.manifest.Remove()
+	}
+	return nil
+}
+
+// fetch downloads the chapters in order. When ctx is done, it stops at the
+// first chapter that did not finish so the export never has gaps.
+func (e *Exporter) fetch(ctx context.Context, chapters []models.Chapter, fetcher epub.ChapterContentFetcher) []Chapter {
+	results := scraper.FetchChapters(ctx, fetcher, chapters, e.concurrency, e.progressCallback)
+
+	var added []Chapter
+	failed := 0
+	for _, result := range results {
+		if ctx.Err() != nil && errors.Is(result.Err, ctx.Err()) {
+			break
+		}
+		if result.Err != nil {
+			fmt.Printf("Warning: Failed to fetch chapter %s: %v\n", result.Chapter.Title, result.Err)
+			failed++
+			continue
+		}
+		added = append(added, Chapter{Chapter: result.Chapter, Content: result.Content, FetchedAt: time.Now()})
+	}
+
+	if failed > 0 {
+		fmt.Printf("Warning: %d of %d chapters could not be fetched and were left out\n", failed, len(chapters))
+	}
+	return added
+}
+
+// write renders doc into filename, or into a file named from the template
+// if filename is empty, and returns the name of the file.
+func (e *Exporter) write(ctx context.Context, doc Document, filename string) (string, error) {
+	if filename == "" {
+		chapters := make([]models.Chapter, len(doc.Chapters))
+		for i, chapter := range doc.Chapters {
+			chapters[i] = chapter.Chapter
+		}
+		name, err := utils.GenerateFilename(e.filenameTemplate, utils.FilenameData{
+			Series:   doc.Metadata.Series,
+			Chapters: chapters,
+			Date:     time.Now(),
+			Ext:      e.renderer.Ext(),
+		})
+		if err != nil {
+			return "", err
+		}
+
+		filename = filepath.Join(e.outputDir, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			return "", fmt.Errorf("creating output directory: %w", err)
+		}
+		if filename, err = utils.ResolveCollision(filename, e.collision); err != nil {
+			return "", err
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := e.renderer.Render(ctx, &buf, doc); err != nil {
+		return "", fmt.Errorf("rendering %s: %w", filename, err)
+	}
+	if err := os.WriteFile(filename, buf.Bytes(), 0644); err != nil {
+		return "", err
+	}
+	return filename, nil
+}
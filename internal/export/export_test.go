@@ -0,0 +1,95 @@
+package export
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/linuxswords/wandering-inn/internal/models"
+)
+
+type mockFetcher struct {
+	errors map[string]error
+}
+
+func (m *mockFetcher) FetchChapterContent(url, title string) (string, error) {
+	if err, exists := m.errors[url]; exists {
+		return "", err
+	}
+	return "<h1>" + title + "</h1><p>Content of " + title + "</p>", nil
+}
+
+func TestExporter_Export(t *testing.T) {
+	chapters := []models.Chapter{
+		{Title: "1.00", URL: "url0", Index: 0},
+		{Title: "1.01", URL: "url1", Index: 1},
+		{Title: "1.02", URL: "url2", Index: 2},
+	}
+
+	tests := []struct {
+		name  string
+		split bool
+		// files maps the names of the written files to the chapter titles
+		// they contain
+		files map[string]string
+	}{
+		{name: "combined", files: map[string]string{"wandering_inn_1.00-1.02.txt": "1.00,1.02"}},
+		{name: "split", split: true, files: map[string]string{
+			"wandering_inn_1.00.txt": "1.00",
+			"wandering_inn_1.02.txt": "1.02",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			exporter := NewExporter(NewTextRenderer(DefaultTextOptions()))
+			exporter.SetOutputDir(dir)
+			exporter.SetSplit(tt.split)
+
+			// The failed chapter is left out
+			fetcher := &mockFetcher{errors: map[string]error{"url1": errors.New("not found")}}
+			if err := exporter.Export(chapters, fetcher); err != nil {
+				t.Fatalf("Export() failed: %v", err)
+			}
+
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatalf("reading output directory: %v", err)
+			}
+			if len(entries) != len(tt.files) {
+				t.Errorf("wrote %d files, want %d", len(entries), len(tt.files))
+			}
+			for name, titles := range tt.files {
+				data, err := os.ReadFile(filepath.Join(dir, name))
+				if err != nil {
+					t.Errorf("reading %s: %v", name, err)
+					continue
+				}
+				for _, title := range strings.Split(titles, ",") {
+					if !strings.Contains(string(data), "Content of "+title) {
+						t.Errorf("%s does not contain chapter %s", name, title)
+					}
+				}
+				if strings.Contains(string(data), "1.01") {
+					t.Errorf("%s contains the chapter that failed", name)
+				}
+			}
+		})
+	}
+}
+
+func TestExporter_Export_OutputPath(t *testing.T) {
+	outputPath := filepath.Join(t.TempDir(), "book.txt")
+	exporter := NewExporter(NewTextRenderer(DefaultTextOptions()))
+	exporter.SetOutputPath(outputPath)
+
+	if err := exporter.Export([]models.Chapter{{Title: "1.00", URL: "url0"}}, &mockFetcher{}); err != nil {
+		t.Fatalf("Export() failed: %v", err)
+	}
+	if _, err := os.Stat(outputPath); err != nil {
+		t.Errorf("output file was not written: %v", err)
+	}
+}
@@ -0,0 +1,144 @@
+package export
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+
+	"github.com/linuxswords/wandering-inn/internal/epub"
+	"github.com/linuxswords/wandering-inn/internal/scraper"
+)
+
+// HTMLOptions control the HTML format.
+type HTMLOptions struct {
+	// CSS is the stylesheet put into the document, usually the Formatter's.
+	CSS string
+	// Images says whether images are embedded and how they are shrunk.
+	Images epub.ImageOptions
+	// ImageFetcher is where images are downloaded from; nil goes straight to
+	// the site.
+	ImageFetcher scraper.PageFetcher
+}
+
+// htmlLayoutCSS lays out the table of contents and starts every chapter on
+// a new page when printing. It comes before the stylesheet of the options,
+// which can override it.
+const htmlLayoutCSS = `
+@media screen {
+	body {
+		max-width: 45em;
+		margin: 0 auto;
+		padding: 0 1em;
+	}
+}
+nav.toc ol {
+	list-style: none;
+	padding-left: 1.5em;
+}
+section.chapter {
+	break-before: page;
+}
+`
+
+// HTMLRenderer writes chapters as one self-contained HTML document, with the
+// stylesheet and images inside and a table of contents linking to each
+// chapter.
+type HTMLRenderer struct {
+	options HTMLOptions
+	images  *epub.ImageInliner
+}
+
+func NewHTMLRenderer(options HTMLOptions) *HTMLRenderer {
+	return &HTMLRenderer{
+		options: options,
+		images:  epub.NewImageInliner(options.ImageFetcher, options.Images),
+	}
+}
+
+func (r *HTMLRenderer) Ext() string {
+	return "html"
+}
+
+func (r *HTMLRenderer) Render(ctx context.Context, w io.Writer, doc Document) error {
+	var b strings.Builder
+	language := doc.Metadata.Language
+	if language == "" {
+		language = "en"
+	}
+	fmt.Fprintf(&b, "<!DOCTYPE html>\n<html lang=\"%s\">\n<head>\n", html.EscapeString(language))
+	b.WriteString("<meta charset=\"utf-8\">\n")
+	b.WriteString("<meta name=\"viewport\" content=\"width=device-width, initial-scale=1\">\n")
+	fmt.Fprintf(&b, "<title>%s</title>\n", html.EscapeString(doc.Metadata.Title))
+	b.WriteString("<style>" + htmlLayoutCSS + r.options.CSS + "</style>\n")
+	b.WriteString("</head>\n<body>\n")
+
+	b.WriteString("<header class=\"title-page\">\n")
+	fmt.Fprintf(&b, "<h1>%s</h1>\n", html.EscapeString(doc.Metadata.Title))
+	if doc.Metadata.Author != "" {
+		fmt.Fprintf(&b, "<p class=\"author\">%s</p>\n", html.EscapeString(doc.Metadata.Author))
+	}
+	b.WriteString("</header>\n")
+
+	writeTOC(&b, doc.Chapters)
+
+	for _, chapter := range doc.Chapters {
+		content := r.images.Inline(ctx, chapter.Content, chapter.URL)
+		fmt.Fprintf(&b, "<section class=\"chapter\" id=\"%s\">\n%s\n</section>\n", chapterAnchor(chapter), content)
+	}
+	b.WriteString("</body>\n</html>\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// chapterAnchor returns the id of a chapter's section, after its number in
+// the table of contents so that links to it stay valid across exports.
+func chapterAnchor(chapter Chapter) string {
+	return fmt.Sprintf("chapter-%d", chapter.Index+1)
+}
+
+// writeTOC writes a table of contents with the chapters nested under their
+// volume and book, like in the EPUB.
+func writeTOC(b *strings.Builder, chapters []Chapter) {
+	b.WriteString("<nav class=\"toc\" id=\"toc\">\n<h2>Contents</h2>\n<ol>\n")
+
+	var volume, book string
+	closeBook := func() {
+		if book != "" {
+			b.WriteString("</ol></li>\n")
+			book = ""
+		}
+	}
+	closeVolume := func() {
+		closeBook()
+		if volume != "" {
+			b.WriteString("</ol></li>\n")
+			volume = ""
+		}
+	}
+
+	for _, chapter := range chapters {
+		if chapter.Volume != volume {
+			closeVolume()
+			if chapter.Volume != "" {
+				fmt.Fprintf(b, "<li>%s<ol>\n", html.EscapeString(chapter.Volume))
+				volume = chapter.Volume
+			}
+		}
+		// Books are only nested within a volume, as in the EPUB
+		if chapter.Book != book && volume != "" {
+			closeBook()
+			if chapter.Book != "" {
+				fmt.Fprintf(b, "<li>%s<ol>\n", html.EscapeString(chapter.Book))
+				book = chapter.Book
+			}
+		}
+		fmt.Fprintf(b, "<li><a href=\"#%s\">%s</a></li>\n", chapterAnchor(chapter), html.EscapeString(chapter.Title))
+	}
+	closeVolume()
+
+	b.WriteString("</ol>\n</nav>\n")
+}
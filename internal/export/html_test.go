@@ -0,0 +1,73 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/linuxswords/wandering-inn/internal/epub"
+	"github.com/linuxswords/wandering-inn/internal/models"
+)
+
+type imageFetcher map[string][]byte
+
+func (f imageFetcher) Fetch(ctx context.Context, url string) ([]byte, error) {
+	return f[url], nil
+}
+
+func TestHTMLRenderer_Render(t *testing.T) {
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatalf("encoding PNG: %v", err)
+	}
+
+	renderer := NewHTMLRenderer(HTMLOptions{
+		CSS:          ".red { color: darkred; }",
+		ImageFetcher: imageFetcher{"https://wanderinginn.com/art/map.png": img.Bytes()},
+	})
+	doc := Document{
+		Metadata: epub.Metadata{Title: "Volume 1 & more", Author: "pirateaba"},
+		Chapters: []Chapter{
+			{Chapter: models.Chapter{Title: "Prologue", Index: 0}, Content: "<h1>Prologue</h1>"},
+			{Chapter: models.Chapter{Title: "1.00", Index: 1, Volume: "Volume 1"}, Content: "<h1>1.00</h1>"},
+			{Chapter: models.Chapter{Title: "2.00", Index: 2, Volume: "Volume 2", Book: "Book 1"}, Content: "<h1>2.00</h1>"},
+			{Chapter: models.Chapter{Title: "Interlude", Index: 3, Volume: "Volume 2"}, Content: "<h1>Interlude</h1>"},
+			{
+				Chapter: models.Chapter{Title: "2.01", URL: "https://wanderinginn.com/2-01/", Index: 4, Volume: "Volume 2", Book: "Book 2"},
+				Content: `<h1>2.01</h1><p class="red">Red</p><img src="/art/map.png" alt="Map"/>`,
+			},
+		},
+	}
+
+	var b strings.Builder
+	if err := renderer.Render(context.Background(), &b, doc); err != nil {
+		t.Fatalf("Render() failed: %v", err)
+	}
+	out := b.String()
+
+	for _, want := range []string{
+		"<title>Volume 1 &amp; more</title>",
+		".red { color: darkred; }",
+		"<p class=\"author\">pirateaba</p>",
+		`<section class="chapter" id="chapter-5">`,
+		`<p class="red">Red</p>`,
+		`<img src="data:image/png;base64,`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("document does not contain %q", want)
+		}
+	}
+
+	// The table of contents as nested titles, e.g. "(Prologue Volume 1(1.00))"
+	toc := out[strings.Index(out, "<ol>"):strings.Index(out, "</nav>")]
+	toc = regexp.MustCompile(`</?a[^>]*>|</li>|\n`).ReplaceAllString(toc, "")
+	toc = strings.NewReplacer("<ol>", "(", "</ol>", ")", "<li>", " ").Replace(toc)
+	want := "( Prologue Volume 1( 1.00) Volume 2( Book 1( 2.00) Interlude Book 2( 2.01)))"
+	if toc != want {
+		t.Errorf("table of contents = %q, want %q", toc, want)
+	}
+}
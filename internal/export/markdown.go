@@ -0,0 +1,316 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"gopkg.in/yaml.v3"
+
+	"github.com/linuxswords/wandering-inn/pkg/utils"
+)
+
+// MarkdownRenderer writes chapters as CommonMark with YAML front matter.
+// Italic and bold text becomes *emphasis* and **strong emphasis**; coloured
+// text is kept as inline HTML spans, which CommonMark passes through.
+type MarkdownRenderer struct{}
+
+func NewMarkdownRenderer() *MarkdownRenderer {
+	return &MarkdownRenderer{}
+}
+
+func (r *MarkdownRenderer) Ext() string {
+	return "md"
+}
+
+// frontMatter describes a file. A file of one chapter describes the chapter
+// itself; a file of several lists them under Chapters.
+type frontMatter struct {
+	Title     string          `yaml:"title"`
+	Series    string          `yaml:"series,omitempty"`
+	URL       string          `yaml:"url,omitempty"`
+	Index     int             `yaml:"index,omitempty"`
+	Volume    string          `yaml:"volume,omitempty"`
+	Book      string          `yaml:"book,omitempty"`
+	Published time.Time       `yaml:"published,omitempty"`
+	Fetched   time.Time       `yaml:"fetched"`
+	Chapters  []chapterMatter `yaml:"chapters,omitempty"`
+}
+
+type chapterMatter struct {
+	Title string `yaml:"title"`
+	URL   string `yaml:"url,omitempty"`
+	// Index is the number of the chapter in the table of contents, counting
+	// from 1 like the chapter selection does.
+	Index     int       `yaml:"index,omitempty"`
+	Volume    string    `yaml:"volume,omitempty"`
+	Book      string    `yaml:"book,omitempty"`
+	Published time.Time `yaml:"published,omitempty"`
+}
+
+func newFrontMatter(doc Document) frontMatter {
+	matter := frontMatter{Title: doc.Metadata.Title, Series: doc.Metadata.Series}
+	for _, chapter := range doc.Chapters {
+		if fetched := chapter.FetchedAt.Truncate(time.Second); fetched.After(matter.Fetched) {
+			matter.Fetched = fetched
+		}
+		matter.Chapters = append(matter.Chapters, chapterMatter{
+			Title:     chapter.Title,
+			URL:       chapter.URL,
+			Index:     chapter.Index + 1,
+			Volume:    chapter.Volume,
+			Book:      chapter.Book,
+			Published: chapter.Published,
+		})
+	}
+
+	if len(matter.Chapters) == 1 {
+		chapter := matter.Chapters[0]
+		matter.Title, matter.URL, matter.Index = chapter.Title, chapter.URL, chapter.Index
+		matter.Volume, matter.Book, matter.Published = chapter.Volume, chapter.Book, chapter.Published
+		matter.Chapters = nil
+	}
+	return matter
+}
+
+func (r *MarkdownRenderer) Render(ctx context.Context, w io.Writer, doc Document) error {
+	matter, err := yaml.Marshal(newFrontMatter(doc))
+	if err != nil {
+		return fmt.Errorf("writing front matter: %w", err)
+	}
+
+	var b strings.Builder
+	b.WriteString("---\n")
+	b.Write(matter)
+	b.WriteString("---\n")
+	for _, chapter := range doc.Chapters {
+		blocks, err := markdownBlocks(chapter.Content)
+		if err != nil {
+			return fmt.Errorf("chapter %s: %w", chapter.Title, err)
+		}
+		for _, block := range blocks {
+			b.WriteString("\n" + block + "\n")
+		}
+	}
+
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+var (
+	// Characters that start a block when they begin a line, and ordered
+	// list markers such as "1." or "1)"
+	lineStartChars   = "#>-+=~|"
+	listMarkerPrefix = regexp.MustCompile(`^(\d+)([.)])`)
+	markdownEscaper  = strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "<", `\<`, "&", `\&`)
+	spaceRun         = regexp.MustCompile(` {2,}`)
+)
+
+// markdownWriter collects the Markdown of one block.
+type markdownWriter struct {
+	b bytes.Buffer
+	// lineStart is set while nothing but whitespace has been written to the
+	// current line
+	lineStart bool
+}
+
+func (m *markdownWriter) markup(s string) {
+	m.b.WriteString(s)
+	m.lineStart = false
+}
+
+func (m *markdownWriter) text(s string) {
+	s = collapseSpace(s)
+	if m.lineStart {
+		s = strings.TrimLeft(s, " ")
+		if s == "" {
+			return
+		}
+	}
+
+	s = markdownEscaper.Replace(s)
+	if m.lineStart {
+		if strings.ContainsRune(lineStartChars, rune(s[0])) {
+			s = `\` + s
+		} else {
+			s = listMarkerPrefix.ReplaceAllString(s, `$1\$2`)
+		}
+	}
+	m.markup(s)
+}
+
+func (m *markdownWriter) lineBreak() {
+	m.b.WriteString("\n")
+	m.lineStart = true
+}
+
+// isCollapsible reports whether r is whitespace that HTML collapses. Unlike
+// unicode.IsSpace, it leaves non-breaking spaces alone.
+func isCollapsible(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '\f'
+}
+
+// collapseSpace replaces each run of whitespace in s with a single space.
+func collapseSpace(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range s {
+		if isCollapsible(r) {
+			space = true
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(r)
+	}
+	if space {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+// markdownBlocks converts chapter HTML into Markdown paragraphs and headings.
+func markdownBlocks(content string) ([]string, error) {
+	nodes, err := html.ParseFragment(strings.NewReader(content), &html.Node{Type: html.ElementNode, DataAtom: atom.Body, Data: "body"})
+	if err != nil {
+		return nil, err
+	}
+
+	var blocks []string
+	current := &markdownWriter{lineStart: true}
+	heading := 0
+	flush := func() {
+		var lines []string
+		for _, line := range strings.Split(current.b.String(), "\n") {
+			if line = strings.TrimSpace(spaceRun.ReplaceAllString(line, " ")); line != "" {
+				lines = append(lines, line)
+			}
+		}
+		if len(lines) > 0 {
+			if heading > 0 {
+				blocks = append(blocks, strings.Repeat("#", heading)+" "+strings.Join(lines, " "))
+			} else {
+				// A backslash at the end of a line is a hard line break
+				blocks = append(blocks, strings.Join(lines, "\\\n"))
+			}
+		}
+		current = &markdownWriter{lineStart: true}
+		heading = 0
+	}
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			current.text(n.Data)
+			return
+		case html.ElementNode:
+		default:
+			return
+		}
+
+		switch n.DataAtom {
+		case atom.Br:
+			current.lineBreak()
+			return
+		case atom.Img:
+			alt := strings.NewReplacer("[", `\[`, "]", `\]`).Replace(markdownEscaper.Replace(utils.GetAttr(n, "alt")))
+			current.markup("![" + alt + "](" + markdownURL(utils.GetAttr(n, "src")) + ")")
+			return
+		case atom.Em, atom.I, atom.Strong, atom.B:
+			marker := "*"
+			if n.DataAtom == atom.Strong || n.DataAtom == atom.B {
+				marker = "**"
+			}
+			if open := spanTag(n); open != "" {
+				current.markup(open)
+				defer current.markup("</span>")
+			}
+			emphasize(current, marker, func() {
+				for c := n.FirstChild; c != nil; c = c.NextSibling {
+					walk(c)
+				}
+			})
+			return
+		case atom.Span:
+			if open := spanTag(n); open != "" {
+				current.markup(open)
+				defer current.markup("</span>")
+			}
+		case atom.P, atom.Div, atom.Figure, atom.Figcaption:
+			flush()
+			defer flush()
+		case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+			flush()
+			heading = int(n.Data[1] - '0')
+			// Heading text follows the "#" markers, so it cannot start a block
+			current.lineStart = false
+			defer flush()
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	for _, n := range nodes {
+		walk(n)
+	}
+	flush()
+	return blocks, nil
+}
+
+// emphasize writes what children writes between markers. CommonMark only
+// sees the markers as emphasis when they touch the text, so surrounding
+// whitespace is moved outside of them.
+func emphasize(m *markdownWriter, marker string, children func()) {
+	start := m.b.Len()
+	children()
+	inner := string(m.b.Bytes()[start:])
+	m.b.Truncate(start)
+
+	core := strings.TrimSpace(inner)
+	if core == "" {
+		m.b.WriteString(inner)
+		return
+	}
+	if strings.HasPrefix(inner, " ") {
+		m.b.WriteString(" ")
+	}
+	m.markup(marker + core + marker)
+	if strings.HasSuffix(inner, " ") {
+		m.b.WriteString(" ")
+	}
+}
+
+// spanTag returns an opening <span> carrying the class and style of n, or ""
+// if n has neither.
+func spanTag(n *html.Node) string {
+	var attrs string
+	if class := utils.GetAttr(n, "class"); class != "" {
+		attrs += fmt.Sprintf(` class="%s"`, html.EscapeString(class))
+	}
+	if style := utils.GetAttr(n, "style"); style != "" {
+		attrs += fmt.Sprintf(` style="%s"`, html.EscapeString(style))
+	}
+	if attrs == "" {
+		return ""
+	}
+	return "<span" + attrs + ">"
+}
+
+// markdownURL returns url as a link destination, in pointy brackets if it
+// has characters that would end it.
+func markdownURL(url string) string {
+	if strings.ContainsAny(url, " ()<>") {
+		return "<" + strings.NewReplacer("<", "%3C", ">", "%3E").Replace(url) + ">"
+	}
+	return url
+}
@@ -0,0 +1,154 @@
+package export
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/linuxswords/wandering-inn/internal/epub"
+	"github.com/linuxswords/wandering-inn/internal/models"
+)
+
+func TestMarkdownBlocks(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{
+			name:    "headings and paragraphs",
+			content: `<h1>1.00</h1><p>The inn   was quiet.</p><h3>Part</h3>`,
+			want:    []string{"# 1.00", "The inn was quiet.", "### Part"},
+		},
+		{
+			name:    "emphasis",
+			content: `<p>An <em>old</em> inn, <strong>[Innkeeper Level 20!]</strong></p>`,
+			want:    []string{"An *old* inn, **[Innkeeper Level 20!]**"},
+		},
+		{
+			name:    "whitespace moved out of emphasis",
+			content: `<p>a<em> word </em>b</p>`,
+			want:    []string{"a *word* b"},
+		},
+		{
+			name:    "colour spans",
+			content: `<p><span class="red">Red text</span> and <strong class="blue">[Skill]</strong> <span style="color: #ff0000">x</span></p>`,
+			want:    []string{`<span class="red">Red text</span> and <span class="blue">**[Skill]**</span> <span style="color: #ff0000">x</span>`},
+		},
+		{
+			name:    "line breaks",
+			content: `<p>one<br/>two</p>`,
+			want:    []string{"one\\\ntwo"},
+		},
+		{
+			name:    "escaping",
+			content: `<p>*not bold* &lt;tag&gt; a_b</p><p>- not a list</p><p>1. not a list either</p><p># not a heading</p>`,
+			want:    []string{`\*not bold\* \<tag> a\_b`, `\- not a list`, `1\. not a list either`, `\# not a heading`},
+		},
+		{
+			name:    "images",
+			content: `<figure><img src="https://example.com/map.png" alt="Map"/><figcaption>The map</figcaption></figure>`,
+			want:    []string{"![Map](https://example.com/map.png)", "The map"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := markdownBlocks(tt.content)
+			if err != nil {
+				t.Fatalf("markdownBlocks() failed: %v", err)
+			}
+			if strings.Join(got, "\n\n") != strings.Join(tt.want, "\n\n") {
+				t.Errorf("markdownBlocks() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// readFrontMatter splits a Markdown file into its front matter and body.
+func readFrontMatter(t *testing.T, file string) (map[string]any, string) {
+	t.Helper()
+
+	rest, ok := strings.CutPrefix(file, "---\n")
+	if !ok {
+		t.Fatalf("file does not start with front matter: %q", file)
+	}
+	matter, body, ok := strings.Cut(rest, "---\n")
+	if !ok {
+		t.Fatalf("front matter is not closed: %q", file)
+	}
+
+	var fields map[string]any
+	if err := yaml.Unmarshal([]byte(matter), &fields); err != nil {
+		t.Fatalf("parsing front matter: %v", err)
+	}
+	return fields, body
+}
+
+func TestMarkdownRenderer_Render(t *testing.T) {
+	fetched := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	chapters := []Chapter{
+		{
+			Chapter:   models.Chapter{Title: "1.00", URL: "https://wanderinginn.com/1-00/", Index: 0, Volume: "Volume 1"},
+			Content:   "<h1>1.00</h1><p>First.</p>",
+			FetchedAt: fetched,
+		},
+		{
+			Chapter:   models.Chapter{Title: "1.01", URL: "https://wanderinginn.com/1-01/", Index: 1, Volume: "Volume 1"},
+			Content:   "<h1>1.01</h1><p>Second.</p>",
+			FetchedAt: fetched,
+		},
+	}
+
+	t.Run("one chapter", func(t *testing.T) {
+		var b strings.Builder
+		doc := Document{Metadata: epub.Metadata{Title: "Book", Series: "The Wandering Inn"}, Chapters: chapters[1:]}
+		if err := NewMarkdownRenderer().Render(context.Background(), &b, doc); err != nil {
+			t.Fatalf("Render() failed: %v", err)
+		}
+
+		fields, body := readFrontMatter(t, b.String())
+		want := map[string]any{
+			"title":   "1.01",
+			"series":  "The Wandering Inn",
+			"url":     "https://wanderinginn.com/1-01/",
+			"index":   2,
+			"volume":  "Volume 1",
+			"fetched": fetched,
+		}
+		for key, value := range want {
+			if fields[key] != value {
+				t.Errorf("front matter %s = %v, want %v", key, fields[key], value)
+			}
+		}
+		if body != "\n# 1.01\n\nSecond.\n" {
+			t.Errorf("body = %q", body)
+		}
+	})
+
+	t.Run("several chapters", func(t *testing.T) {
+		var b strings.Builder
+		doc := Document{Metadata: epub.Metadata{Title: "Book"}, Chapters: chapters}
+		if err := NewMarkdownRenderer().Render(context.Background(), &b, doc); err != nil {
+			t.Fatalf("Render() failed: %v", err)
+		}
+
+		fields, body := readFrontMatter(t, b.String())
+		if fields["title"] != "Book" {
+			t.Errorf("front matter title = %v, want the book title", fields["title"])
+		}
+		listed, _ := fields["chapters"].([]any)
+		if len(listed) != 2 {
+			t.Fatalf("front matter lists %d chapters, want 2", len(listed))
+		}
+		if first := listed[0].(map[string]any); first["url"] != chapters[0].URL || first["index"] != 1 {
+			t.Errorf("first chapter in front matter = %v", first)
+		}
+		if body != "\n# 1.00\n\nFirst.\n\n# 1.01\n\nSecond.\n" {
+			t.Errorf("body = %q", body)
+		}
+	})
+}
@@ -0,0 +1,596 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/vincent-petithory/dataurl"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"github.com/linuxswords/wandering-inn/internal/epub"
+	"github.com/linuxswords/wandering-inn/internal/scraper"
+	"github.com/linuxswords/wandering-inn/pkg/utils"
+)
+
+// PDFOptions control the PDF format. Lengths are in millimetres.
+type PDFOptions struct {
+	// PageSize is A3, A4, A5, A6, Letter or Legal, or WIDTHxHEIGHT such as
+	// "157x210".
+	PageSize string
+	Margin   float64
+	// Font is one of the built-in fonts times, helvetica and courier, or the
+	// path of a TrueType font. The built-in fonts only cover Western
+	// European characters.
+	Font string
+	// BoldFont, ItalicFont and BoldItalicFont are TrueType fonts for the
+	// styles of a TrueType Font. Styles without one use the closest font
+	// that is given.
+	BoldFont       string
+	ItalicFont     string
+	BoldItalicFont string
+	// FontSize is the size of body text in points.
+	FontSize float64
+	// CSS is the stylesheet that the colours of classes are taken from,
+	// usually the Formatter's.
+	CSS string
+	// Images says whether images are embedded and how they are shrunk.
+	Images epub.ImageOptions
+	// ImageFetcher is where images are downloaded from; nil goes straight to
+	// the site.
+	ImageFetcher scraper.PageFetcher
+}
+
+func DefaultPDFOptions() PDFOptions {
+	return PDFOptions{PageSize: "A5", Margin: 15, Font: "times", FontSize: 11}
+}
+
+var pageSizes = map[string]fpdf.SizeType{
+	"a3":     {Wd: 297, Ht: 420},
+	"a4":     {Wd: 210, Ht: 297},
+	"a5":     {Wd: 148, Ht: 210},
+	"a6":     {Wd: 105, Ht: 148},
+	"letter": {Wd: 215.9, Ht: 279.4},
+	"legal":  {Wd: 215.9, Ht: 355.6},
+}
+
+var coreFonts = []string{"times", "helvetica", "courier"}
+
+var customPageSize = regexp.MustCompile(`^(\d+(?:\.\d+)?)x(\d+(?:\.\d+)?)$`)
+
+// headingScale is how much larger than body text headings are.
+var headingScale = map[atom.Atom]float64{
+	atom.H1: 1.6,
+	atom.H2: 1.4,
+	atom.H3: 1.25,
+	atom.H4: 1.1,
+	atom.H5: 1,
+	atom.H6: 1,
+}
+
+// PDFRenderer lays chapters out as a PDF, each starting on a new page and
+// listed in the document outline.
+type PDFRenderer struct {
+	options  PDFOptions
+	pageSize fpdf.SizeType
+	// fonts holds the TrueType fonts by style ("", "B", "I", "BI"); it is
+	// nil when a built-in font is used
+	fonts  map[string][]byte
+	colors map[string]rgb
+	images *epub.ImageInliner
+}
+
+// NewPDFRenderer checks the options and loads the fonts.
+func NewPDFRenderer(options PDFOptions) (*PDFRenderer, error) {
+	pageSize, err := parsePageSize(options.PageSize)
+	if err != nil {
+		return nil, err
+	}
+	if options.Margin < 0 || 2*options.Margin >= min(pageSize.Wd, pageSize.Ht) {
+		return nil, fmt.Errorf("margin of %gmm does not fit on the page", options.Margin)
+	}
+	if options.FontSize <= 0 {
+		return nil, fmt.Errorf("font size must be positive")
+	}
+
+	fonts, err := loadFonts(options)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PDFRenderer{
+		options:  options,
+		pageSize: pageSize,
+		fonts:    fonts,
+		colors:   cssColors(options.CSS),
+		images:   epub.NewImageInliner(options.ImageFetcher, options.Images),
+	}, nil
+}
+
+func parsePageSize(size string) (fpdf.SizeType, error) {
+	size = strings.ToLower(strings.TrimSpace(size))
+	if pageSize, ok := pageSizes[size]; ok {
+		return pageSize, nil
+	}
+	if match := customPageSize.FindStringSubmatch(size); match != nil {
+		width, _ := strconv.ParseFloat(match[1], 64)
+		height, _ := strconv.ParseFloat(match[2], 64)
+		if width > 0 && height > 0 {
+			return fpdf.SizeType{Wd: width, Ht: height}, nil
+		}
+	}
+	return fpdf.SizeType{}, fmt.Errorf("unknown page size %q, want A3, A4, A5, A6, Letter, Legal or WIDTHxHEIGHT in millimetres", size)
+}
+
+func loadFonts(options PDFOptions) (map[string][]byte, error) {
+	styled := options.BoldFont != "" || options.ItalicFont != "" || options.BoldItalicFont != ""
+	for _, core := range coreFonts {
+		if strings.EqualFold(options.Font, core) {
+			if styled {
+				return nil, fmt.Errorf("bold and italic fonts can only be given with a TrueType font")
+			}
+			return nil, nil
+		}
+	}
+
+	fonts := make(map[string][]byte)
+	for style, path := range map[string]string{"": options.Font, "B": options.BoldFont, "I": options.ItalicFont, "BI": options.BoldItalicFont} {
+		if path == "" {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading font: %w", err)
+		}
+		fonts[style] = data
+	}
+
+	// Styles without a font of their own fall back to the closest one
+	fallbacks := map[string][]string{"B": {""}, "I": {""}, "BI": {"B", "I", ""}}
+	for _, style := range []string{"B", "I", "BI"} {
+		for _, fallback := range fallbacks[style] {
+			if fonts[style] == nil {
+				fonts[style] = fonts[fallback]
+			}
+		}
+	}
+	return fonts, nil
+}
+
+func (r *PDFRenderer) Ext() string {
+	return "pdf"
+}
+
+func (r *PDFRenderer) Render(ctx context.Context, w io.Writer, doc Document) error {
+	pdf := r.newDocument()
+	p := &pdfWriter{renderer: r, pdf: pdf, images: make(map[string]string)}
+	if r.fonts == nil {
+		p.family = strings.ToLower(r.options.Font)
+		p.translate = pdf.UnicodeTranslatorFromDescriptor("")
+	} else {
+		p.family = "body"
+		p.translate = func(s string) string { return s }
+		for style, data := range r.fonts {
+			pdf.AddUTF8FontFromBytes(p.family, style, data)
+		}
+	}
+
+	pdf.SetTitle(doc.Metadata.Title, true)
+	pdf.SetAuthor(doc.Metadata.Author, true)
+	if doc.Metadata.Description != "" {
+		pdf.SetSubject(doc.Metadata.Description, true)
+	}
+	pdf.SetFooterFunc(p.footer)
+	p.titlePage(doc.Metadata)
+
+	// Chapters are nested under their volume and book in the outline, like in
+	// the table of contents of the EPUB
+	var volume, book string
+	for _, chapter := range doc.Chapters {
+		pdf.AddPage()
+		p.setFont("", r.options.FontSize)
+		if chapter.Volume != volume {
+			volume, book = chapter.Volume, ""
+			if volume != "" {
+				pdf.Bookmark(p.translate(volume), 0, -1)
+			}
+		}
+		if chapter.Book != book && volume != "" {
+			book = chapter.Book
+			if book != "" {
+				pdf.Bookmark(p.translate(book), 1, -1)
+			}
+		}
+		level := 0
+		if volume != "" {
+			level++
+		}
+		if book != "" {
+			level++
+		}
+		pdf.Bookmark(p.translate(chapter.Title), level, -1)
+
+		content := r.images.Inline(ctx, chapter.Content, chapter.URL)
+		if err := p.chapter(content); err != nil {
+			return fmt.Errorf("chapter %s: %w", chapter.Title, err)
+		}
+	}
+
+	return pdf.Output(w)
+}
+
+func (r *PDFRenderer) newDocument() *fpdf.Fpdf {
+	pdf := fpdf.NewCustom(&fpdf.InitType{UnitStr: "mm", Size: r.pageSize})
+	pdf.SetMargins(r.options.Margin, r.options.Margin, r.options.Margin)
+	pdf.SetAutoPageBreak(true, r.options.Margin)
+	return pdf
+}
+
+// pdfWriter lays out the chapters of one document.
+type pdfWriter struct {
+	renderer  *PDFRenderer
+	pdf       *fpdf.Fpdf
+	family    string
+	translate func(string) string
+	// images maps data URIs to the names of the images registered for them
+	images map[string]string
+
+	// The style of the text being written: how many bold and italic
+	// elements it is in, and the colours of the elements that set one
+	bold, italic int
+	colors       []rgb
+	// written is set once the current block has content
+	written bool
+}
+
+// lineHeight returns the line height of text of the given size in points, in
+// millimetres.
+func lineHeight(size float64) float64 {
+	return size * 1.4 * 25.4 / 72
+}
+
+func (p *pdfWriter) setFont(style string, size float64) {
+	p.pdf.SetFont(p.family, style, size)
+}
+
+func (p *pdfWriter) titlePage(metadata epub.Metadata) {
+	size := p.renderer.options.FontSize
+	_, pageHeight := p.pdf.GetPageSize()
+
+	p.pdf.AddPage()
+	p.pdf.SetY(pageHeight / 3)
+	p.setFont("B", size*2)
+	p.pdf.MultiCell(0, lineHeight(size*2), p.translate(metadata.Title), "", "C", false)
+	if metadata.Author != "" {
+		p.pdf.Ln(lineHeight(size))
+		p.setFont("", size*1.2)
+		p.pdf.MultiCell(0, lineHeight(size*1.2), p.translate(metadata.Author), "", "C", false)
+	}
+}
+
+// footer numbers every page but the title page, unless the margin is too
+// small for the number.
+func (p *pdfWriter) footer() {
+	size := p.renderer.options.FontSize * 0.8
+	margin := p.renderer.options.Margin
+	if p.pdf.PageNo() == 1 || margin < lineHeight(size) {
+		return
+	}
+	p.pdf.SetY(-margin / 2)
+	p.setFont("", size)
+	p.pdf.SetTextColor(0, 0, 0)
+	p.pdf.CellFormat(0, 0, strconv.Itoa(p.pdf.PageNo()), "", 0, "C", false, 0, "")
+}
+
+func (p *pdfWriter) chapter(content string) error {
+	nodes, err := html.ParseFragment(strings.NewReader(content), &html.Node{Type: html.ElementNode, DataAtom: atom.Body, Data: "body"})
+	if err != nil {
+		return err
+	}
+	for _, n := range nodes {
+		p.walk(n)
+	}
+	p.endBlock()
+	return p.pdf.Error()
+}
+
+func (p *pdfWriter) walk(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		p.text(n.Data)
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+
+	if color, ok := p.renderer.elementColor(n); ok {
+		p.colors = append(p.colors, color)
+		defer func() { p.colors = p.colors[:len(p.colors)-1] }()
+	}
+
+	switch n.DataAtom {
+	case atom.Br:
+		p.pdf.Ln(lineHeight(p.renderer.options.FontSize))
+		return
+	case atom.Img:
+		p.image(n)
+		return
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		p.heading(n)
+		return
+	case atom.Strong, atom.B:
+		p.bold++
+		defer func() { p.bold-- }()
+	case atom.Em, atom.I:
+		p.italic++
+		defer func() { p.italic-- }()
+	case atom.P, atom.Div, atom.Figure, atom.Figcaption:
+		p.endBlock()
+		defer p.endBlock()
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		p.walk(c)
+	}
+}
+
+func (p *pdfWriter) atLineStart() bool {
+	left, _, _, _ := p.pdf.GetMargins()
+	return p.pdf.GetX() <= left+0.01
+}
+
+// endBlock ends the current paragraph, leaving some space after it.
+func (p *pdfWriter) endBlock() {
+	if !p.written {
+		return
+	}
+	size := p.renderer.options.FontSize
+	if !p.atLineStart() {
+		p.pdf.Ln(lineHeight(size))
+	}
+	p.pdf.Ln(lineHeight(size) / 2)
+	p.written = false
+}
+
+func (p *pdfWriter) text(s string) {
+	s = collapseSpace(s)
+	if p.atLineStart() {
+		s = strings.TrimLeft(s, " ")
+	}
+	if s == "" {
+		return
+	}
+
+	style := ""
+	if p.bold > 0 {
+		style += "B"
+	}
+	if p.italic > 0 {
+		style += "I"
+	}
+	size := p.renderer.options.FontSize
+	p.setFont(style, size)
+	p.setColor()
+	p.pdf.Write(lineHeight(size), p.translate(s))
+	p.written = true
+}
+
+func (p *pdfWriter) setColor() {
+	if len(p.colors) == 0 {
+		p.pdf.SetTextColor(0, 0, 0)
+		return
+	}
+	color := p.colors[len(p.colors)-1]
+	p.pdf.SetTextColor(color.r, color.g, color.b)
+}
+
+// heading writes a heading as plain text, with chapter titles centred.
+func (p *pdfWriter) heading(n *html.Node) {
+	p.endBlock()
+	title := strings.TrimSpace(collapseSpace(textContent(n)))
+	if title == "" {
+		return
+	}
+
+	size := p.renderer.options.FontSize * headingScale[n.DataAtom]
+	align := "L"
+	if n.DataAtom == atom.H1 {
+		align = "C"
+	}
+	p.setFont("B", size)
+	p.setColor()
+	p.pdf.MultiCell(0, lineHeight(size), p.translate(title), "", align, false)
+	p.pdf.Ln(lineHeight(p.renderer.options.FontSize) / 2)
+}
+
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.WriteString(textContent(c))
+	}
+	return b.String()
+}
+
+// image places an image, inlined as a data URI, on a line of its own, scaled
+// down to fit the page. Images that PDF cannot hold are replaced by their
+// description.
+func (p *pdfWriter) image(n *html.Node) {
+	name, ok := p.register(utils.GetAttr(n, "src"))
+	if !ok {
+		if alt := utils.GetAttr(n, "alt"); alt != "" {
+			p.text("[Image: " + alt + "]")
+		}
+		return
+	}
+
+	if !p.atLineStart() {
+		p.pdf.Ln(lineHeight(p.renderer.options.FontSize))
+	}
+	info := p.pdf.GetImageInfo(name)
+	pageWidth, pageHeight := p.pdf.GetPageSize()
+	left, top, right, bottom := p.pdf.GetMargins()
+	width := min(info.Width(), pageWidth-left-right)
+	height := info.Height() * width / info.Width()
+	if maxHeight := pageHeight - top - bottom; height > maxHeight {
+		width, height = width*maxHeight/height, maxHeight
+	}
+
+	if p.pdf.GetY()+height > pageHeight-bottom {
+		p.pdf.AddPage()
+	}
+	x := left + (pageWidth-left-right-width)/2
+	p.pdf.ImageOptions(name, x, p.pdf.GetY(), width, height, false, fpdf.ImageOptions{}, 0, "")
+	p.pdf.SetY(p.pdf.GetY() + height)
+	p.written = true
+}
+
+// register adds the image of a data URI to the document and returns its
+// name. Formats other than JPEG, PNG and GIF are converted to PNG.
+func (p *pdfWriter) register(src string) (string, bool) {
+	if name, ok := p.images[src]; ok {
+		return name, name != ""
+	}
+	p.images[src] = ""
+
+	data, err := dataurl.DecodeString(src)
+	if err != nil {
+		return "", false
+	}
+	imageType, ok := pdfImageTypes[data.ContentType()]
+	if !ok {
+		img, _, err := image.Decode(bytes.NewReader(data.Data))
+		if err != nil {
+			return "", false
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			return "", false
+		}
+		data.Data, imageType = buf.Bytes(), "png"
+	}
+
+	name := fmt.Sprintf("image%d", len(p.images))
+	p.pdf.RegisterImageOptionsReader(name, fpdf.ImageOptions{ImageType: imageType}, bytes.NewReader(data.Data))
+	if !p.pdf.Ok() {
+		fmt.Printf("Warning: Failed to embed image: %v\n", p.pdf.Error())
+		p.pdf.ClearError()
+		return "", false
+	}
+	p.images[src] = name
+	return name, true
+}
+
+// pdfImageTypes are the image formats PDF can hold, by media type.
+var pdfImageTypes = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+}
+
+type rgb struct {
+	r, g, b int
+}
+
+var (
+	cssClassRule  = regexp.MustCompile(`\.([\w-]+)\s*\{([^}]*)\}`)
+	cssColorValue = regexp.MustCompile(`(?:^|[;\s])color\s*:\s*([^;]+)`)
+	cssRGB        = regexp.MustCompile(`^rgb\(\s*(\d+)\s*,\s*(\d+)\s*,\s*(\d+)\s*\)$`)
+)
+
+// namedColors are the CSS colours of the class names in config.ColorClassMap,
+// used for classes the stylesheet has no colour for.
+var namedColors = map[string]rgb{
+	"black":   {0, 0, 0},
+	"white":   {255, 255, 255},
+	"red":     {255, 0, 0},
+	"blue":    {0, 0, 255},
+	"green":   {0, 128, 0},
+	"purple":  {128, 0, 128},
+	"orange":  {255, 165, 0},
+	"yellow":  {255, 255, 0},
+	"brown":   {165, 42, 42},
+	"pink":    {255, 192, 203},
+	"cyan":    {0, 255, 255},
+	"gray":    {128, 128, 128},
+	"grey":    {128, 128, 128},
+	"gold":    {255, 215, 0},
+	"silver":  {192, 192, 192},
+	"crimson": {220, 20, 60},
+	"maroon":  {128, 0, 0},
+	"navy":    {0, 0, 128},
+	"teal":    {0, 128, 128},
+}
+
+// cssColors returns the text colours that simple class rules such as
+// ".red { color: #e74c3c; }" in css give.
+func cssColors(css string) map[string]rgb {
+	colors := make(map[string]rgb)
+	for _, rule := range cssClassRule.FindAllStringSubmatch(css, -1) {
+		if value := cssColorValue.FindStringSubmatch(rule[2]); value != nil {
+			if color, ok := parseColor(value[1]); ok {
+				colors[rule[1]] = color
+			}
+		}
+	}
+	return colors
+}
+
+// parseColor reads a CSS colour: #rgb, #rrggbb, rgb(r, g, b) or one of
+// namedColors.
+func parseColor(value string) (rgb, bool) {
+	value = strings.ToLower(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(value), "!important")))
+	if color, ok := namedColors[value]; ok {
+		return color, true
+	}
+	if match := cssRGB.FindStringSubmatch(value); match != nil {
+		r, _ := strconv.Atoi(match[1])
+		g, _ := strconv.Atoi(match[2])
+		b, _ := strconv.Atoi(match[3])
+		return rgb{min(r, 255), min(g, 255), min(b, 255)}, true
+	}
+
+	hex, ok := strings.CutPrefix(value, "#")
+	if !ok {
+		return rgb{}, false
+	}
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	n, err := strconv.ParseUint(hex, 16, 32)
+	if len(hex) != 6 || err != nil {
+		return rgb{}, false
+	}
+	return rgb{int(n >> 16), int(n >> 8 & 0xff), int(n & 0xff)}, true
+}
+
+// elementColor returns the colour that the style or the classes of n give
+// its text.
+func (r *PDFRenderer) elementColor(n *html.Node) (rgb, bool) {
+	if value := cssColorValue.FindStringSubmatch(utils.GetAttr(n, "style")); value != nil {
+		if color, ok := parseColor(value[1]); ok {
+			return color, true
+		}
+	}
+	for _, class := range strings.Fields(utils.GetAttr(n, "class")) {
+		if color, ok := r.colors[class]; ok {
+			return color, true
+		}
+		if color, ok := namedColors[class]; ok {
+			return color, true
+		}
+	}
+	return rgb{}, false
+}
@@ -0,0 +1,184 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"github.com/linuxswords/wandering-inn/internal/epub"
+	"github.com/linuxswords/wandering-inn/internal/models"
+)
+
+func TestParsePageSize(t *testing.T) {
+	tests := []struct {
+		size          string
+		width, height float64
+		wantErr       bool
+	}{
+		{size: "A5", width: 148, height: 210},
+		{size: "letter", width: 215.9, height: 279.4},
+		{size: "157x210", width: 157, height: 210},
+		{size: "157.5x209.5", width: 157.5, height: 209.5},
+		{size: "0x210", wantErr: true},
+		{size: "B5", wantErr: true},
+		{size: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.size, func(t *testing.T) {
+			got, err := parsePageSize(tt.size)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePageSize(%q) error = %v, wantErr %v", tt.size, err, tt.wantErr)
+			}
+			if !tt.wantErr && (got.Wd != tt.width || got.Ht != tt.height) {
+				t.Errorf("parsePageSize(%q) = %gx%g, want %gx%g", tt.size, got.Wd, got.Ht, tt.width, tt.height)
+			}
+		})
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		value  string
+		want   rgb
+		wantOK bool
+	}{
+		{value: "#e74c3c", want: rgb{231, 76, 60}, wantOK: true},
+		{value: " #F00 ", want: rgb{255, 0, 0}, wantOK: true},
+		{value: "rgb(0, 128, 255)", want: rgb{0, 128, 255}, wantOK: true},
+		{value: "teal !important", want: rgb{0, 128, 128}, wantOK: true},
+		{value: "#12345", wantOK: false},
+		{value: "inherit", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, ok := parseColor(tt.value)
+			if ok != tt.wantOK || (ok && got != tt.want) {
+				t.Errorf("parseColor(%q) = %v, %v, want %v, %v", tt.value, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestPDFRenderer_ElementColor(t *testing.T) {
+	renderer, err := NewPDFRenderer(PDFOptions{
+		PageSize: "A5",
+		Font:     "times",
+		FontSize: 11,
+		CSS:      epub.DefaultCSS + ".glow { background-color: #000; color: #abcdef; }",
+	})
+	if err != nil {
+		t.Fatalf("NewPDFRenderer() failed: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		html   string
+		want   rgb
+		wantOK bool
+	}{
+		{name: "class from the stylesheet", html: `<span class="red">`, want: rgb{0xe7, 0x4c, 0x3c}, wantOK: true},
+		{name: "background is not the text colour", html: `<span class="glow">`, want: rgb{0xab, 0xcd, 0xef}, wantOK: true},
+		{name: "class without a rule", html: `<span class="other navy">`, want: rgb{0, 0, 128}, wantOK: true},
+		{name: "style wins", html: `<strong class="red" style="color: #00ff00">`, want: rgb{0, 255, 0}, wantOK: true},
+		{name: "uncoloured", html: `<span class="other">`, wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes, err := html.ParseFragment(strings.NewReader(tt.html), &html.Node{Type: html.ElementNode, DataAtom: atom.Body, Data: "body"})
+			if err != nil || len(nodes) != 1 {
+				t.Fatalf("parsing %q: %v", tt.html, err)
+			}
+			got, ok := renderer.elementColor(nodes[0])
+			if ok != tt.wantOK || (ok && got != tt.want) {
+				t.Errorf("elementColor() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestNewPDFRenderer_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*PDFOptions)
+	}{
+		{name: "unknown page size", modify: func(o *PDFOptions) { o.PageSize = "huge" }},
+		{name: "margin too large", modify: func(o *PDFOptions) { o.Margin = 80 }},
+		{name: "no font size", modify: func(o *PDFOptions) { o.FontSize = 0 }},
+		{name: "bold with built-in font", modify: func(o *PDFOptions) { o.BoldFont = "bold.ttf" }},
+		{name: "missing font file", modify: func(o *PDFOptions) { o.Font = filepath.Join(t.TempDir(), "missing.ttf") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultPDFOptions()
+			tt.modify(&options)
+			if _, err := NewPDFRenderer(options); err == nil {
+				t.Error("NewPDFRenderer() succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestPDFRenderer_Render(t *testing.T) {
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewGray(image.Rect(0, 0, 40, 20))); err != nil {
+		t.Fatalf("encoding PNG: %v", err)
+	}
+
+	options := DefaultPDFOptions()
+	options.ImageFetcher = imageFetcher{"https://wanderinginn.com/art/map.png": img.Bytes()}
+	renderer, err := NewPDFRenderer(options)
+	if err != nil {
+		t.Fatalf("NewPDFRenderer() failed: %v", err)
+	}
+
+	doc := Document{
+		Metadata: epub.Metadata{Title: "The Wandering Inn", Author: "pirateaba"},
+		Chapters: []Chapter{
+			{Chapter: models.Chapter{Title: "Prologue"}, Content: "<h1>Prologue</h1><p>Before.</p>"},
+			{
+				Chapter: models.Chapter{Title: "1.00", URL: "https://wanderinginn.com/1-00/", Volume: "Volume 1"},
+				Content: `<h1>1.00</h1><p><em>Italic</em> and <strong class="red">[Skill]</strong></p><img src="/art/map.png" alt="Map"/>`,
+			},
+			{Chapter: models.Chapter{Title: "2.00", Volume: "Volume 2", Book: "Book 1"}, Content: "<h1>2.00</h1><p>After.</p>"},
+		},
+	}
+
+	var b bytes.Buffer
+	if err := renderer.Render(context.Background(), &b, doc); err != nil {
+		t.Fatalf("Render() failed: %v", err)
+	}
+	out := b.String()
+
+	if !strings.HasPrefix(out, "%PDF-") {
+		t.Fatalf("output is not a PDF: %q", out[:min(len(out), 20)])
+	}
+	if !strings.Contains(out, "/Subtype /Image") {
+		t.Error("the image was not embedded")
+	}
+
+	// Bookmarks nest chapters under their volume and book
+	var outline []string
+	for _, match := range regexp.MustCompile(`/Title \(([^)]*)\)\n/Parent (\d+)`).FindAllStringSubmatch(out, -1) {
+		outline = append(outline, match[1])
+	}
+	if got := strings.Join(outline, ","); got != "Prologue,Volume 1,1.00,Volume 2,Book 1,2.00" {
+		t.Errorf("bookmarks = %q", got)
+	}
+	parents := regexp.MustCompile(`/Title \(2\.00\)\n/Parent (\d+) 0 R`).FindStringSubmatch(out)
+	book := regexp.MustCompile(`(\d+) 0 obj\n<</Title \(Book 1\)`).FindStringSubmatch(out)
+	if parents == nil || book == nil || parents[1] != book[1] {
+		t.Error("chapter 2.00 is not nested under Book 1")
+	}
+}
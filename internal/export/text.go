@@ -0,0 +1,191 @@
+package export
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"github.com/linuxswords/wandering-inn/pkg/utils"
+)
+
+// TextOptions control the plain text format.
+type TextOptions struct {
+	// Width is the column paragraphs are wrapped at; 0 disables wrapping.
+	Width int
+	// Emphasis and Strong are put around the text of <em> and <strong>.
+	Emphasis string
+	Strong   string
+}
+
+func DefaultTextOptions() TextOptions {
+	return TextOptions{Width: 72, Emphasis: "_", Strong: "*"}
+}
+
+// TextRenderer writes chapters as wrapped plain text. Chapter titles are
+// underlined with =, other headings with -.
+type TextRenderer struct {
+	options TextOptions
+}
+
+func NewTextRenderer(options TextOptions) *TextRenderer {
+	return &TextRenderer{options: options}
+}
+
+func (r *TextRenderer) Ext() string {
+	return "txt"
+}
+
+func (r *TextRenderer) Render(ctx context.Context, w io.Writer, doc Document) error {
+	var b strings.Builder
+	for i, chapter := range doc.Chapters {
+		if i > 0 {
+			b.WriteString("\n\n")
+		}
+		blocks, err := r.blocks(chapter.Content)
+		if err != nil {
+			return fmt.Errorf("chapter %s: %w", chapter.Title, err)
+		}
+		for j, block := range blocks {
+			if j > 0 {
+				b.WriteString("\n")
+			}
+			b.WriteString(r.format(block))
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// textBlock is a paragraph or heading. Lines holds the text between hard
+// line breaks.
+type textBlock struct {
+	heading int
+	lines   []string
+}
+
+func (r *TextRenderer) format(block textBlock) string {
+	var b strings.Builder
+	if block.heading > 0 {
+		title := strings.Join(block.lines, " ")
+		underline := "-"
+		if block.heading == 1 {
+			underline = "="
+		}
+		b.WriteString(title + "\n" + strings.Repeat(underline, utf8.RuneCountInString(title)) + "\n")
+		return b.String()
+	}
+
+	for _, line := range block.lines {
+		for _, wrapped := range wrap(line, r.options.Width) {
+			b.WriteString(wrapped + "\n")
+		}
+	}
+	return b.String()
+}
+
+// blocks splits chapter HTML into paragraphs and headings, with the inline
+// markup turned into text.
+func (r *TextRenderer) blocks(content string) ([]textBlock, error) {
+	nodes, err := html.ParseFragment(strings.NewReader(content), &html.Node{Type: html.ElementNode, DataAtom: atom.Body, Data: "body"})
+	if err != nil {
+		return nil, err
+	}
+
+	var blocks []textBlock
+	var current strings.Builder
+	heading := 0
+	flush := func() {
+		var lines []string
+		for _, line := range strings.Split(current.String(), "\n") {
+			if line = strings.Join(strings.Fields(line), " "); line != "" {
+				lines = append(lines, line)
+			}
+		}
+		if len(lines) > 0 {
+			blocks = append(blocks, textBlock{heading: heading, lines: lines})
+		}
+		current.Reset()
+		heading = 0
+	}
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			current.WriteString(n.Data)
+			return
+		case html.ElementNode:
+		default:
+			return
+		}
+
+		switch n.DataAtom {
+		case atom.Br:
+			current.WriteString("\n")
+			return
+		case atom.Img:
+			if alt := utils.GetAttr(n, "alt"); alt != "" {
+				current.WriteString("[Image: " + alt + "]")
+			} else {
+				current.WriteString("[Image]")
+			}
+			return
+		case atom.Em, atom.I:
+			current.WriteString(r.options.Emphasis)
+			defer current.WriteString(r.options.Emphasis)
+		case atom.Strong, atom.B:
+			current.WriteString(r.options.Strong)
+			defer current.WriteString(r.options.Strong)
+		case atom.P, atom.Div, atom.Figure, atom.Figcaption:
+			flush()
+			defer flush()
+		case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+			flush()
+			heading = int(n.Data[1] - '0')
+			defer flush()
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	for _, n := range nodes {
+		walk(n)
+	}
+	flush()
+	return blocks, nil
+}
+
+// wrap breaks text into lines of at most width runes at spaces. Words longer
+// than width get a line of their own.
+func wrap(text string, width int) []string {
+	if width <= 0 {
+		return []string{text}
+	}
+
+	var lines []string
+	line, lineWidth := "", 0
+	for _, word := range strings.Fields(text) {
+		wordWidth := utf8.RuneCountInString(word)
+		switch {
+		case line == "":
+			line, lineWidth = word, wordWidth
+		case lineWidth+1+wordWidth <= width:
+			line += " " + word
+			lineWidth += 1 + wordWidth
+		default:
+			lines = append(lines, line)
+			line, lineWidth = word, wordWidth
+		}
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
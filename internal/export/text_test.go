@@ -0,0 +1,96 @@
+package export
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/linuxswords/wandering-inn/internal/models"
+)
+
+func TestWrap(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		width int
+		want  []string
+	}{
+		{name: "short line", text: "a short line", width: 20, want: []string{"a short line"}},
+		{name: "wrapped at spaces", text: "one two three four", width: 9, want: []string{"one two", "three", "four"}},
+		{name: "long word", text: "a supercalifragilistic word", width: 10, want: []string{"a", "supercalifragilistic", "word"}},
+		{name: "counts runes", text: "é é é é", width: 3, want: []string{"é é", "é é"}},
+		{name: "no wrapping", text: "one two three", width: 0, want: []string{"one two three"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := wrap(tt.text, tt.width)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("wrap(%q, %d) = %q, want %q", tt.text, tt.width, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTextRenderer_Render(t *testing.T) {
+	tests := []struct {
+		name    string
+		options TextOptions
+		content []string
+		want    string
+	}{
+		{
+			name:    "title and paragraphs",
+			options: DefaultTextOptions(),
+			content: []string{`<h1>1.00</h1><p>The inn was quiet.</p><p>Erin   waited.</p>`},
+			want:    "1.00\n====\n\nThe inn was quiet.\n\nErin waited.\n",
+		},
+		{
+			name:    "emphasis markers",
+			options: DefaultTextOptions(),
+			content: []string{`<p><em>Skill</em> and <strong class="red">[Level 20!]</strong></p>`},
+			want:    "_Skill_ and *[Level 20!]*\n",
+		},
+		{
+			name:    "custom markers",
+			options: TextOptions{Emphasis: "/", Strong: "**"},
+			content: []string{`<p><em>quiet</em> <strong>loud</strong></p>`},
+			want:    "/quiet/ **loud**\n",
+		},
+		{
+			name:    "wrapping and line breaks",
+			options: TextOptions{Width: 10},
+			content: []string{`<p>one two three<br/>four</p>`},
+			want:    "one two\nthree\nfour\n",
+		},
+		{
+			name:    "subheadings and images",
+			options: DefaultTextOptions(),
+			content: []string{`<h2>Part</h2><figure><img src="a.png" alt="Map"/><figcaption>The map</figcaption></figure>`},
+			want:    "Part\n----\n\n[Image: Map]\n\nThe map\n",
+		},
+		{
+			name:    "several chapters",
+			options: DefaultTextOptions(),
+			content: []string{`<h1>A</h1><p>a</p>`, `<h1>B</h1><p>b</p>`},
+			want:    "A\n=\n\na\n\n\nB\n=\n\nb\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var doc Document
+			for i, content := range tt.content {
+				doc.Chapters = append(doc.Chapters, Chapter{Chapter: models.Chapter{Index: i}, Content: content})
+			}
+
+			var b strings.Builder
+			if err := NewTextRenderer(tt.options).Render(context.Background(), &b, doc); err != nil {
+				t.Fatalf("Render() failed: %v", err)
+			}
+			if b.String() != tt.want {
+				t.Errorf("Render() = %q, want %q", b.String(), tt.want)
+			}
+		})
+	}
+}
@@ -1,7 +1,41 @@
 package models
 
+import "time"
+
 type Chapter struct {
-	Title string
-	URL   string
-	Index int
+	Title  string `json:"title"`
+	URL    string `json:"url"`
+	Index  int    `json:"index"`
+	Volume string `json:"volume,omitempty"`
+	Book   string `json:"book,omitempty"`
+	// Published is when the chapter was posted, if known. Only the feed
+	// carries it.
+	Published time.Time `json:"published,omitzero"`
+}
+
+// Volume groups the chapters listed under one volume heading of the table of
+// contents. Number is 0 when the heading carries no volume number.
+type Volume struct {
+	Title    string    `json:"title"`
+	Number   int       `json:"number"`
+	Chapters []Chapter `json:"chapters"`
+}
+
+// Book groups the chapters of a volume that share a book heading.
+type Book struct {
+	Title    string    `json:"title"`
+	Chapters []Chapter `json:"chapters"`
+}
+
+// Books splits the volume's chapters by their book, in reading order.
+// Chapters without a book form a group with an empty title.
+func (v Volume) Books() []Book {
+	var books []Book
+	for _, chapter := range v.Chapters {
+		if len(books) == 0 || books[len(books)-1].Title != chapter.Book {
+			books = append(books, Book{Title: chapter.Book})
+		}
+		books[len(books)-1].Chapters = append(books[len(books)-1].Chapters, chapter)
+	}
+	return books
 }
@@ -0,0 +1,126 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/linuxswords/wandering-inn/internal/config"
+	"github.com/linuxswords/wandering-inn/internal/models"
+	"github.com/linuxswords/wandering-inn/pkg/utils"
+)
+
+// ErrNotArchived is returned when an offline build asks for a page that was
+// never saved to the archive.
+var ErrNotArchived = errors.New("page is not in the archive")
+
+// Archive is a local store of the table of contents and chapter pages. It
+// serves pages without any network access, for offline builds.
+type Archive struct {
+	dir string
+}
+
+func NewArchive(dir string) *Archive {
+	return &Archive{dir: dir}
+}
+
+// DefaultArchiveDir returns the archive directory below $XDG_DATA_HOME,
+// falling back to ~/.local/share.
+func DefaultArchiveDir() (string, error) {
+	base, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, "archive"), nil
+}
+
+// dataDir returns the directory for data the tool keeps between runs.
+func dataDir() (string, error) {
+	base := os.Getenv("XDG_DATA_HOME")
+	if base == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		base = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(base, config.CacheDirName), nil
+}
+
+func (a *Archive) Dir() string {
+	return a.dir
+}
+
+func (a *Archive) pagePath(url string) string {
+	return filepath.Join(a.dir, "pages", cacheKey(url)+".html")
+}
+
+// Fetch returns the archived page for url, or ErrNotArchived.
+func (a *Archive) Fetch(ctx context.Context, url string) ([]byte, error) {
+	body, err := os.ReadFile(a.pagePath(url))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%s: %w (archive %s)", url, ErrNotArchived, a.dir)
+	}
+	return body, err
+}
+
+func (a *Archive) Has(url string) bool {
+	_, err := os.Stat(a.pagePath(url))
+	return err == nil
+}
+
+// Save downloads url from source and stores it in the archive.
+func (a *Archive) Save(ctx context.Context, source PageFetcher, url string) error {
+	body, err := source.Fetch(ctx, url)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(a.pagePath(url)), 0755); err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(a.pagePath(url), body)
+}
+
+// SaveImages downloads from source the images of an archived chapter that
+// are not archived yet, so offline builds can embed them. It returns how many
+// images were saved; those that could not be downloaded are reported
+// together in the error.
+func (a *Archive) SaveImages(ctx context.Context, source PageFetcher, chapter models.Chapter) (int, error) {
+	archived := NewWanderingInnScraper()
+	archived.SetPageFetcher(a)
+	content, err := archived.FetchChapterContentContext(ctx, chapter.URL, chapter.Title)
+	if err != nil {
+		return 0, err
+	}
+
+	saved := 0
+	var errs []error
+	for _, url := range ImageURLs(content, chapter.URL) {
+		if a.Has(url) {
+			continue
+		}
+		if err := a.Save(ctx, source, url); err != nil {
+			if ctx.Err() != nil {
+				return saved, err
+			}
+			errs = append(errs, fmt.Errorf("image %s: %w", url, err))
+			continue
+		}
+		saved++
+	}
+	return saved, errors.Join(errs...)
+}
+
+// Missing returns the chapters whose pages are not in the archive.
+func (a *Archive) Missing(chapters []models.Chapter) []models.Chapter {
+	var missing []models.Chapter
+	for _, chapter := range chapters {
+		if !a.Has(chapter.URL) {
+			missing = append(missing, chapter)
+		}
+	}
+	return missing
+}
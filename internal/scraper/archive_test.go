@@ -0,0 +1,167 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/linuxswords/wandering-inn/internal/models"
+)
+
+type mapFetcher map[string]string
+
+func (m mapFetcher) Fetch(ctx context.Context, url string) ([]byte, error) {
+	body, ok := m[url]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return []byte(body), nil
+}
+
+func TestArchive_SaveAndFetch(t *testing.T) {
+	archive := NewArchive(t.TempDir())
+	source := mapFetcher{"https://wanderinginn.com/1-00": "<p>Archived</p>"}
+
+	if archive.Has("https://wanderinginn.com/1-00") {
+		t.Error("Has() before Save() = true, want false")
+	}
+
+	if err := archive.Save(context.Background(), source, "https://wanderinginn.com/1-00"); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+
+	if !archive.Has("https://wanderinginn.com/1-00") {
+		t.Error("Has() after Save() = false, want true")
+	}
+
+	body, err := archive.Fetch(context.Background(), "https://wanderinginn.com/1-00")
+	if err != nil {
+		t.Fatalf("Fetch() failed: %v", err)
+	}
+	if string(body) != "<p>Archived</p>" {
+		t.Errorf("Fetch() = %q, want %q", body, "<p>Archived</p>")
+	}
+}
+
+func TestArchive_SaveError(t *testing.T) {
+	archive := NewArchive(t.TempDir())
+	if err := archive.Save(context.Background(), mapFetcher{}, "https://wanderinginn.com/missing"); err == nil {
+		t.Error("Save() with failing source expected error")
+	}
+	if archive.Has("https://wanderinginn.com/missing") {
+		t.Error("failed Save() should not archive anything")
+	}
+}
+
+func TestArchive_FetchMissing(t *testing.T) {
+	archive := NewArchive(t.TempDir())
+
+	_, err := archive.Fetch(context.Background(), "https://wanderinginn.com/1-00")
+	if !errors.Is(err, ErrNotArchived) {
+		t.Errorf("Fetch() of missing page error = %v, want ErrNotArchived", err)
+	}
+}
+
+func TestArchive_Missing(t *testing.T) {
+	archive := NewArchive(t.TempDir())
+	source := mapFetcher{"url1": "<p>1</p>", "url3": "<p>3</p>"}
+	for _, url := range []string{"url1", "url3"} {
+		if err := archive.Save(context.Background(), source, url); err != nil {
+			t.Fatalf("Save(%q) failed: %v", url, err)
+		}
+	}
+
+	missing := archive.Missing([]models.Chapter{
+		{Title: "1", URL: "url1"},
+		{Title: "2", URL: "url2"},
+		{Title: "3", URL: "url3"},
+	})
+
+	if len(missing) != 1 || missing[0].Title != "2" {
+		t.Errorf("Missing() = %+v, want only chapter 2", missing)
+	}
+}
+
+func TestDefaultArchiveDir(t *testing.T) {
+	dataHome := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", dataHome)
+
+	dir, err := DefaultArchiveDir()
+	if err != nil {
+		t.Fatalf("DefaultArchiveDir() failed: %v", err)
+	}
+
+	expected := filepath.Join(dataHome, "wandering-inn", "archive")
+	if dir != expected {
+		t.Errorf("DefaultArchiveDir() = %q, want %q", dir, expected)
+	}
+}
+
+func TestWanderingInnScraper_Offline(t *testing.T) {
+	archive := NewArchive(t.TempDir())
+	source := mapFetcher{
+		"https://wanderinginn.com/table-of-contents/": `<h2>Volume 1</h2><a href="https://wanderinginn.com/1-00">1.00</a>`,
+		"https://wanderinginn.com/1-00":               `<div class="entry-content"><p>Offline chapter</p></div>`,
+	}
+	for url := range source {
+		if err := archive.Save(context.Background(), source, url); err != nil {
+			t.Fatalf("Save(%q) failed: %v", url, err)
+		}
+	}
+
+	scraper := NewWanderingInnScraper()
+	scraper.tocURL = "https://wanderinginn.com/table-of-contents/"
+	scraper.SetPageFetcher(archive)
+
+	chapters, err := scraper.FetchTableOfContents()
+	if err != nil {
+		t.Fatalf("FetchTableOfContents() offline failed: %v", err)
+	}
+	if len(chapters) != 1 || chapters[0].Volume != "Volume 1" {
+		t.Fatalf("FetchTableOfContents() offline = %+v, want one chapter in Volume 1", chapters)
+	}
+
+	content, err := scraper.FetchChapterContent(chapters[0].URL, chapters[0].Title)
+	if err != nil {
+		t.Fatalf("FetchChapterContent() offline failed: %v", err)
+	}
+	if !strings.Contains(content, "Offline chapter") {
+		t.Errorf("FetchChapterContent() offline = %q, want archived content", content)
+	}
+
+	if _, err := scraper.FetchChapterContent("https://wanderinginn.com/1-01", "1.01"); !errors.Is(err, ErrNotArchived) {
+		t.Errorf("FetchChapterContent() of unarchived chapter error = %v, want ErrNotArchived", err)
+	}
+}
+
+func TestArchive_SaveImages(t *testing.T) {
+	archive := NewArchive(t.TempDir())
+	chapter := models.Chapter{Title: "1.00", URL: "https://wanderinginn.com/2017/03/03/1-00/"}
+	source := mapFetcher{
+		chapter.URL: `<div class="entry-content"><p><img src="/art/erin.png"/><img data-src="https://wanderinginn.com/art/erin.png"/>` +
+			`<img src="https://wanderinginn.com/art/missing.png"/></p></div>`,
+		"https://wanderinginn.com/art/erin.png": "PNG",
+	}
+	if err := archive.Save(context.Background(), source, chapter.URL); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+
+	saved, err := archive.SaveImages(context.Background(), source, chapter)
+	if saved != 1 {
+		t.Errorf("SaveImages() saved %d images, want 1", saved)
+	}
+	if err == nil || !strings.Contains(err.Error(), "missing.png") {
+		t.Errorf("SaveImages() error = %v, want the missing image reported", err)
+	}
+	if !archive.Has("https://wanderinginn.com/art/erin.png") {
+		t.Error("image was not archived")
+	}
+
+	// Archived images are not downloaded again
+	delete(source, "https://wanderinginn.com/art/erin.png")
+	if saved, _ := archive.SaveImages(context.Background(), source, chapter); saved != 0 {
+		t.Errorf("SaveImages() of archived images saved %d, want 0", saved)
+	}
+}
@@ -0,0 +1,141 @@
+package scraper
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/linuxswords/wandering-inn/internal/config"
+	"github.com/linuxswords/wandering-inn/pkg/utils"
+)
+
+// ChapterCache keeps the raw HTML of fetched pages on disk and revalidates it
+// with conditional requests, so unchanged chapters are not downloaded again.
+type ChapterCache struct {
+	dir    string
+	client *utils.Client
+}
+
+type cacheEntry struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	FetchedAt    time.Time `json:"fetched_at"`
+}
+
+func NewChapterCache(dir string) *ChapterCache {
+	return &ChapterCache{
+		dir:    dir,
+		client: utils.DefaultClient,
+	}
+}
+
+// DefaultCacheDir returns the chapter cache directory below the user's cache
+// directory ($XDG_CACHE_HOME on Linux).
+func DefaultCacheDir() (string, error) {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, config.CacheDirName, "chapters"), nil
+}
+
+// Fetch returns the raw body of the page at url. Cached pages are revalidated
+// with If-None-Match and If-Modified-Since, and reused on 304.
+func (c *ChapterCache) Fetch(ctx context.Context, url string) ([]byte, error) {
+	key := cacheKey(url)
+	entry, cached := c.load(key)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if entry != nil {
+		if entry.ETag != "" {
+			req.Header.Set("If-None-Match", entry.ETag)
+		}
+		if entry.LastModified != "" {
+			req.Header.Set("If-Modified-Since", entry.LastModified)
+		}
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && entry != nil {
+		return cached, nil
+	}
+	if err := utils.CheckStatus(resp); err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.store(key, &cacheEntry{
+		URL:          url,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		FetchedAt:    time.Now().UTC(),
+	}, body)
+	if err != nil {
+		fmt.Printf("Warning: Failed to cache %s: %v\n", url, err)
+	}
+
+	return body, nil
+}
+
+// load returns the cached entry and body for a key, or nil if either is
+// missing or unreadable.
+func (c *ChapterCache) load(key string) (*cacheEntry, []byte) {
+	meta, err := os.ReadFile(filepath.Join(c.dir, key+".json"))
+	if err != nil {
+		return nil, nil
+	}
+
+	var entry cacheEntry
+	if err := json.Unmarshal(meta, &entry); err != nil {
+		return nil, nil
+	}
+
+	body, err := os.ReadFile(filepath.Join(c.dir, key+".html"))
+	if err != nil {
+		return nil, nil
+	}
+
+	return &entry, body
+}
+
+func (c *ChapterCache) store(key string, entry *cacheEntry, body []byte) error {
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return err
+	}
+
+	meta, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write the body first so a metadata file always has a matching body
+	if err := utils.WriteFileAtomic(filepath.Join(c.dir, key+".html"), body); err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(filepath.Join(c.dir, key+".json"), meta)
+}
+
+func cacheKey(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return hex.EncodeToString(sum[:])
+}
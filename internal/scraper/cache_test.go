@@ -0,0 +1,190 @@
+package scraper
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestChapterCache_RevalidatesWithETag(t *testing.T) {
+	var requests, notModified int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(`<div class="entry-content"><p>Cached chapter</p></div>`))
+	}))
+	defer server.Close()
+
+	cache := NewChapterCache(t.TempDir())
+
+	for i := 0; i < 3; i++ {
+		body, err := cache.Fetch(context.Background(), server.URL)
+		if err != nil {
+			t.Fatalf("Fetch() #%d failed: %v", i+1, err)
+		}
+		if !strings.Contains(string(body), "Cached chapter") {
+			t.Errorf("Fetch() #%d = %q, want the chapter body", i+1, body)
+		}
+	}
+
+	if requests != 3 {
+		t.Errorf("server saw %d requests, want 3", requests)
+	}
+	if notModified != 2 {
+		t.Errorf("server answered %d requests with 304, want 2", notModified)
+	}
+}
+
+func TestChapterCache_RevalidatesWithLastModified(t *testing.T) {
+	const lastModified = "Wed, 21 Oct 2015 07:28:00 GMT"
+
+	var conditional bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-Modified-Since") == lastModified {
+			conditional = true
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Last-Modified", lastModified)
+		w.Write([]byte("<p>Dated chapter</p>"))
+	}))
+	defer server.Close()
+
+	cache := NewChapterCache(t.TempDir())
+	if _, err := cache.Fetch(context.Background(), server.URL); err != nil {
+		t.Fatalf("first Fetch() failed: %v", err)
+	}
+	body, err := cache.Fetch(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("second Fetch() failed: %v", err)
+	}
+
+	if !conditional {
+		t.Error("second Fetch() did not send If-Modified-Since")
+	}
+	if string(body) != "<p>Dated chapter</p>" {
+		t.Errorf("second Fetch() = %q, want cached body", body)
+	}
+}
+
+func TestChapterCache_ReplacesChangedPage(t *testing.T) {
+	version := "v1"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		etag := `"` + version + `"`
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Write([]byte("<p>" + version + "</p>"))
+	}))
+	defer server.Close()
+
+	cache := NewChapterCache(t.TempDir())
+	if _, err := cache.Fetch(context.Background(), server.URL); err != nil {
+		t.Fatalf("Fetch() failed: %v", err)
+	}
+
+	version = "v2"
+	body, err := cache.Fetch(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("Fetch() after change failed: %v", err)
+	}
+	if string(body) != "<p>v2</p>" {
+		t.Errorf("Fetch() after change = %q, want the new body", body)
+	}
+}
+
+func TestChapterCache_ErrorStatusIsNotCached(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "gone", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	cache := NewChapterCache(dir)
+	if _, err := cache.Fetch(context.Background(), server.URL); err == nil {
+		t.Error("Fetch() of a 404 page expected error")
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir() failed: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("cache directory has %d entries after a failed fetch, want 0", len(entries))
+	}
+}
+
+func TestChapterCache_KeyedByURL(t *testing.T) {
+	if cacheKey("https://wanderinginn.com/1-00") == cacheKey("https://wanderinginn.com/1-01") {
+		t.Error("different URLs share a cache key")
+	}
+	if cacheKey("https://wanderinginn.com/1-00") != cacheKey("https://wanderinginn.com/1-00") {
+		t.Error("cache key is not stable")
+	}
+}
+
+func TestDefaultCacheDir(t *testing.T) {
+	cacheHome := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", cacheHome)
+
+	dir, err := DefaultCacheDir()
+	if err != nil {
+		t.Fatalf("DefaultCacheDir() failed: %v", err)
+	}
+
+	expected := filepath.Join(cacheHome, "wandering-inn", "chapters")
+	if runtime.GOOS == "linux" && dir != expected {
+		t.Errorf("DefaultCacheDir() = %q, want %q", dir, expected)
+	}
+}
+
+func TestWanderingInnScraper_FetchChapterContent_UsesCache(t *testing.T) {
+	var fullResponses int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("If-None-Match") != "" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fullResponses++
+		w.Header().Set("ETag", `"chapter"`)
+		w.Write([]byte(`<div class="entry-content"><p>From the cache</p></div>`))
+	}))
+	defer server.Close()
+
+	scraper := NewWanderingInnScraper()
+	scraper.SetPageFetcher(NewChapterCache(t.TempDir()))
+
+	for i := 0; i < 2; i++ {
+		content, err := scraper.FetchChapterContent(server.URL, "Cached")
+		if err != nil {
+			t.Fatalf("FetchChapterContent() failed: %v", err)
+		}
+		if !strings.Contains(content, "From the cache") {
+			t.Errorf("FetchChapterContent() = %q, want chapter content", content)
+		}
+	}
+
+	if fullResponses != 1 {
+		t.Errorf("server sent the full page %d times, want 1", fullResponses)
+	}
+}
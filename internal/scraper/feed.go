@@ -0,0 +1,211 @@
+package scraper
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/linuxswords/wandering-inn/internal/config"
+	"github.com/linuxswords/wandering-inn/internal/models"
+	"golang.org/x/net/html"
+)
+
+// FeedEntry is a chapter announced in the site's feed. Content holds the full
+// chapter HTML if the feed includes it.
+type FeedEntry struct {
+	Chapter models.Chapter
+	Content string
+}
+
+type rssFeed struct {
+	Items []struct {
+		Title   string `xml:"title"`
+		Link    string `xml:"link"`
+		PubDate string `xml:"pubDate"`
+		Content string `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	} `xml:"channel>item"`
+}
+
+type atomFeed struct {
+	Entries []struct {
+		Title string `xml:"title"`
+		Links []struct {
+			Href string `xml:"href,attr"`
+			Rel  string `xml:"rel,attr"`
+		} `xml:"link"`
+		Published string `xml:"published"`
+		Updated   string `xml:"updated"`
+		Content   string `xml:"content"`
+	} `xml:"entry"`
+}
+
+// ParseFeed reads an RSS 2.0 or Atom feed and returns its chapter entries in
+// reading order, oldest first. Posts that are not chapters are left out.
+// Chapters from the feed have no Index, Volume or Book.
+func ParseFeed(data []byte) ([]FeedEntry, error) {
+	var root struct {
+		XMLName xml.Name
+	}
+	if err := decodeFeed(data, &root); err != nil {
+		return nil, err
+	}
+
+	var entries []FeedEntry
+	switch root.XMLName.Local {
+	case "rss":
+		var feed rssFeed
+		if err := decodeFeed(data, &feed); err != nil {
+			return nil, err
+		}
+		for _, item := range feed.Items {
+			published, _ := parseFeedTime(item.PubDate, time.RFC1123Z, time.RFC1123)
+			entries = append(entries, feedEntry(item.Title, item.Link, published, item.Content))
+		}
+	case "feed":
+		var feed atomFeed
+		if err := decodeFeed(data, &feed); err != nil {
+			return nil, err
+		}
+		for _, entry := range feed.Entries {
+			var link string
+			for _, l := range entry.Links {
+				if l.Rel == "" || l.Rel == "alternate" {
+					link = l.Href
+					break
+				}
+			}
+			published, err := parseFeedTime(entry.Published, time.RFC3339)
+			if err != nil {
+				published, _ = parseFeedTime(entry.Updated, time.RFC3339)
+			}
+			entries = append(entries, feedEntry(entry.Title, link, published, entry.Content))
+		}
+	default:
+		return nil, fmt.Errorf("not an RSS or Atom feed: <%s>", root.XMLName.Local)
+	}
+
+	chapters := entries[:0]
+	for _, entry := range entries {
+		if entry.Chapter.URL != "" && isChapterTitle(entry.Chapter.Title) {
+			chapters = append(chapters, entry)
+		}
+	}
+
+	// Feeds list the newest post first
+	slices.Reverse(chapters)
+	return chapters, nil
+}
+
+func feedEntry(title, link string, published time.Time, content string) FeedEntry {
+	return FeedEntry{
+		Chapter: models.Chapter{
+			Title:     strings.TrimSpace(title),
+			URL:       strings.TrimSpace(link),
+			Published: published,
+		},
+		Content: strings.TrimSpace(content),
+	}
+}
+
+func decodeFeed(data []byte, v interface{}) error {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+	decoder.Entity = xml.HTMLEntity
+
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("parsing feed: %w", err)
+	}
+	return nil
+}
+
+func parseFeedTime(value string, layouts ...string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	var lastErr error
+	for _, layout := range layouts {
+		t, err := time.Parse(layout, value)
+		if err == nil {
+			return t, nil
+		}
+		lastErr = err
+	}
+	return time.Time{}, lastErr
+}
+
+// FetchFeedContext downloads the site's feed and returns the chapters it
+// announces, oldest first. With SetFeedContent enabled, the chapter text the
+// feed carries is kept for FetchChapterContent.
+func (s *WanderingInnScraper) FetchFeedContext(ctx context.Context) ([]models.Chapter, error) {
+	body, err := s.pages.Fetch(ctx, s.feedURL)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := ParseFeed(body)
+	if err != nil {
+		return nil, err
+	}
+
+	chapters := make([]models.Chapter, len(entries))
+	for i, entry := range entries {
+		chapters[i] = entry.Chapter
+	}
+
+	if s.useFeedContent {
+		s.mu.Lock()
+		for _, entry := range entries {
+			if entry.Content != "" {
+				s.feedContent[urlKey(entry.Chapter.URL)] = entry.Content
+			}
+		}
+		s.mu.Unlock()
+	}
+	return chapters, nil
+}
+
+// FetchLatestChaptersContext returns the most recent chapters. They come from
+// the feed, which is far smaller than the table of contents; if the feed
+// cannot be fetched or lists no chapters, the last
+// config.LatestChaptersCount chapters of the table of contents are returned
+// instead.
+func (s *WanderingInnScraper) FetchLatestChaptersContext(ctx context.Context) ([]models.Chapter, error) {
+	chapters, err := s.FetchFeedContext(ctx)
+	if err == nil && len(chapters) > 0 {
+		return chapters, nil
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	chapters, err = s.FetchTableOfContentsContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return chapters[max(0, len(chapters)-config.LatestChaptersCount):], nil
+}
+
+// feedChapter returns the chapter HTML for url from the last feed fetched,
+// if the feed carried its full text.
+func (s *WanderingInnScraper) feedChapter(url, title string) string {
+	s.mu.Lock()
+	content, ok := s.feedContent[urlKey(url)]
+	s.mu.Unlock()
+	if !ok {
+		return ""
+	}
+
+	doc, err := html.Parse(strings.NewReader(`<div class="entry-content">` + content + `</div>`))
+	if err != nil {
+		return ""
+	}
+	return NewHTMLParser().ExtractChapterHTML(doc, title)
+}
+
+// urlKey normalises a chapter URL for lookups, since the feed and the table
+// of contents do not always agree on the trailing slash.
+func urlKey(url string) string {
+	return strings.TrimSuffix(url, "/")
+}
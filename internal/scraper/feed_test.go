@@ -0,0 +1,172 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/linuxswords/wandering-inn/internal/config"
+)
+
+const testRSS = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:content="http://purl.org/rss/1.0/modules/content/">
+<channel>
+	<title>The Wandering Inn</title>
+	<item>
+		<title>10.02</title>
+		<link>https://wanderinginn.com/2024/05/08/10-02/</link>
+		<pubDate>Wed, 08 May 2024 01:00:00 +0000</pubDate>
+		<content:encoded><![CDATA[<p>Erin woke up.</p>]]></content:encoded>
+	</item>
+	<item>
+		<title>Patreon update &#8211; May</title>
+		<link>https://wanderinginn.com/2024/05/05/patreon-update/</link>
+		<pubDate>Sun, 05 May 2024 01:00:00 +0000</pubDate>
+	</item>
+	<item>
+		<title>10.01</title>
+		<link>https://wanderinginn.com/2024/05/01/10-01/</link>
+		<pubDate>Wed, 01 May 2024 01:00:00 +0000</pubDate>
+	</item>
+</channel>
+</rss>`
+
+const testAtom = `<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+	<title>The Wandering Inn</title>
+	<entry>
+		<title type="html">Interlude &#8211; Pawn</title>
+		<link rel="replies" href="https://wanderinginn.com/2024/05/08/interlude-pawn/#comments"/>
+		<link rel="alternate" href="https://wanderinginn.com/2024/05/08/interlude-pawn/"/>
+		<published>2024-05-08T01:00:00Z</published>
+		<content type="html">&lt;p&gt;Pawn prayed.&lt;/p&gt;</content>
+	</entry>
+	<entry>
+		<title>10.01</title>
+		<link href="https://wanderinginn.com/2024/05/01/10-01/"/>
+		<updated>2024-05-01T01:00:00Z</updated>
+	</entry>
+</feed>`
+
+func TestParseFeed(t *testing.T) {
+	tests := []struct {
+		name      string
+		feed      string
+		titles    []string
+		urls      []string
+		published time.Time
+		content   string
+	}{
+		{
+			name:      "rss",
+			feed:      testRSS,
+			titles:    []string{"10.01", "10.02"},
+			urls:      []string{"https://wanderinginn.com/2024/05/01/10-01/", "https://wanderinginn.com/2024/05/08/10-02/"},
+			published: time.Date(2024, 5, 8, 1, 0, 0, 0, time.UTC),
+			content:   "<p>Erin woke up.</p>",
+		},
+		{
+			name:      "atom",
+			feed:      testAtom,
+			titles:    []string{"10.01", "Interlude – Pawn"},
+			urls:      []string{"https://wanderinginn.com/2024/05/01/10-01/", "https://wanderinginn.com/2024/05/08/interlude-pawn/"},
+			published: time.Date(2024, 5, 8, 1, 0, 0, 0, time.UTC),
+			content:   "<p>Pawn prayed.</p>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := ParseFeed([]byte(tt.feed))
+			if err != nil {
+				t.Fatalf("ParseFeed() failed: %v", err)
+			}
+			if len(entries) != len(tt.titles) {
+				t.Fatalf("ParseFeed() returned %d entries, want %d", len(entries), len(tt.titles))
+			}
+			for i, entry := range entries {
+				if entry.Chapter.Title != tt.titles[i] || entry.Chapter.URL != tt.urls[i] {
+					t.Errorf("entry %d = %q %q, want %q %q", i, entry.Chapter.Title, entry.Chapter.URL, tt.titles[i], tt.urls[i])
+				}
+			}
+
+			last := entries[len(entries)-1]
+			if !last.Chapter.Published.Equal(tt.published) {
+				t.Errorf("Published = %v, want %v", last.Chapter.Published, tt.published)
+			}
+			if last.Content != tt.content {
+				t.Errorf("Content = %q, want %q", last.Content, tt.content)
+			}
+			if entries[0].Content != "" {
+				t.Errorf("Content of entry without text = %q, want empty", entries[0].Content)
+			}
+		})
+	}
+}
+
+func TestParseFeed_Invalid(t *testing.T) {
+	for _, body := range []string{"<html><body>Not a feed</body></html>", "not xml at all"} {
+		if _, err := ParseFeed([]byte(body)); err == nil {
+			t.Errorf("ParseFeed(%q) succeeded, want an error", body)
+		}
+	}
+}
+
+func TestWanderingInnScraper_FetchLatestChapters(t *testing.T) {
+	scraper := NewWanderingInnScraper()
+	scraper.SetPageFetcher(mapFetcher{config.FeedURL: testRSS})
+
+	chapters, err := scraper.FetchLatestChaptersContext(context.Background())
+	if err != nil {
+		t.Fatalf("FetchLatestChaptersContext() failed: %v", err)
+	}
+	if len(chapters) != 2 || chapters[1].Title != "10.02" {
+		t.Errorf("FetchLatestChaptersContext() = %v, want 10.01 and 10.02 from the feed", chapters)
+	}
+}
+
+func TestWanderingInnScraper_FetchLatestChapters_FallsBackToTOC(t *testing.T) {
+	var toc strings.Builder
+	for i := range config.LatestChaptersCount + 5 {
+		fmt.Fprintf(&toc, `<a href="https://wanderinginn.com/1-%02d/">1.%02d</a>`, i, i)
+	}
+
+	scraper := NewWanderingInnScraper()
+	scraper.SetPageFetcher(mapFetcher{config.TOCUrl: toc.String()})
+
+	chapters, err := scraper.FetchLatestChaptersContext(context.Background())
+	if err != nil {
+		t.Fatalf("FetchLatestChaptersContext() failed: %v", err)
+	}
+	if len(chapters) != config.LatestChaptersCount {
+		t.Fatalf("got %d chapters, want %d", len(chapters), config.LatestChaptersCount)
+	}
+	if chapters[0].Index != 5 {
+		t.Errorf("first chapter has index %d, want 5", chapters[0].Index)
+	}
+}
+
+func TestWanderingInnScraper_FetchChapterContent_FromFeed(t *testing.T) {
+	scraper := NewWanderingInnScraper()
+	scraper.SetPageFetcher(mapFetcher{config.FeedURL: testRSS})
+	scraper.SetFeedContent(true)
+
+	if _, err := scraper.FetchFeedContext(context.Background()); err != nil {
+		t.Fatalf("FetchFeedContext() failed: %v", err)
+	}
+
+	// The chapter page itself is not available, so this only works from the feed
+	content, err := scraper.FetchChapterContent("https://wanderinginn.com/2024/05/08/10-02", "10.02")
+	if err != nil {
+		t.Fatalf("FetchChapterContent() failed: %v", err)
+	}
+	if !strings.Contains(content, "<h1>10.02</h1>") || !strings.Contains(content, "Erin woke up.") {
+		t.Errorf("FetchChapterContent() = %q, want the chapter text from the feed", content)
+	}
+
+	if _, err := scraper.FetchChapterContent("https://wanderinginn.com/2024/05/01/10-01/", "10.01"); err == nil {
+		t.Error("FetchChapterContent() for a chapter without feed text succeeded, want the page fetch to fail")
+	}
+}
@@ -2,7 +2,9 @@ package scraper
 
 import (
 	"fmt"
+	"net/url"
 	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/linuxswords/wandering-inn/internal/config"
@@ -67,6 +69,12 @@ func (p *HTMLParser) extractHTMLContent(n *html.Node) string {
 			return p.handleHeading(n)
 		case "a":
 			return p.handleAnchor(n)
+		case "img":
+			return p.handleImage(n)
+		case "picture":
+			return p.handlePicture(n)
+		case "figure", "figcaption":
+			return p.handleFigure(n)
 		}
 	}
 
@@ -172,6 +180,117 @@ func (p *HTMLParser) handleAnchor(n *html.Node) string {
 	return content
 }
 
+// handleImage keeps an image with its source URL and alt text. Lazy-loaded
+// images carry the real URL in a data attribute instead of src.
+func (p *HTMLParser) handleImage(n *html.Node) string {
+	src := imageSource(n)
+	if src == "" {
+		return ""
+	}
+	return fmt.Sprintf(`<img src="%s" alt="%s"/>`, html.EscapeString(src), html.EscapeString(utils.GetAttr(n, "alt")))
+}
+
+// ImageURLs returns the absolute URLs of the images in chapter content, as
+// returned by FetchChapterContent for the page at pageURL, without
+// duplicates.
+func ImageURLs(content, pageURL string) []string {
+	doc, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		return nil
+	}
+
+	var urls []string
+	var find func(*html.Node)
+	find = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "img" {
+			if src := utils.GetAttr(n, "src"); src != "" {
+				if resolved := ResolveImageURL(pageURL, src); !slices.Contains(urls, resolved) {
+					urls = append(urls, resolved)
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			find(c)
+		}
+	}
+	find(doc)
+	return urls
+}
+
+// ResolveImageURL returns the absolute URL of an image source found on the
+// page at pageURL.
+func ResolveImageURL(pageURL, src string) string {
+	base, err := url.Parse(pageURL)
+	if err != nil || pageURL == "" {
+		return src
+	}
+	ref, err := url.Parse(src)
+	if err != nil {
+		return src
+	}
+	return base.ResolveReference(ref).String()
+}
+
+func imageSource(n *html.Node) string {
+	for _, attr := range config.ImageSourceAttrs {
+		if src := strings.TrimSpace(utils.GetAttr(n, attr)); src != "" && !strings.HasPrefix(src, "data:") {
+			return src
+		}
+	}
+	return ""
+}
+
+// handlePicture reduces a <picture> to its fallback <img>, or to the first
+// candidate of its first <source> if the fallback has no usable source.
+func (p *HTMLParser) handlePicture(n *html.Node) string {
+	var img, source *html.Node
+	var find func(*html.Node)
+	find = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.ElementNode && c.Data == "img" && img == nil {
+				img = c
+			}
+			if c.Type == html.ElementNode && c.Data == "source" && source == nil {
+				source = c
+			}
+			find(c)
+		}
+	}
+	find(n)
+
+	alt := ""
+	if img != nil {
+		if content := p.handleImage(img); content != "" {
+			return content
+		}
+		alt = utils.GetAttr(img, "alt")
+	}
+	if source == nil {
+		return ""
+	}
+
+	candidates := strings.Fields(utils.GetAttr(source, "srcset"))
+	if len(candidates) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(`<img src="%s" alt="%s"/>`, html.EscapeString(strings.TrimSuffix(candidates[0], ",")), html.EscapeString(alt))
+}
+
+func (p *HTMLParser) handleFigure(n *html.Node) string {
+	var content string
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		content += p.extractHTMLContent(c)
+	}
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return ""
+	}
+	if n.Data == "figure" {
+		return fmt.Sprintf("<figure>%s</figure>\n", content)
+	}
+	return fmt.Sprintf("<figcaption>%s</figcaption>", content)
+}
+
 func (p *HTMLParser) isNavigationText(text string) bool {
 	text = strings.ToLower(strings.TrimSpace(text))
 
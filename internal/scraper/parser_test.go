@@ -430,3 +430,56 @@ func TestHTMLParser_handleParagraph(t *testing.T) {
 		})
 	}
 }
+
+func TestHTMLParser_Images(t *testing.T) {
+	tests := []struct {
+		name     string
+		htmlStr  string
+		expected string
+	}{
+		{
+			name:     "plain image",
+			htmlStr:  `<img src="https://wanderinginn.com/art/erin.png" alt="Erin &amp; Mrsha">`,
+			expected: `<img src="https://wanderinginn.com/art/erin.png" alt="Erin &amp; Mrsha"/>`,
+		},
+		{
+			name:     "lazy-loaded image",
+			htmlStr:  `<img src="data:image/gif;base64,R0lGOD" data-lazy-src="https://wanderinginn.com/art/pawn.jpg">`,
+			expected: `<img src="https://wanderinginn.com/art/pawn.jpg" alt=""/>`,
+		},
+		{
+			name:     "image without source",
+			htmlStr:  `<img alt="missing">`,
+			expected: "",
+		},
+		{
+			name:     "figure with caption",
+			htmlStr:  `<figure class="wp-block-image"><img src="/art/inn.png" alt="The inn"><figcaption>Art by <em>someone</em></figcaption></figure>`,
+			expected: "<figure><img src=\"/art/inn.png\" alt=\"The inn\"/><figcaption>Art by <em>someone</em></figcaption></figure>\n",
+		},
+		{
+			name:     "picture with fallback image",
+			htmlStr:  `<picture><source srcset="/art/a.webp 1x, /art/a@2x.webp 2x" type="image/webp"><img src="/art/a.jpg" alt="A"></picture>`,
+			expected: `<img src="/art/a.jpg" alt="A"/>`,
+		},
+		{
+			name:     "picture with only sources",
+			htmlStr:  `<picture><source srcset="/art/b.webp 1x, /art/b@2x.webp 2x"><img alt="B"></picture>`,
+			expected: `<img src="/art/b.webp" alt="B"/>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := html.Parse(strings.NewReader(`<div class="entry-content">` + tt.htmlStr + `</div>`))
+			if err != nil {
+				t.Fatalf("Failed to parse HTML: %v", err)
+			}
+
+			result := NewHTMLParser().ExtractChapterHTML(doc, "1.00")
+			if want := "<h1>1.00</h1>\n" + tt.expected; result != want {
+				t.Errorf("ExtractChapterHTML() = %q, want %q", result, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package scraper
+
+import (
+	"context"
+	"sync"
+
+	"github.com/linuxswords/wandering-inn/internal/models"
+)
+
+// ChapterFetcher downloads the content of a single chapter. Implementations
+// passed to FetchChapters must be safe for concurrent use.
+type ChapterFetcher interface {
+	FetchChapterContent(url, title string) (string, error)
+}
+
+// ContextChapterFetcher is a ChapterFetcher whose downloads can be cancelled.
+type ContextChapterFetcher interface {
+	FetchChapterContentContext(ctx context.Context, url, title string) (string, error)
+}
+
+// ChapterResult is the outcome of fetching one chapter.
+type ChapterResult struct {
+	Chapter models.Chapter
+	Content string
+	Err     error
+}
+
+// FetchChapters downloads chapters with up to concurrency requests in flight.
+// Results are returned in the order of chapters, whatever order the downloads
+// finish in. progress, if set, is called once per finished chapter with the
+// number of chapters done so far; calls never overlap.
+//
+// Once ctx is done no further chapters are started; their results carry the
+// context's error. Fetchers that implement ContextChapterFetcher are also
+// interrupted mid-download.
+func FetchChapters(ctx context.Context, fetcher ChapterFetcher, chapters []models.Chapter, concurrency int, progress func(done, total int, title string)) []ChapterResult {
+	results := make([]ChapterResult, len(chapters))
+	concurrency = max(1, min(concurrency, len(chapters)))
+
+	fetch := fetcher.FetchChapterContent
+	if contextFetcher, ok := fetcher.(ContextChapterFetcher); ok {
+		fetch = func(url, title string) (string, error) {
+			return contextFetcher.FetchChapterContentContext(ctx, url, title)
+		}
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	done := 0
+
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				chapter := chapters[i]
+				content, err := fetch(chapter.URL, chapter.Title)
+				results[i] = ChapterResult{Chapter: chapter, Content: content, Err: err}
+
+				if progress != nil && ctx.Err() == nil {
+					mu.Lock()
+					done++
+					progress(done, len(chapters), chapter.Title)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	next := 0
+dispatch:
+	for ; next < len(chapters) && ctx.Err() == nil; next++ {
+		select {
+		case jobs <- next:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	for i := next; i < len(chapters); i++ {
+		results[i] = ChapterResult{Chapter: chapters[i], Err: ctx.Err()}
+	}
+	return results
+}
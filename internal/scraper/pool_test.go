@@ -0,0 +1,175 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/linuxswords/wandering-inn/internal/models"
+)
+
+// slowFetcher answers later chapters first and records how many requests
+// were in flight at once.
+type slowFetcher struct {
+	inFlight    atomic.Int32
+	maxInFlight atomic.Int32
+	fail        string
+}
+
+func (f *slowFetcher) FetchChapterContent(url, title string) (string, error) {
+	n := f.inFlight.Add(1)
+	defer f.inFlight.Add(-1)
+	for {
+		current := f.maxInFlight.Load()
+		if n <= current || f.maxInFlight.CompareAndSwap(current, n) {
+			break
+		}
+	}
+
+	var index int
+	fmt.Sscanf(url, "url%d", &index)
+	time.Sleep(time.Duration(10-index) * time.Millisecond)
+
+	if url == f.fail {
+		return "", errors.New("fetch failed")
+	}
+	return "content " + title, nil
+}
+
+func testChapters(n int) []models.Chapter {
+	chapters := make([]models.Chapter, n)
+	for i := range chapters {
+		chapters[i] = models.Chapter{Title: fmt.Sprintf("%d.00", i), URL: fmt.Sprintf("url%d", i), Index: i}
+	}
+	return chapters
+}
+
+func TestFetchChapters(t *testing.T) {
+	tests := []struct {
+		name        string
+		concurrency int
+		maxInFlight int32
+	}{
+		{"sequential", 1, 1},
+		{"parallel", 4, 4},
+		{"more workers than chapters", 20, 8},
+		{"zero means sequential", 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fetcher := &slowFetcher{fail: "url3"}
+			chapters := testChapters(8)
+
+			var mu sync.Mutex
+			var counts []int
+			progress := func(done, total int, title string) {
+				mu.Lock()
+				defer mu.Unlock()
+				if total != len(chapters) {
+					t.Errorf("progress total = %d, want %d", total, len(chapters))
+				}
+				counts = append(counts, done)
+			}
+
+			results := FetchChapters(context.Background(), fetcher, chapters, tt.concurrency, progress)
+
+			if len(results) != len(chapters) {
+				t.Fatalf("FetchChapters() returned %d results, want %d", len(results), len(chapters))
+			}
+			for i, result := range results {
+				if result.Chapter.Index != i {
+					t.Errorf("results[%d] is chapter %d, want results in chapter order", i, result.Chapter.Index)
+				}
+				if i == 3 {
+					if result.Err == nil {
+						t.Errorf("results[3] expected error")
+					}
+					continue
+				}
+				if result.Err != nil || result.Content != "content "+chapters[i].Title {
+					t.Errorf("results[%d] = (%q, %v), want content of %s", i, result.Content, result.Err, chapters[i].Title)
+				}
+			}
+
+			for i, done := range counts {
+				if done != i+1 {
+					t.Errorf("progress counts = %v, want 1..%d in order", counts, len(chapters))
+					break
+				}
+			}
+			if len(counts) != len(chapters) {
+				t.Errorf("progress called %d times, want %d", len(counts), len(chapters))
+			}
+
+			if got := fetcher.maxInFlight.Load(); got > tt.maxInFlight {
+				t.Errorf("%d requests in flight, want at most %d", got, tt.maxInFlight)
+			}
+		})
+	}
+}
+
+func TestFetchChapters_Empty(t *testing.T) {
+	results := FetchChapters(context.Background(), &slowFetcher{}, nil, 4, nil)
+	if len(results) != 0 {
+		t.Errorf("FetchChapters() of no chapters = %v, want empty", results)
+	}
+}
+
+// blockingFetcher returns the first chapters right away and blocks the rest
+// until the context is cancelled.
+type blockingFetcher struct {
+	ready int
+}
+
+func (f *blockingFetcher) FetchChapterContent(url, title string) (string, error) {
+	return f.FetchChapterContentContext(context.Background(), url, title)
+}
+
+func (f *blockingFetcher) FetchChapterContentContext(ctx context.Context, url, title string) (string, error) {
+	var index int
+	fmt.Sscanf(url, "url%d", &index)
+	if index < f.ready {
+		return "content " + title, nil
+	}
+	<-ctx.Done()
+	return "", ctx.Err()
+}
+
+func TestFetchChapters_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	chapters := testChapters(10)
+	var calls int
+	progress := func(done, total int, title string) {
+		calls++
+		if done == 3 {
+			cancel()
+		}
+	}
+
+	results := FetchChapters(ctx, &blockingFetcher{ready: 3}, chapters, 1, progress)
+
+	if len(results) != len(chapters) {
+		t.Fatalf("FetchChapters() returned %d results, want %d", len(results), len(chapters))
+	}
+	for i, result := range results {
+		if result.Chapter.Index != i {
+			t.Errorf("results[%d] is chapter %d, want results in chapter order", i, result.Chapter.Index)
+		}
+		if i < 3 && result.Err != nil {
+			t.Errorf("results[%d] error = %v, want finished chapter", i, result.Err)
+		}
+		if i >= 3 && !errors.Is(result.Err, context.Canceled) {
+			t.Errorf("results[%d] error = %v, want context.Canceled", i, result.Err)
+		}
+	}
+	if calls != 3 {
+		t.Errorf("progress called %d times, want 3", calls)
+	}
+}
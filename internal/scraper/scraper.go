@@ -1,8 +1,14 @@
 package scraper
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/linuxswords/wandering-inn/internal/config"
 	"github.com/linuxswords/wandering-inn/internal/models"
@@ -10,28 +16,121 @@ import (
 	"golang.org/x/net/html"
 )
 
+// ErrNoContent is returned for chapter pages without a chapter body, such as
+// error or challenge pages served with 200 OK. A chapter whose body is
+// present but empty is not an error.
+var ErrNoContent = errors.New("no chapter content on page")
+
 type Scraper interface {
 	FetchTableOfContents() ([]models.Chapter, error)
 	FetchChapterContent(url, title string) (string, error)
 }
 
-type WanderingInnScraper struct{}
+// ContextScraper is a Scraper whose downloads can be cancelled.
+type ContextScraper interface {
+	Scraper
+	FetchTableOfContentsContext(ctx context.Context) ([]models.Chapter, error)
+	FetchChapterContentContext(ctx context.Context, url, title string) (string, error)
+}
+
+// PageFetcher returns the raw HTML of a page. Pages come straight from the
+// site by default, but can also be served from the on-disk cache or a local
+// archive.
+type PageFetcher interface {
+	Fetch(ctx context.Context, url string) ([]byte, error)
+}
+
+// HTTPFetcher downloads pages directly from the site.
+type HTTPFetcher struct{}
+
+func (HTTPFetcher) Fetch(ctx context.Context, url string) ([]byte, error) {
+	return utils.FetchContext(ctx, url)
+}
+
+type WanderingInnScraper struct {
+	tocURL         string
+	feedURL        string
+	pages          PageFetcher
+	useFeedContent bool
+
+	mu          sync.Mutex
+	feedContent map[string]string
+}
 
 func NewWanderingInnScraper() *WanderingInnScraper {
-	return &WanderingInnScraper{}
+	return &WanderingInnScraper{
+		tocURL:      config.TOCUrl,
+		feedURL:     config.FeedURL,
+		pages:       HTTPFetcher{},
+		feedContent: make(map[string]string),
+	}
+}
+
+// SetPageFetcher changes where the table of contents and chapter pages come
+// from. A nil fetcher goes straight to the site.
+func (s *WanderingInnScraper) SetPageFetcher(pages PageFetcher) {
+	if pages == nil {
+		pages = HTTPFetcher{}
+	}
+	s.pages = pages
+}
+
+// SetFeedContent makes FetchChapterContent use the chapter text included in
+// the feed, when the chapter was in the last feed fetched, instead of
+// downloading the chapter page.
+func (s *WanderingInnScraper) SetFeedContent(enabled bool) {
+	s.useFeedContent = enabled
+}
+
+func (s *WanderingInnScraper) fetchAndParse(ctx context.Context, url string) (*html.Node, error) {
+	body, err := s.pages.Fetch(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return html.Parse(bytes.NewReader(body))
 }
 
 func (s *WanderingInnScraper) FetchTableOfContents() ([]models.Chapter, error) {
-	doc, err := utils.FetchAndParse(config.TOCUrl)
+	return s.FetchTableOfContentsContext(context.Background())
+}
+
+func (s *WanderingInnScraper) FetchTableOfContentsContext(ctx context.Context) ([]models.Chapter, error) {
+	doc, err := s.fetchAndParse(ctx, s.tocURL)
 	if err != nil {
 		return nil, err
 	}
 
+	return s.parseTableOfContents(doc), nil
+}
+
+// FetchVolumes returns the table of contents grouped by volume.
+func (s *WanderingInnScraper) FetchVolumes() ([]models.Volume, error) {
+	chapters, err := s.FetchTableOfContents()
+	if err != nil {
+		return nil, err
+	}
+
+	return GroupByVolume(chapters), nil
+}
+
+func (s *WanderingInnScraper) parseTableOfContents(doc *html.Node) []models.Chapter {
 	var chapters []models.Chapter
 	chapterIndex := 0
+	volume, book := "", ""
 
 	var findChapters func(*html.Node)
 	findChapters = func(n *html.Node) {
+		if heading := s.headingText(n); heading != "" {
+			if config.VolumePattern.MatchString(heading) {
+				volume, book = heading, ""
+				return
+			}
+			if config.BookPattern.MatchString(heading) {
+				book = heading
+				return
+			}
+		}
+
 		if n.Type == html.ElementNode && n.Data == "a" {
 			href := utils.GetAttr(n, "href")
 			if href != "" && strings.Contains(href, "wanderinginn.com") &&
@@ -39,9 +138,11 @@ func (s *WanderingInnScraper) FetchTableOfContents() ([]models.Chapter, error) {
 				title := utils.ExtractText(n)
 				if title != "" && s.isChapterLink(title, href) {
 					chapters = append(chapters, models.Chapter{
-						Title: strings.TrimSpace(title),
-						URL:   href,
-						Index: chapterIndex,
+						Title:  strings.TrimSpace(title),
+						URL:    href,
+						Index:  chapterIndex,
+						Volume: volume,
+						Book:   book,
 					})
 					chapterIndex++
 				}
@@ -58,20 +159,89 @@ func (s *WanderingInnScraper) FetchTableOfContents() ([]models.Chapter, error) {
 		return chapters[i].Index < chapters[j].Index
 	})
 
-	return chapters, nil
+	return chapters
 }
 
 func (s *WanderingInnScraper) FetchChapterContent(url, title string) (string, error) {
-	doc, err := utils.FetchAndParse(url)
+	return s.FetchChapterContentContext(context.Background(), url, title)
+}
+
+func (s *WanderingInnScraper) FetchChapterContentContext(ctx context.Context, url, title string) (string, error) {
+	if content := s.feedChapter(url, title); content != "" {
+		return content, nil
+	}
+
+	doc, err := s.fetchAndParse(ctx, url)
 	if err != nil {
 		return "", err
 	}
 
 	parser := NewHTMLParser()
 	content := parser.ExtractChapterHTML(doc, title)
+	if content == "" {
+		return "", fmt.Errorf("%s: %w", url, ErrNoContent)
+	}
 	return content, nil
 }
 
 func (s *WanderingInnScraper) isChapterLink(title, href string) bool {
+	return isChapterTitle(title)
+}
+
+func isChapterTitle(title string) bool {
 	return config.ChapterPattern.MatchString(title) && !strings.Contains(strings.ToLower(title), "table of contents")
 }
+
+// headingText returns the normalised text of a heading element, or "" if the
+// node is not a heading. Besides <h1>-<h6>, elements whose class marks them
+// as a title or header count as headings.
+func (s *WanderingInnScraper) headingText(n *html.Node) string {
+	if n.Type != html.ElementNode {
+		return ""
+	}
+
+	isHeading := len(n.Data) == 2 && n.Data[0] == 'h' && n.Data[1] >= '1' && n.Data[1] <= '6'
+	if !isHeading {
+		class := strings.ToLower(utils.GetAttr(n, "class"))
+		for _, headingClass := range config.HeadingClasses {
+			if strings.Contains(class, headingClass) {
+				isHeading = true
+				break
+			}
+		}
+	}
+	if !isHeading {
+		return ""
+	}
+
+	text := strings.Join(strings.Fields(utils.ExtractText(n)), " ")
+	if len(text) > 100 {
+		return ""
+	}
+	return text
+}
+
+// GroupByVolume builds the volume tree from a flat, ordered chapter list.
+// Consecutive chapters with the same volume end up in the same Volume.
+func GroupByVolume(chapters []models.Chapter) []models.Volume {
+	var volumes []models.Volume
+	for _, chapter := range chapters {
+		if len(volumes) == 0 || volumes[len(volumes)-1].Title != chapter.Volume {
+			volumes = append(volumes, models.Volume{
+				Title:  chapter.Volume,
+				Number: volumeNumber(chapter.Volume),
+			})
+		}
+		volumes[len(volumes)-1].Chapters = append(volumes[len(volumes)-1].Chapters, chapter)
+	}
+	return volumes
+}
+
+func volumeNumber(title string) int {
+	match := config.VolumePattern.FindStringSubmatch(title)
+	if match == nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(match[1])
+	return n
+}
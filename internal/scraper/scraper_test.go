@@ -1,12 +1,15 @@
 package scraper
 
 import (
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 
 	"github.com/linuxswords/wandering-inn/internal/models"
+	"github.com/linuxswords/wandering-inn/pkg/utils"
+	"golang.org/x/net/html"
 )
 
 func TestNewWanderingInnScraper(t *testing.T) {
@@ -127,6 +130,151 @@ func TestWanderingInnScraper_FetchTableOfContents(t *testing.T) {
 	})
 }
 
+func TestWanderingInnScraper_parseTableOfContents(t *testing.T) {
+	tocHTML := `
+<!DOCTYPE html>
+<html>
+<body>
+	<div id="table-of-contents">
+		<div class="volume-wrapper">
+			<h2 class="volume-title">Volume 1</h2>
+			<div class="book-wrapper">
+				<div class="book-title">Book 1: The Wandering Inn</div>
+				<a href="https://wanderinginn.com/1-00">1.00</a>
+				<a href="https://wanderinginn.com/1-01">1.01</a>
+			</div>
+			<div class="book-wrapper">
+				<div class="book-title">Book 2: Flowers of Esthelm</div>
+				<a href="https://wanderinginn.com/interlude-1">Interlude - Pawn</a>
+			</div>
+		</div>
+		<div class="volume-wrapper">
+			<h2>Volume 2</h2>
+			<a href="https://wanderinginn.com/2-00">2.00</a>
+			<a href="https://wanderinginn.com/about">About the Author</a>
+		</div>
+	</div>
+</body>
+</html>`
+
+	doc, err := html.Parse(strings.NewReader(tocHTML))
+	if err != nil {
+		t.Fatalf("Failed to parse HTML: %v", err)
+	}
+
+	chapters := NewWanderingInnScraper().parseTableOfContents(doc)
+
+	expected := []models.Chapter{
+		{Title: "1.00", URL: "https://wanderinginn.com/1-00", Index: 0, Volume: "Volume 1", Book: "Book 1: The Wandering Inn"},
+		{Title: "1.01", URL: "https://wanderinginn.com/1-01", Index: 1, Volume: "Volume 1", Book: "Book 1: The Wandering Inn"},
+		{Title: "Interlude - Pawn", URL: "https://wanderinginn.com/interlude-1", Index: 2, Volume: "Volume 1", Book: "Book 2: Flowers of Esthelm"},
+		{Title: "2.00", URL: "https://wanderinginn.com/2-00", Index: 3, Volume: "Volume 2"},
+	}
+
+	if len(chapters) != len(expected) {
+		t.Fatalf("got %d chapters, want %d: %+v", len(chapters), len(expected), chapters)
+	}
+	for i := range expected {
+		if chapters[i] != expected[i] {
+			t.Errorf("chapter %d = %+v, want %+v", i, chapters[i], expected[i])
+		}
+	}
+}
+
+func TestWanderingInnScraper_parseTableOfContents_NoVolumes(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<div>
+		<a href="https://wanderinginn.com/1-00">1.00</a>
+		<a href="https://wanderinginn.com/1-01">1.01</a>
+	</div>`))
+	if err != nil {
+		t.Fatalf("Failed to parse HTML: %v", err)
+	}
+
+	chapters := NewWanderingInnScraper().parseTableOfContents(doc)
+	if len(chapters) != 2 {
+		t.Fatalf("got %d chapters, want 2", len(chapters))
+	}
+	for _, chapter := range chapters {
+		if chapter.Volume != "" || chapter.Book != "" {
+			t.Errorf("chapter %q has volume %q and book %q, want none", chapter.Title, chapter.Volume, chapter.Book)
+		}
+	}
+}
+
+func TestWanderingInnScraper_FetchVolumes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<h2>Volume 1</h2>
+			<a href="https://wanderinginn.com/1-00">1.00</a>
+			<h2>Volume 2</h2>
+			<a href="https://wanderinginn.com/2-00">2.00</a>
+			<a href="https://wanderinginn.com/2-01">2.01</a>`))
+	}))
+	defer server.Close()
+
+	scraper := NewWanderingInnScraper()
+	scraper.tocURL = server.URL
+	volumes, err := scraper.FetchVolumes()
+	if err != nil {
+		t.Fatalf("FetchVolumes() failed: %v", err)
+	}
+
+	if len(volumes) != 2 {
+		t.Fatalf("got %d volumes, want 2", len(volumes))
+	}
+	if volumes[0].Title != "Volume 1" || len(volumes[0].Chapters) != 1 {
+		t.Errorf("volume 0 = %q with %d chapters, want Volume 1 with 1", volumes[0].Title, len(volumes[0].Chapters))
+	}
+	if volumes[1].Number != 2 || len(volumes[1].Chapters) != 2 {
+		t.Errorf("volume 1 = number %d with %d chapters, want 2 with 2", volumes[1].Number, len(volumes[1].Chapters))
+	}
+}
+
+func TestGroupByVolume(t *testing.T) {
+	chapters := []models.Chapter{
+		{Title: "1.00", Index: 0, Volume: "Volume 1", Book: "Book 1"},
+		{Title: "1.01", Index: 1, Volume: "Volume 1", Book: "Book 1"},
+		{Title: "1.02", Index: 2, Volume: "Volume 1", Book: "Book 2"},
+		{Title: "2.00", Index: 3, Volume: "Volume 2"},
+		{Title: "Side Story", Index: 4},
+	}
+
+	volumes := GroupByVolume(chapters)
+
+	if len(volumes) != 3 {
+		t.Fatalf("got %d volumes, want 3", len(volumes))
+	}
+
+	expected := []struct {
+		title    string
+		number   int
+		chapters int
+		books    int
+	}{
+		{title: "Volume 1", number: 1, chapters: 3, books: 2},
+		{title: "Volume 2", number: 2, chapters: 1, books: 1},
+		{title: "", number: 0, chapters: 1, books: 1},
+	}
+
+	for i, want := range expected {
+		volume := volumes[i]
+		if volume.Title != want.title || volume.Number != want.number {
+			t.Errorf("volume %d = (%q, %d), want (%q, %d)", i, volume.Title, volume.Number, want.title, want.number)
+		}
+		if len(volume.Chapters) != want.chapters {
+			t.Errorf("volume %d has %d chapters, want %d", i, len(volume.Chapters), want.chapters)
+		}
+		if books := volume.Books(); len(books) != want.books {
+			t.Errorf("volume %d has %d books, want %d", i, len(books), want.books)
+		}
+	}
+
+	books := volumes[0].Books()
+	if books[0].Title != "Book 1" || len(books[0].Chapters) != 2 {
+		t.Errorf("book 0 = %q with %d chapters, want Book 1 with 2", books[0].Title, len(books[0].Chapters))
+	}
+}
+
 func TestWanderingInnScraper_FetchChapterContent(t *testing.T) {
 	// Create a mock HTML response for a chapter
 	mockChapterHTML := `
@@ -186,9 +334,52 @@ func TestWanderingInnScraper_FetchChapterContent_Error(t *testing.T) {
 	}
 }
 
+func TestWanderingInnScraper_FetchChapterContent_EmptyOrFailed(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		target error
+	}{
+		{"empty chapter", http.StatusOK, `<div class="entry-content"></div>`, nil},
+		{"challenge page", http.StatusOK, `<html><body><p>Just a moment...</p></body></html>`, ErrNoContent},
+		{"missing chapter", http.StatusNotFound, `<div class="entry-content"><p>Not found</p></div>`, utils.ErrNotFound},
+		{"blocked", http.StatusForbidden, `<div class="entry-content"><p>Denied</p></div>`, utils.ErrBlocked},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/robots.txt" {
+					http.NotFound(w, r)
+					return
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			content, err := NewWanderingInnScraper().FetchChapterContent(server.URL+"/chapter", "1.00")
+			if tt.target == nil {
+				if err != nil {
+					t.Fatalf("FetchChapterContent() failed: %v", err)
+				}
+				if !strings.Contains(content, "<h1>1.00</h1>") {
+					t.Errorf("FetchChapterContent() = %q, want the title of the empty chapter", content)
+				}
+				return
+			}
+			if !errors.Is(err, tt.target) {
+				t.Errorf("FetchChapterContent() error = %v, want %v", err, tt.target)
+			}
+		})
+	}
+}
+
 // Test that the scraper implements the Scraper interface
 func TestWanderingInnScraper_ImplementsInterface(t *testing.T) {
 	var _ Scraper = (*WanderingInnScraper)(nil)
+	var _ ContextScraper = (*WanderingInnScraper)(nil)
 }
 
 // Test sorting of chapters by index
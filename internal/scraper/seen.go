@@ -0,0 +1,106 @@
+package scraper
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/linuxswords/wandering-inn/internal/models"
+	"github.com/linuxswords/wandering-inn/pkg/utils"
+)
+
+// SeenChapters is the set of chapter URLs the watcher has already handled,
+// persisted to a JSON file so a restarted watcher does not rebuild them.
+type SeenChapters struct {
+	path      string
+	urls      map[string]bool
+	checkedAt time.Time
+}
+
+type seenFile struct {
+	CheckedAt time.Time `json:"checked_at"`
+	URLs      []string  `json:"urls"`
+}
+
+// DefaultSeenPath returns the state file of the watcher below $XDG_DATA_HOME.
+func DefaultSeenPath() (string, error) {
+	base, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, "seen.json"), nil
+}
+
+// LoadSeenChapters reads the state file at path. A missing file is an empty
+// set.
+func LoadSeenChapters(path string) (*SeenChapters, error) {
+	seen := &SeenChapters{path: path, urls: make(map[string]bool)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return seen, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var file seenFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	seen.checkedAt = file.CheckedAt
+	for _, url := range file.URLs {
+		seen.urls[urlKey(url)] = true
+	}
+	return seen, nil
+}
+
+func (s *SeenChapters) Len() int {
+	return len(s.urls)
+}
+
+// CheckedAt returns when the table of contents was last checked, or the zero
+// time if it never was.
+func (s *SeenChapters) CheckedAt() time.Time {
+	return s.checkedAt
+}
+
+// Unseen returns the chapters whose URLs are not in the set, in order.
+func (s *SeenChapters) Unseen(chapters []models.Chapter) []models.Chapter {
+	var unseen []models.Chapter
+	for _, chapter := range chapters {
+		if !s.urls[urlKey(chapter.URL)] {
+			unseen = append(unseen, chapter)
+		}
+	}
+	return unseen
+}
+
+func (s *SeenChapters) Add(chapters []models.Chapter) {
+	for _, chapter := range chapters {
+		s.urls[urlKey(chapter.URL)] = true
+	}
+}
+
+// Save writes the set and the time of the check to the state file.
+func (s *SeenChapters) Save(checkedAt time.Time) error {
+	s.checkedAt = checkedAt
+
+	file := seenFile{CheckedAt: checkedAt.UTC()}
+	for url := range s.urls {
+		file.URLs = append(file.URLs, url)
+	}
+	sort.Strings(file.URLs)
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(s.path, data)
+}
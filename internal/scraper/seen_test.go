@@ -0,0 +1,81 @@
+package scraper
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/linuxswords/wandering-inn/internal/models"
+)
+
+func TestLoadSeenChapters_Missing(t *testing.T) {
+	seen, err := LoadSeenChapters(filepath.Join(t.TempDir(), "seen.json"))
+	if err != nil {
+		t.Fatalf("LoadSeenChapters() failed: %v", err)
+	}
+	if seen.Len() != 0 {
+		t.Errorf("Len() = %d, want 0", seen.Len())
+	}
+	if !seen.CheckedAt().IsZero() {
+		t.Errorf("CheckedAt() = %v, want zero time", seen.CheckedAt())
+	}
+}
+
+func TestSeenChapters_SaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "seen.json")
+	chapters := []models.Chapter{
+		{Title: "1.00", URL: "https://wanderinginn.com/1-00/"},
+		{Title: "1.01", URL: "https://wanderinginn.com/1-01/"},
+	}
+
+	seen, err := LoadSeenChapters(path)
+	if err != nil {
+		t.Fatalf("LoadSeenChapters() failed: %v", err)
+	}
+	seen.Add(chapters)
+	checkedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	if err := seen.Save(checkedAt); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+
+	loaded, err := LoadSeenChapters(path)
+	if err != nil {
+		t.Fatalf("LoadSeenChapters() after Save() failed: %v", err)
+	}
+	if loaded.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", loaded.Len())
+	}
+	if !loaded.CheckedAt().Equal(checkedAt) {
+		t.Errorf("CheckedAt() = %v, want %v", loaded.CheckedAt(), checkedAt)
+	}
+}
+
+func TestSeenChapters_Unseen(t *testing.T) {
+	seen, err := LoadSeenChapters(filepath.Join(t.TempDir(), "seen.json"))
+	if err != nil {
+		t.Fatalf("LoadSeenChapters() failed: %v", err)
+	}
+	seen.Add([]models.Chapter{{Title: "1.00", URL: "https://wanderinginn.com/1-00/"}})
+
+	toc := []models.Chapter{
+		{Title: "1.00", URL: "https://wanderinginn.com/1-00/"},
+		{Title: "1.01", URL: "https://wanderinginn.com/1-01/"},
+		{Title: "1.02", URL: "https://wanderinginn.com/1-02/"},
+	}
+	unseen := seen.Unseen(toc)
+	if len(unseen) != 2 || unseen[0].Title != "1.01" || unseen[1].Title != "1.02" {
+		t.Errorf("Unseen() = %v, want chapters 1.01 and 1.02", unseen)
+	}
+}
+
+func TestDefaultSeenPath(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", "/data")
+
+	path, err := DefaultSeenPath()
+	if err != nil {
+		t.Fatalf("DefaultSeenPath() failed: %v", err)
+	}
+	if want := filepath.Join("/data", "wandering-inn", "seen.json"); path != want {
+		t.Errorf("DefaultSeenPath() = %q, want %q", path, want)
+	}
+}
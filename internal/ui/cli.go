@@ -10,6 +10,7 @@ import (
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/linuxswords/wandering-inn/internal/config"
+	"github.com/linuxswords/wandering-inn/internal/epub"
 	"github.com/linuxswords/wandering-inn/internal/models"
 )
 
@@ -68,6 +69,46 @@ func (cli *CLI) PrintChapterInfo(chapters []models.Chapter) {
 	}
 }
 
+func (cli *CLI) PrintChapterList(chapters []models.Chapter) {
+	for _, chapter := range chapters {
+		fmt.Printf("%d. %s\n", chapter.Index+1, chapter.Title)
+	}
+}
+
+func (cli *CLI) PrintBookInfo(book *epub.Book) {
+	fmt.Printf("File:        %s\n", book.Path)
+	fmt.Printf("Title:       %s\n", book.Title)
+	fmt.Printf("Author:      %s\n", book.Author)
+	fmt.Printf("Identifier:  %s\n", book.Identifier)
+	fmt.Printf("Language:    %s\n", book.Language)
+	fmt.Printf("Description: %s\n", book.Description)
+	if book.Series != "" {
+		series := book.Series
+		if book.SeriesIndex != "" {
+			series += " #" + book.SeriesIndex
+		}
+		fmt.Printf("Series:      %s\n", series)
+	}
+	if book.Publisher != "" {
+		fmt.Printf("Publisher:   %s\n", book.Publisher)
+	}
+	if len(book.Subjects) > 0 {
+		fmt.Printf("Subjects:    %s\n", strings.Join(book.Subjects, ", "))
+	}
+	if book.Date != "" {
+		fmt.Printf("Published:   %s\n", book.Date)
+	}
+	fmt.Printf("Modified:    %s\n", book.Modified)
+	fmt.Printf("Sections:    %d\n", len(book.Sections))
+	for i, section := range book.Sections {
+		title := section.Title
+		if title == "" {
+			title = section.Href
+		}
+		fmt.Printf("%d. %s\n", i+1, title)
+	}
+}
+
 func (cli *CLI) GetStartChapter() int {
 	return cli.GetStartChapterInteractive(nil)
 }
@@ -8,6 +8,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/linuxswords/wandering-inn/internal/epub"
 	"github.com/linuxswords/wandering-inn/internal/models"
 )
 
@@ -69,6 +70,29 @@ func TestCLI_PrintChapterInfo(t *testing.T) {
 	}
 }
 
+func TestCLI_PrintChapterList(t *testing.T) {
+	cli := NewCLI()
+	// This function prints to stdout, so we just test that it doesn't panic
+	cli.PrintChapterList(nil)
+	cli.PrintChapterList([]models.Chapter{
+		{Title: "Chapter 1", URL: "url1", Index: 0},
+		{Title: "Chapter 2", URL: "url2", Index: 1},
+	})
+}
+
+func TestCLI_PrintBookInfo(t *testing.T) {
+	cli := NewCLI()
+	// This function prints to stdout, so we just test that it doesn't panic
+	cli.PrintBookInfo(&epub.Book{
+		Path:  "book.epub",
+		Title: "The Wandering Inn",
+		Sections: []epub.Section{
+			{Title: "1.00", Href: "xhtml/section0001.xhtml"},
+			{Href: "xhtml/cover.xhtml"},
+		},
+	})
+}
+
 func TestCLI_GetStartChapter(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -0,0 +1,184 @@
+package ui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/linuxswords/wandering-inn/internal/models"
+	"github.com/linuxswords/wandering-inn/internal/scraper"
+)
+
+// RangeOptions describes a chapter range given on the command line instead of
+// through the interactive selectors.
+type RangeOptions struct {
+	From    string
+	To      string
+	Last    int
+	All     bool
+	Volumes string
+}
+
+// IsSet reports whether any range option was given, in which case the
+// interactive selectors are skipped.
+func (o RangeOptions) IsSet() bool {
+	return o.From != "" || o.To != "" || o.Last > 0 || o.All || o.Volumes != ""
+}
+
+// SelectRange resolves the options against the table of contents and returns
+// the 1-indexed, inclusive start and end chapter.
+func SelectRange(chapters []models.Chapter, opts RangeOptions) (int, int, error) {
+	if len(chapters) == 0 {
+		return 0, 0, fmt.Errorf("no chapters available")
+	}
+
+	if opts.Last < 0 {
+		return 0, 0, fmt.Errorf("--last must be a positive number, got %d", opts.Last)
+	}
+
+	exclusive := 0
+	if opts.From != "" || opts.To != "" {
+		exclusive++
+	}
+	if opts.Last > 0 {
+		exclusive++
+	}
+	if opts.All {
+		exclusive++
+	}
+	if opts.Volumes != "" {
+		exclusive++
+	}
+	if exclusive > 1 {
+		return 0, 0, fmt.Errorf("--from/--to, --last, --all and --volume cannot be combined")
+	}
+
+	total := len(chapters)
+
+	if opts.Volumes != "" {
+		return selectVolumes(chapters, opts.Volumes)
+	}
+
+	if opts.All {
+		return 1, total, nil
+	}
+
+	if opts.Last > 0 {
+		return max(1, total-opts.Last+1), total, nil
+	}
+
+	start, end := 1, total
+	var err error
+
+	if opts.From != "" {
+		start, err = ResolveChapter(chapters, opts.From)
+		if err != nil {
+			return 0, 0, fmt.Errorf("--from: %w", err)
+		}
+	}
+
+	if opts.To != "" {
+		end, err = ResolveChapter(chapters, opts.To)
+		if err != nil {
+			return 0, 0, fmt.Errorf("--to: %w", err)
+		}
+	}
+
+	if end < start {
+		return 0, 0, fmt.Errorf("end chapter %d (%s) comes before start chapter %d (%s)",
+			end, chapters[end-1].Title, start, chapters[start-1].Title)
+	}
+
+	return start, end, nil
+}
+
+// ResolveChapter finds the 1-indexed position of a chapter by exact title,
+// list number or a unique part of its title.
+func ResolveChapter(chapters []models.Chapter, spec string) (int, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return 0, fmt.Errorf("empty chapter")
+	}
+
+	lowerSpec := strings.ToLower(spec)
+
+	for i, chapter := range chapters {
+		if strings.ToLower(strings.TrimSpace(chapter.Title)) == lowerSpec {
+			return i + 1, nil
+		}
+	}
+
+	if n, err := strconv.Atoi(spec); err == nil {
+		if n < 1 || n > len(chapters) {
+			return 0, fmt.Errorf("chapter number %d out of range (1-%d)", n, len(chapters))
+		}
+		return n, nil
+	}
+
+	var matches []int
+	for i, chapter := range chapters {
+		if strings.Contains(strings.ToLower(chapter.Title), lowerSpec) {
+			matches = append(matches, i+1)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return 0, fmt.Errorf("no chapter matches %q", spec)
+	case 1:
+		return matches[0], nil
+	}
+
+	var candidates []string
+	for _, m := range matches[:min(len(matches), 5)] {
+		candidates = append(candidates, fmt.Sprintf("%d. %s", m, chapters[m-1].Title))
+	}
+	if len(matches) > 5 {
+		candidates = append(candidates, "...")
+	}
+	return 0, fmt.Errorf("%q matches %d chapters: %s", spec, len(matches), strings.Join(candidates, ", "))
+}
+
+// ParseVolumeRange parses a volume number ("7") or an inclusive range of
+// volume numbers ("3-5").
+func ParseVolumeRange(spec string) (int, int, error) {
+	spec = strings.TrimSpace(spec)
+	first, last, isRange := strings.Cut(spec, "-")
+
+	from, err := strconv.Atoi(strings.TrimSpace(first))
+	if err != nil || from < 1 {
+		return 0, 0, fmt.Errorf("invalid volume %q", spec)
+	}
+	if !isRange {
+		return from, from, nil
+	}
+
+	to, err := strconv.Atoi(strings.TrimSpace(last))
+	if err != nil || to < from {
+		return 0, 0, fmt.Errorf("invalid volume range %q", spec)
+	}
+	return from, to, nil
+}
+
+func selectVolumes(chapters []models.Chapter, spec string) (int, int, error) {
+	from, to, err := ParseVolumeRange(spec)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	start, end := 0, 0
+	for _, volume := range scraper.GroupByVolume(chapters) {
+		if volume.Number < from || volume.Number > to {
+			continue
+		}
+		if start == 0 {
+			start = volume.Chapters[0].Index + 1
+		}
+		end = volume.Chapters[len(volume.Chapters)-1].Index + 1
+	}
+
+	if start == 0 {
+		return 0, 0, fmt.Errorf("no chapters found for volume %s", spec)
+	}
+	return start, end, nil
+}
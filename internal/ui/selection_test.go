@@ -0,0 +1,203 @@
+package ui
+
+import (
+	"testing"
+
+	"github.com/linuxswords/wandering-inn/internal/models"
+)
+
+func testTOC() []models.Chapter {
+	return []models.Chapter{
+		{Title: "1.00", URL: "url1", Index: 0},
+		{Title: "1.01", URL: "url2", Index: 1},
+		{Title: "Interlude - Pawn", URL: "url3", Index: 2},
+		{Title: "1.02", URL: "url4", Index: 3},
+		{Title: "Interlude - Pawn (Revised)", URL: "url5", Index: 4},
+		{Title: "9.01", URL: "url6", Index: 5},
+	}
+}
+
+func TestRangeOptions_IsSet(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     RangeOptions
+		expected bool
+	}{
+		{name: "empty", opts: RangeOptions{}, expected: false},
+		{name: "from", opts: RangeOptions{From: "1.00"}, expected: true},
+		{name: "to", opts: RangeOptions{To: "1.00"}, expected: true},
+		{name: "last", opts: RangeOptions{Last: 3}, expected: true},
+		{name: "all", opts: RangeOptions{All: true}, expected: true},
+		{name: "volumes", opts: RangeOptions{Volumes: "3-5"}, expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := tt.opts.IsSet(); result != tt.expected {
+				t.Errorf("IsSet() = %v, want %v", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestResolveChapter(t *testing.T) {
+	tests := []struct {
+		name        string
+		spec        string
+		expected    int
+		expectError bool
+	}{
+		{name: "exact title", spec: "9.01", expected: 6},
+		{name: "exact title wins over substring", spec: "Interlude - Pawn", expected: 3},
+		{name: "case insensitive", spec: "interlude - pawn (revised)", expected: 5},
+		{name: "list number", spec: "2", expected: 2},
+		{name: "unique substring", spec: "revised", expected: 5},
+		{name: "ambiguous substring", spec: "interlude", expectError: true},
+		{name: "number out of range", spec: "42", expectError: true},
+		{name: "no match", spec: "Epilogue", expectError: true},
+		{name: "empty", spec: "  ", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ResolveChapter(testTOC(), tt.spec)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("ResolveChapter(%q) expected error, got %d", tt.spec, result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolveChapter(%q) unexpected error: %v", tt.spec, err)
+			}
+			if result != tt.expected {
+				t.Errorf("ResolveChapter(%q) = %d, want %d", tt.spec, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSelectRange(t *testing.T) {
+	tests := []struct {
+		name          string
+		opts          RangeOptions
+		expectedStart int
+		expectedEnd   int
+		expectError   bool
+	}{
+		{name: "all", opts: RangeOptions{All: true}, expectedStart: 1, expectedEnd: 6},
+		{name: "last", opts: RangeOptions{Last: 2}, expectedStart: 5, expectedEnd: 6},
+		{name: "last more than available", opts: RangeOptions{Last: 100}, expectedStart: 1, expectedEnd: 6},
+		{name: "from only", opts: RangeOptions{From: "1.02"}, expectedStart: 4, expectedEnd: 6},
+		{name: "to only", opts: RangeOptions{To: "1.01"}, expectedStart: 1, expectedEnd: 2},
+		{name: "from and to", opts: RangeOptions{From: "1.01", To: "Interlude - Pawn"}, expectedStart: 2, expectedEnd: 3},
+		{name: "single chapter", opts: RangeOptions{From: "9.01", To: "9.01"}, expectedStart: 6, expectedEnd: 6},
+		{name: "reversed range", opts: RangeOptions{From: "1.02", To: "1.00"}, expectError: true},
+		{name: "last and all", opts: RangeOptions{Last: 2, All: true}, expectError: true},
+		{name: "from and last", opts: RangeOptions{From: "1.00", Last: 2}, expectError: true},
+		{name: "negative last", opts: RangeOptions{Last: -1}, expectError: true},
+		{name: "unknown chapter", opts: RangeOptions{From: "Epilogue"}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end, err := SelectRange(testTOC(), tt.opts)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("SelectRange() expected error, got (%d, %d)", start, end)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SelectRange() unexpected error: %v", err)
+			}
+			if start != tt.expectedStart || end != tt.expectedEnd {
+				t.Errorf("SelectRange() = (%d, %d), want (%d, %d)", start, end, tt.expectedStart, tt.expectedEnd)
+			}
+		})
+	}
+}
+
+func TestSelectRange_Volumes(t *testing.T) {
+	chapters := []models.Chapter{
+		{Title: "1.00", Index: 0, Volume: "Volume 1"},
+		{Title: "1.01", Index: 1, Volume: "Volume 1"},
+		{Title: "2.00", Index: 2, Volume: "Volume 2"},
+		{Title: "3.00", Index: 3, Volume: "Volume 3"},
+		{Title: "3.01", Index: 4, Volume: "Volume 3"},
+		{Title: "4.00", Index: 5, Volume: "Volume 4"},
+	}
+
+	tests := []struct {
+		name          string
+		opts          RangeOptions
+		expectedStart int
+		expectedEnd   int
+		expectError   bool
+	}{
+		{name: "single volume", opts: RangeOptions{Volumes: "3"}, expectedStart: 4, expectedEnd: 5},
+		{name: "volume range", opts: RangeOptions{Volumes: "2-3"}, expectedStart: 3, expectedEnd: 5},
+		{name: "range past the end", opts: RangeOptions{Volumes: "4-9"}, expectedStart: 6, expectedEnd: 6},
+		{name: "unknown volume", opts: RangeOptions{Volumes: "9"}, expectError: true},
+		{name: "combined with last", opts: RangeOptions{Volumes: "1", Last: 2}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end, err := SelectRange(chapters, tt.opts)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("SelectRange() expected error, got (%d, %d)", start, end)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SelectRange() unexpected error: %v", err)
+			}
+			if start != tt.expectedStart || end != tt.expectedEnd {
+				t.Errorf("SelectRange() = (%d, %d), want (%d, %d)", start, end, tt.expectedStart, tt.expectedEnd)
+			}
+		})
+	}
+}
+
+func TestParseVolumeRange(t *testing.T) {
+	tests := []struct {
+		spec         string
+		expectedFrom int
+		expectedTo   int
+		expectError  bool
+	}{
+		{spec: "7", expectedFrom: 7, expectedTo: 7},
+		{spec: "3-5", expectedFrom: 3, expectedTo: 5},
+		{spec: " 3 - 5 ", expectedFrom: 3, expectedTo: 5},
+		{spec: "5-3", expectError: true},
+		{spec: "0", expectError: true},
+		{spec: "three", expectError: true},
+		{spec: "3-", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			from, to, err := ParseVolumeRange(tt.spec)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("ParseVolumeRange(%q) expected error, got (%d, %d)", tt.spec, from, to)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseVolumeRange(%q) unexpected error: %v", tt.spec, err)
+			}
+			if from != tt.expectedFrom || to != tt.expectedTo {
+				t.Errorf("ParseVolumeRange(%q) = (%d, %d), want (%d, %d)", tt.spec, from, to, tt.expectedFrom, tt.expectedTo)
+			}
+		})
+	}
+}
+
+func TestSelectRange_NoChapters(t *testing.T) {
+	if _, _, err := SelectRange(nil, RangeOptions{All: true}); err == nil {
+		t.Error("SelectRange() with no chapters expected error")
+	}
+}
@@ -0,0 +1,241 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/linuxswords/wandering-inn/internal/models"
+)
+
+// volumeRow is one visible line of the volume selector: a volume header when
+// chapter is -1, otherwise a chapter of an expanded volume.
+type volumeRow struct {
+	volume  int
+	chapter int
+}
+
+type volumeSelectorModel struct {
+	volumes  []models.Volume
+	expanded []bool
+	marked   []bool
+	cursor   int
+	quit     bool
+}
+
+func newVolumeSelectorModel(volumes []models.Volume) volumeSelectorModel {
+	return volumeSelectorModel{
+		volumes:  volumes,
+		expanded: make([]bool, len(volumes)),
+		marked:   make([]bool, len(volumes)),
+		cursor:   len(volumes) - 1, // Start from the latest volume
+	}
+}
+
+func (cli *CLI) GetVolumesInteractive(volumes []models.Volume) []models.Chapter {
+	p := tea.NewProgram(newVolumeSelectorModel(volumes), tea.WithAltScreen())
+	finalModel, err := p.Run()
+	if err != nil {
+		// Fallback to text input if bubbletea fails
+		return cli.getVolumesTextInput(volumes)
+	}
+
+	m := finalModel.(volumeSelectorModel)
+	if m.quit {
+		fmt.Println("Exiting...")
+		os.Exit(0)
+	}
+
+	return m.selectedChapters()
+}
+
+func (m volumeSelectorModel) rows() []volumeRow {
+	var rows []volumeRow
+	for v, volume := range m.volumes {
+		rows = append(rows, volumeRow{volume: v, chapter: -1})
+		if m.expanded[v] {
+			for c := range volume.Chapters {
+				rows = append(rows, volumeRow{volume: v, chapter: c})
+			}
+		}
+	}
+	return rows
+}
+
+// selectedChapters returns the chapters of all marked volumes in reading
+// order, or those of the volume under the cursor if none are marked.
+func (m volumeSelectorModel) selectedChapters() []models.Chapter {
+	var chapters []models.Chapter
+	for v, volume := range m.volumes {
+		if m.marked[v] {
+			chapters = append(chapters, volume.Chapters...)
+		}
+	}
+
+	rows := m.rows()
+	if len(chapters) == 0 && m.cursor >= 0 && m.cursor < len(rows) {
+		chapters = append(chapters, m.volumes[rows[m.cursor].volume].Chapters...)
+	}
+	return chapters
+}
+
+func (m volumeSelectorModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m volumeSelectorModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	keyMsg, ok := msg.(tea.KeyMsg)
+	if !ok {
+		return m, nil
+	}
+
+	rows := m.rows()
+	if len(rows) == 0 {
+		m.quit = true
+		return m, tea.Quit
+	}
+	row := rows[m.cursor]
+
+	switch keyMsg.String() {
+	case "ctrl+c", "q", "esc":
+		m.quit = true
+		return m, tea.Quit
+	case "up", "k":
+		if m.cursor > 0 {
+			m.cursor--
+		}
+	case "down", "j":
+		if m.cursor < len(rows)-1 {
+			m.cursor++
+		}
+	case "right", "l":
+		m.expanded[row.volume] = true
+	case "left", "h":
+		m.collapse(rows, row.volume)
+	case "tab":
+		if m.expanded[row.volume] {
+			m.collapse(rows, row.volume)
+		} else {
+			m.expanded[row.volume] = true
+		}
+	case " ":
+		m.marked[row.volume] = !m.marked[row.volume]
+	case "enter":
+		return m, tea.Quit
+	}
+	return m, nil
+}
+
+// collapse hides the chapters of a volume and moves the cursor onto its header.
+func (m *volumeSelectorModel) collapse(rows []volumeRow, volume int) {
+	m.expanded[volume] = false
+	for i, r := range rows {
+		if r.volume == volume && r.chapter == -1 {
+			m.cursor = i
+			return
+		}
+	}
+}
+
+func (m volumeSelectorModel) View() string {
+	s := "Wandering Inn EPUB Creator\n"
+	s += "==========================\n"
+	s += "Select volumes:\n"
+	s += "Use ↑/↓ or j/k to navigate, →/← or l/h (tab) to expand/collapse, Space to mark, Enter to confirm, 'q' to quit\n\n"
+
+	rows := m.rows()
+
+	// Show a window of rows around the cursor
+	windowSize := 15
+	start := max(0, m.cursor-windowSize/2)
+	end := min(len(rows)-1, start+windowSize-1)
+
+	// Adjust start if we're near the end
+	if end == len(rows)-1 {
+		start = max(0, len(rows)-windowSize)
+	}
+
+	for i := start; i <= end; i++ {
+		row := rows[i]
+		volume := m.volumes[row.volume]
+
+		var text string
+		if row.chapter == -1 {
+			arrow := "▸"
+			if m.expanded[row.volume] {
+				arrow = "▾"
+			}
+			mark := "[ ]"
+			if m.marked[row.volume] {
+				mark = "[x]"
+			}
+			text = fmt.Sprintf("%s %s %s (%d chapters)", arrow, mark, volumeTitle(volume), len(volume.Chapters))
+		} else {
+			chapter := volume.Chapters[row.chapter]
+			text = fmt.Sprintf("      %d. %s", chapter.Index+1, chapter.Title)
+		}
+
+		cursor := " "
+		line := fmt.Sprintf("%s %s", cursor, text)
+
+		if m.cursor == i {
+			cursor = ">"
+			line = cursorStyle.Render(fmt.Sprintf("%s %s", cursor, text))
+		} else if m.marked[row.volume] {
+			line = selectedStyle.Render(line)
+		}
+
+		s += line + "\n"
+	}
+
+	if start > 0 {
+		s += fmt.Sprintf("  ... (%d more above)\n", start)
+	}
+	if end < len(rows)-1 {
+		s += fmt.Sprintf("  ... (%d more below)\n", len(rows)-1-end)
+	}
+
+	return s
+}
+
+func (cli *CLI) getVolumesTextInput(volumes []models.Volume) []models.Chapter {
+	for _, volume := range volumes {
+		fmt.Printf("%s (%d chapters)\n", volumeTitle(volume), len(volume.Chapters))
+	}
+
+	for {
+		fmt.Print("Enter a volume number or range (e.g. 7 or 3-5): ")
+		input, err := cli.reader.ReadString('\n')
+		if err != nil {
+			fmt.Println("Error reading input, please try again.")
+			continue
+		}
+
+		from, to, err := ParseVolumeRange(strings.TrimSpace(input))
+		if err != nil {
+			fmt.Println("Please enter a valid volume number or range.")
+			continue
+		}
+
+		var chapters []models.Chapter
+		for _, volume := range volumes {
+			if volume.Number >= from && volume.Number <= to {
+				chapters = append(chapters, volume.Chapters...)
+			}
+		}
+		if len(chapters) == 0 {
+			fmt.Println("No chapters found for that volume, please try again.")
+			continue
+		}
+
+		return chapters
+	}
+}
+
+func volumeTitle(volume models.Volume) string {
+	if volume.Title == "" {
+		return "Other chapters"
+	}
+	return volume.Title
+}
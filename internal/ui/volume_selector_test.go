@@ -0,0 +1,149 @@
+package ui
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/linuxswords/wandering-inn/internal/models"
+)
+
+func testVolumes() []models.Volume {
+	return []models.Volume{
+		{Title: "Volume 1", Number: 1, Chapters: []models.Chapter{
+			{Title: "1.00", Index: 0, Volume: "Volume 1"},
+			{Title: "1.01", Index: 1, Volume: "Volume 1"},
+		}},
+		{Title: "Volume 2", Number: 2, Chapters: []models.Chapter{
+			{Title: "2.00", Index: 2, Volume: "Volume 2"},
+		}},
+		{Title: "Volume 3", Number: 3, Chapters: []models.Chapter{
+			{Title: "3.00", Index: 3, Volume: "Volume 3"},
+			{Title: "3.01", Index: 4, Volume: "Volume 3"},
+		}},
+	}
+}
+
+func sendKeys(m volumeSelectorModel, keys ...tea.KeyMsg) volumeSelectorModel {
+	for _, key := range keys {
+		model, _ := m.Update(key)
+		m = model.(volumeSelectorModel)
+	}
+	return m
+}
+
+var (
+	keyUp    = tea.KeyMsg{Type: tea.KeyUp}
+	keyDown  = tea.KeyMsg{Type: tea.KeyDown}
+	keyRight = tea.KeyMsg{Type: tea.KeyRight}
+	keyLeft  = tea.KeyMsg{Type: tea.KeyLeft}
+	keySpace = tea.KeyMsg{Type: tea.KeySpace}
+	keyQuit  = tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'q'}}
+)
+
+func chapterTitles(chapters []models.Chapter) string {
+	var titles []string
+	for _, chapter := range chapters {
+		titles = append(titles, chapter.Title)
+	}
+	return strings.Join(titles, ",")
+}
+
+func TestVolumeSelectorModel_DefaultSelection(t *testing.T) {
+	m := newVolumeSelectorModel(testVolumes())
+
+	if got := chapterTitles(m.selectedChapters()); got != "3.00,3.01" {
+		t.Errorf("selectedChapters() = %s, want the latest volume", got)
+	}
+}
+
+func TestVolumeSelectorModel_MarkVolumes(t *testing.T) {
+	m := newVolumeSelectorModel(testVolumes())
+
+	// Mark volume 3, move to volume 1 and mark it as well
+	m = sendKeys(m, keySpace, keyUp, keyUp, keySpace)
+
+	if got := chapterTitles(m.selectedChapters()); got != "1.00,1.01,3.00,3.01" {
+		t.Errorf("selectedChapters() = %s, want volumes 1 and 3 in order", got)
+	}
+
+	// Unmark volume 1 again
+	m = sendKeys(m, keySpace)
+	if got := chapterTitles(m.selectedChapters()); got != "3.00,3.01" {
+		t.Errorf("selectedChapters() = %s, want only volume 3", got)
+	}
+}
+
+func TestVolumeSelectorModel_ExpandCollapse(t *testing.T) {
+	m := newVolumeSelectorModel(testVolumes())
+	m = sendKeys(m, keyUp, keyUp, keyRight)
+
+	if rows := m.rows(); len(rows) != 5 {
+		t.Fatalf("rows() after expanding volume 1 = %d rows, want 5", len(rows))
+	}
+
+	// Move onto the second chapter of volume 1 and collapse from there
+	m = sendKeys(m, keyDown, keyDown, keyLeft)
+
+	if rows := m.rows(); len(rows) != 3 {
+		t.Errorf("rows() after collapsing = %d rows, want 3", len(rows))
+	}
+	if m.cursor != 0 {
+		t.Errorf("cursor after collapsing = %d, want 0 (volume 1 header)", m.cursor)
+	}
+}
+
+func TestVolumeSelectorModel_MarkFromChapterRow(t *testing.T) {
+	m := newVolumeSelectorModel(testVolumes())
+	m = sendKeys(m, keyRight, keyDown, keySpace)
+
+	if !m.marked[2] {
+		t.Error("marking from a chapter row should mark its volume")
+	}
+}
+
+func TestVolumeSelectorModel_Quit(t *testing.T) {
+	m := sendKeys(newVolumeSelectorModel(testVolumes()), keyQuit)
+	if !m.quit {
+		t.Error("expected quit to be set")
+	}
+}
+
+func TestVolumeSelectorModel_View(t *testing.T) {
+	m := newVolumeSelectorModel(testVolumes())
+	m = sendKeys(m, keyRight, keySpace)
+
+	view := m.View()
+	for _, expected := range []string{"Volume 1 (2 chapters)", "[x] Volume 3", "5. 3.01"} {
+		if !strings.Contains(view, expected) {
+			t.Errorf("View() missing %q:\n%s", expected, view)
+		}
+	}
+}
+
+func TestCLI_getVolumesTextInput(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "single volume", input: "2\n", expected: "2.00"},
+		{name: "volume range", input: "2-3\n", expected: "2.00,3.00,3.01"},
+		{name: "invalid then valid", input: "abc\n1\n", expected: "1.00,1.01"},
+		{name: "unknown then valid", input: "9\n3\n", expected: "3.00,3.01"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cli := &CLI{
+				reader: bufio.NewReader(strings.NewReader(tt.input)),
+			}
+
+			result := cli.getVolumesTextInput(testVolumes())
+			if got := chapterTitles(result); got != tt.expected {
+				t.Errorf("getVolumesTextInput() = %s, want %s", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,267 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/linuxswords/wandering-inn/internal/config"
+)
+
+var (
+	// ErrDisallowed is returned for requests that robots.txt does not allow.
+	ErrDisallowed = errors.New("disallowed by robots.txt")
+	// ErrRobotsUnavailable is returned for requests to a host whose
+	// robots.txt could not be downloaded. Nothing is requested from the host
+	// until it can be.
+	ErrRobotsUnavailable = errors.New("robots.txt is unavailable")
+)
+
+// Client is the HTTP client all requests to the site go through. It sends an
+// identifying User-Agent, limits the request rate per host with a token bucket
+// and honours the Disallow and Crawl-delay rules of robots.txt.
+type Client struct {
+	http      *http.Client
+	userAgent string
+	interval  time.Duration
+	burst     int
+
+	maxRetries int
+	retryBase  time.Duration
+	retryLimit time.Duration
+
+	robotsTTL   time.Duration
+	robotsRetry time.Duration
+
+	mu    sync.Mutex
+	hosts map[string]*hostState
+}
+
+type hostState struct {
+	limiter *tokenBucket
+
+	// robotsMu is held while robots.txt is downloaded, so concurrent
+	// requests wait for a single download.
+	robotsMu sync.Mutex
+	robots   *robotsRules
+	// robotsExpires is when the rules are downloaded again. After a failed
+	// download, robotsRetry is when the next attempt is made and robotsErr
+	// is reported until then.
+	robotsExpires time.Time
+	robotsRetry   time.Time
+	robotsErr     error
+}
+
+// DefaultClient is shared by Fetch and the scraper, so the rate limit holds
+// across everything the tool downloads.
+var DefaultClient = NewClient()
+
+func NewClient() *Client {
+	return &Client{
+		http:      &http.Client{Timeout: config.RequestTimeout},
+		userAgent: config.UserAgent,
+		interval:  config.RequestInterval,
+		burst:     config.RequestBurst,
+
+		maxRetries: config.MaxRetries,
+		retryBase:  config.RetryBaseDelay,
+		retryLimit: config.RetryMaxDelay,
+
+		robotsTTL:   config.RobotsTTL,
+		robotsRetry: config.RobotsRetryDelay,
+
+		hosts: make(map[string]*hostState),
+	}
+}
+
+func (c *Client) SetUserAgent(userAgent string) {
+	c.userAgent = userAgent
+}
+
+// SetRateLimit allows burst requests per host at once and one more every
+// interval after that. A longer Crawl-delay in robots.txt takes precedence.
+func (c *Client) SetRateLimit(interval time.Duration, burst int) {
+	c.interval = interval
+	c.burst = burst
+}
+
+// SetRetries sets how often transient failures are retried and the backoff
+// between attempts, which starts at base and doubles up to limit.
+func (c *Client) SetRetries(maxRetries int, base, limit time.Duration) {
+	c.maxRetries = maxRetries
+	c.retryBase = base
+	c.retryLimit = limit
+}
+
+// SetRobotsRefresh sets how long robots.txt rules are kept before they are
+// downloaded again, and how long to wait after a failed download before
+// trying again.
+func (c *Client) SetRobotsRefresh(ttl, retry time.Duration) {
+	c.robotsTTL = ttl
+	c.robotsRetry = retry
+}
+
+// Get sends a GET request for url through Do.
+func (c *Client) Get(url string) (*http.Response, error) {
+	return c.GetContext(context.Background(), url)
+}
+
+// GetContext is like Get, but gives up waiting, retrying or reading when ctx
+// is done.
+func (c *Client) GetContext(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
+}
+
+// Do sends req once robots.txt allows it and the host's rate limit has a
+// token free. GET requests that fail with a transient network error or a
+// retryable status are retried with exponential backoff, waiting at least as
+// long as a Retry-After header asks. The last response is returned as is; use
+// CheckStatus to turn its status into an error.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	host := c.host(req.URL)
+	rules, err := c.robotsRules(req, host)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", req.URL, err)
+	}
+	if !rules.allowed(req.URL.RequestURI()) {
+		return nil, fmt.Errorf("%s: %w", req.URL, ErrDisallowed)
+	}
+	return c.sendWithRetries(req, host.limiter)
+}
+
+// robotsRules returns the robots.txt rules for the host of req, downloading
+// them when there are none yet or they have expired. If the download fails,
+// the previous rules stay in use; without any, requests to the host fail with
+// ErrRobotsUnavailable until a later attempt succeeds.
+func (c *Client) robotsRules(req *http.Request, host *hostState) (*robotsRules, error) {
+	host.robotsMu.Lock()
+	defer host.robotsMu.Unlock()
+
+	now := time.Now()
+	if host.robots != nil && now.Before(host.robotsExpires) {
+		return host.robots, nil
+	}
+	if now.Before(host.robotsRetry) {
+		if host.robots != nil {
+			return host.robots, nil
+		}
+		return nil, host.robotsErr
+	}
+
+	rules, err := c.fetchRobots(req, host.limiter)
+	if err != nil {
+		// A cancelled request says nothing about the host
+		if req.Context().Err() == nil {
+			host.robotsRetry, host.robotsErr = now.Add(c.robotsRetry), err
+		}
+		if host.robots != nil {
+			return host.robots, nil
+		}
+		return nil, err
+	}
+
+	host.robots, host.robotsExpires = rules, now.Add(c.robotsTTL)
+	host.robotsRetry, host.robotsErr = time.Time{}, nil
+	if rules.crawlDelay > c.interval {
+		host.limiter.setRate(rules.crawlDelay, 1)
+	} else {
+		host.limiter.setRate(c.interval, c.burst)
+	}
+	return rules, nil
+}
+
+// sendWithRetries sends req, retrying GET requests as described for Do.
+func (c *Client) sendWithRetries(req *http.Request, limiter *tokenBucket) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := c.send(req, limiter)
+		if req.Method != http.MethodGet || attempt >= c.maxRetries || req.Context().Err() != nil {
+			return resp, err
+		}
+
+		delay := backoff(attempt, c.retryBase, c.retryLimit)
+		if err != nil && !isTransient(err) {
+			return nil, err
+		}
+		if err == nil {
+			if !isRetryable(resp.StatusCode) {
+				return resp, nil
+			}
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+				if retryAfter > c.retryLimit {
+					// Not worth waiting for; let the caller report it
+					return resp, nil
+				}
+				delay = max(delay, retryAfter)
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		if err := sleep(req.Context(), delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (c *Client) send(req *http.Request, limiter *tokenBucket) (*http.Response, error) {
+	if err := limiter.wait(req.Context()); err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+	return c.http.Do(req)
+}
+
+func (c *Client) host(u *url.URL) *hostState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := u.Scheme + "://" + u.Host
+	host, ok := c.hosts[key]
+	if !ok {
+		host = &hostState{limiter: newTokenBucket(c.interval, c.burst)}
+		c.hosts[key] = host
+	}
+	return host
+}
+
+// fetchRobots downloads and parses robots.txt for the host of page, with the
+// same retries as other requests. A robots.txt that does not exist or is
+// refused (any 4xx status) allows everything; one that cannot be reached or
+// fails with a server error is ErrRobotsUnavailable.
+func (c *Client) fetchRobots(page *http.Request, limiter *tokenBucket) (*robotsRules, error) {
+	robotsURL := &url.URL{Scheme: page.URL.Scheme, Host: page.URL.Host, Path: "/robots.txt"}
+	req, err := http.NewRequestWithContext(page.Context(), http.MethodGet, robotsURL.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrRobotsUnavailable, err)
+	}
+
+	resp, err := c.sendWithRetries(req, limiter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrRobotsUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 500:
+		return nil, fmt.Errorf("%w: %s", ErrRobotsUnavailable, resp.Status)
+	case resp.StatusCode != http.StatusOK:
+		return &robotsRules{}, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 512*1024))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrRobotsUnavailable, err)
+	}
+
+	agent, _, _ := strings.Cut(c.userAgent, "/")
+	return parseRobots(body, agent), nil
+}
@@ -0,0 +1,295 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/linuxswords/wandering-inn/internal/config"
+)
+
+func newRobotsServer(t *testing.T, robots string, seen *[]string, mu *sync.Mutex) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		*seen = append(*seen, r.URL.Path+" "+r.Header.Get("User-Agent"))
+		mu.Unlock()
+		if r.URL.Path == "/robots.txt" {
+			if robots == "" {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write([]byte(robots))
+			return
+		}
+		w.Write([]byte("<p>page</p>"))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestClient_UserAgentAndRobots(t *testing.T) {
+	var mu sync.Mutex
+	var seen []string
+	server := newRobotsServer(t, "User-agent: *\nDisallow: /private\n", &seen, &mu)
+
+	client := NewClient()
+	client.SetRateLimit(0, 1)
+
+	for _, path := range []string{"/1-00", "/1-01"} {
+		resp, err := client.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("Get(%s) failed: %v", path, err)
+		}
+		resp.Body.Close()
+	}
+
+	if _, err := client.Get(server.URL + "/private/page"); !errors.Is(err, ErrDisallowed) {
+		t.Errorf("Get() of disallowed page error = %v, want ErrDisallowed", err)
+	}
+
+	expected := []string{
+		"/robots.txt " + config.UserAgent,
+		"/1-00 " + config.UserAgent,
+		"/1-01 " + config.UserAgent,
+	}
+	if len(seen) != len(expected) {
+		t.Fatalf("server saw %v, want %v", seen, expected)
+	}
+	for i := range expected {
+		if seen[i] != expected[i] {
+			t.Errorf("request %d = %q, want %q", i, seen[i], expected[i])
+		}
+	}
+}
+
+func TestClient_MissingRobotsAllowsEverything(t *testing.T) {
+	var mu sync.Mutex
+	var seen []string
+	server := newRobotsServer(t, "", &seen, &mu)
+
+	client := NewClient()
+	client.SetRateLimit(0, 1)
+
+	resp, err := client.Get(server.URL + "/private")
+	if err != nil {
+		t.Fatalf("Get() without robots.txt failed: %v", err)
+	}
+	resp.Body.Close()
+}
+
+// robotsSwitchServer serves the robots.txt in *robots, or a 503 if it is
+// empty, and counts the downloads of robots.txt.
+func robotsSwitchServer(t *testing.T, robots *string, downloads *int, mu *sync.Mutex) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path == "/robots.txt" {
+			*downloads++
+			if *robots == "" {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte(*robots))
+			return
+		}
+		w.Write([]byte("<p>page</p>"))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestClient_RobotsUnavailable(t *testing.T) {
+	var mu sync.Mutex
+	robots, downloads := "", 0
+	server := robotsSwitchServer(t, &robots, &downloads, &mu)
+
+	client := NewClient()
+	client.SetRateLimit(0, 1)
+	client.SetRetries(1, time.Millisecond, time.Millisecond)
+	client.SetRobotsRefresh(time.Hour, 50*time.Millisecond)
+
+	for range 2 {
+		if _, err := client.Get(server.URL + "/private/page"); !errors.Is(err, ErrRobotsUnavailable) {
+			t.Fatalf("Get() with robots.txt failing error = %v, want ErrRobotsUnavailable", err)
+		}
+	}
+	if downloads != 2 {
+		t.Errorf("robots.txt was requested %d times, want 2 (one retry, then none until the retry delay)", downloads)
+	}
+
+	// Once the retry delay is over, robots.txt is downloaded again
+	time.Sleep(60 * time.Millisecond)
+	mu.Lock()
+	robots = "User-agent: *\nDisallow: /private\n"
+	mu.Unlock()
+
+	if _, err := client.Get(server.URL + "/private/page"); !errors.Is(err, ErrDisallowed) {
+		t.Errorf("Get() after robots.txt came back error = %v, want ErrDisallowed", err)
+	}
+}
+
+func TestClient_RobotsRefresh(t *testing.T) {
+	var mu sync.Mutex
+	robots, downloads := "User-agent: *\nDisallow: /old\n", 0
+	server := robotsSwitchServer(t, &robots, &downloads, &mu)
+
+	client := NewClient()
+	client.SetRateLimit(0, 1)
+	client.SetRetries(0, time.Millisecond, time.Millisecond)
+	client.SetRobotsRefresh(0, time.Hour)
+
+	if _, err := client.Get(server.URL + "/old"); !errors.Is(err, ErrDisallowed) {
+		t.Fatalf("Get() error = %v, want ErrDisallowed", err)
+	}
+
+	// Expired rules are replaced by the new robots.txt
+	mu.Lock()
+	robots = "User-agent: *\nDisallow: /new\n"
+	mu.Unlock()
+	resp, err := client.Get(server.URL + "/old")
+	if err != nil {
+		t.Fatalf("Get() of page allowed by the new robots.txt failed: %v", err)
+	}
+	resp.Body.Close()
+
+	// A failed refresh keeps the last rules in use
+	mu.Lock()
+	robots = ""
+	mu.Unlock()
+	if _, err := client.Get(server.URL + "/new"); !errors.Is(err, ErrDisallowed) {
+		t.Errorf("Get() after failed refresh error = %v, want the last rules to apply", err)
+	}
+	if downloads != 3 {
+		t.Errorf("robots.txt was requested %d times, want 3", downloads)
+	}
+}
+
+func TestClient_RateLimit(t *testing.T) {
+	var mu sync.Mutex
+	var seen []string
+	server := newRobotsServer(t, "User-agent: *\nCrawl-delay: 0.05\n", &seen, &mu)
+
+	client := NewClient()
+	client.SetRateLimit(10*time.Millisecond, 4)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(server.URL + "/page")
+		if err != nil {
+			t.Fatalf("Get() failed: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	// robots.txt uses the first token; the crawl delay then limits the
+	// three pages to one every 50ms.
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("3 requests with a 50ms crawl delay took %v, want at least 100ms", elapsed)
+	}
+}
+
+func TestClient_Retries(t *testing.T) {
+	tests := []struct {
+		name       string
+		statuses   []int
+		retryAfter string
+		requests   int
+		target     error
+	}{
+		{"succeeds after server errors", []int{503, 502, 200}, "", 3, nil},
+		{"rate limited then ok", []int{429, 200}, "0", 2, nil},
+		{"gives up after max retries", []int{500, 500, 500, 500}, "", 3, ErrServerError},
+		{"not found is not retried", []int{404, 200}, "", 1, ErrNotFound},
+		{"retry-after beyond the limit is not waited for", []int{429, 200}, "3600", 1, ErrRateLimited},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/robots.txt" {
+					http.NotFound(w, r)
+					return
+				}
+				status := tt.statuses[requests]
+				requests++
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(status)
+				w.Write([]byte("<p>page</p>"))
+			}))
+			defer server.Close()
+
+			client := NewClient()
+			client.SetRateLimit(0, 1)
+			client.SetRetries(2, time.Millisecond, 10*time.Millisecond)
+
+			resp, err := client.Get(server.URL + "/page")
+			if err != nil {
+				t.Fatalf("Get() failed: %v", err)
+			}
+			defer resp.Body.Close()
+
+			err = CheckStatus(resp)
+			if tt.target == nil && err != nil {
+				t.Errorf("CheckStatus() = %v, want nil", err)
+			}
+			if tt.target != nil && !errors.Is(err, tt.target) {
+				t.Errorf("CheckStatus() = %v, want %v", err, tt.target)
+			}
+			if requests != tt.requests {
+				t.Errorf("server saw %d requests, want %d", requests, tt.requests)
+			}
+		})
+	}
+}
+
+func TestClient_RetryAfterIsReported(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "7200")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	client := NewClient()
+	client.SetRateLimit(0, 1)
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+	resp.Body.Close()
+
+	var statusErr *StatusError
+	if !errors.As(CheckStatus(resp), &statusErr) {
+		t.Fatalf("CheckStatus() did not return a *StatusError")
+	}
+	if statusErr.RetryAfter != 2*time.Hour {
+		t.Errorf("RetryAfter = %v, want 2h", statusErr.RetryAfter)
+	}
+}
+
+func TestClient_GetContextCancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := NewClient()
+	client.SetRateLimit(0, 1)
+	client.SetRetries(5, time.Hour, time.Hour)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := client.GetContext(ctx, server.URL); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("GetContext() error = %v, want the context to stop the retry wait", err)
+	}
+}
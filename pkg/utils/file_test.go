@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "page.html")
+
+	for _, content := range []string{"first", "second"} {
+		if err := WriteFileAtomic(filename, []byte(content)); err != nil {
+			t.Fatalf("WriteFileAtomic() failed: %v", err)
+		}
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatalf("ReadFile() failed: %v", err)
+		}
+		if string(data) != content {
+			t.Errorf("file contains %q, want %q", data, content)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory has %d entries, want only the file (no temporary files left)", len(entries))
+	}
+}
+
+func TestWriteFileAtomic_MissingDirectory(t *testing.T) {
+	if err := WriteFileAtomic(filepath.Join(t.TempDir(), "missing", "page.html"), []byte("x")); err == nil {
+		t.Error("WriteFileAtomic() into a missing directory expected error")
+	}
+}
@@ -1,21 +1,178 @@
 package utils
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
 
 	"github.com/linuxswords/wandering-inn/internal/config"
 	"github.com/linuxswords/wandering-inn/internal/models"
 )
 
-func GenerateFilename(chapters []models.Chapter) string {
-	if len(chapters) == 0 {
-		return config.DefaultFilename
+// FilenameData is what a filename template is filled in from.
+type FilenameData struct {
+	Series   string
+	Chapters []models.Chapter
+	Date     time.Time
+	// Ext is the extension of the output format, without the dot.
+	Ext string
+}
+
+// CollisionPolicy says what happens when a generated filename exists.
+type CollisionPolicy string
+
+const (
+	// CollisionSuffix appends _2, _3, ... to the name until it is free.
+	CollisionSuffix CollisionPolicy = "suffix"
+	// CollisionOverwrite replaces the existing file.
+	CollisionOverwrite CollisionPolicy = "overwrite"
+)
+
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([a-z]+)\s*\}\}`)
+
+// GenerateFilename fills in a filename template such as
+// "{{series}}_v{{volume}}_{{first}}-{{last}}.{{ext}}". Each field is passed
+// through SanitizeFilename; the template's own text, including any
+// directories, is kept as it is, except that the text introducing an empty
+// field goes with it: "twi_v{{volume}}_{{range}}" gives "twi_1.00" for a
+// chapter of unknown volume. Fields:
+//
+//	series  the series name
+//	volume  the volume number, "3-5" for several volumes, empty if unknown
+//	first   the title of the first chapter
+//	last    the title of the last chapter
+//	range   first-last, or just first for a single chapter
+//	count   the number of chapters
+//	date    the date of the build, as 2006-01-02
+//	ext     the extension of the output format, e.g. epub
+func GenerateFilename(template string, data FilenameData) (string, error) {
+	if len(data.Chapters) == 0 {
+		return strings.TrimSuffix(config.DefaultFilename, filepath.Ext(config.DefaultFilename)) + "." + data.Ext, nil
+	}
+
+	fields := filenameFields(data)
+	var unknown []string
+	var name strings.Builder
+	last := 0
+	for _, match := range placeholderPattern.FindAllStringSubmatchIndex(template, -1) {
+		text := template[last:match[0]]
+		field := template[match[2]:match[3]]
+		value, ok := fields[field]
+		if !ok {
+			unknown = append(unknown, field)
+		}
+		if value == "" {
+			text = trimFieldPrefix(text)
+		}
+		name.WriteString(text)
+		name.WriteString(value)
+		last = match[1]
+	}
+	name.WriteString(template[last:])
+	if len(unknown) > 0 {
+		return "", fmt.Errorf("unknown field {{%s}} in filename template", unknown[0])
+	}
+	if strings.Contains(name.String(), "{{") || strings.Contains(name.String(), "}}") {
+		return "", fmt.Errorf("malformed placeholder in filename template %q", template)
+	}
+
+	// Fields that are empty can leave separators at the ends of the name
+	dir, base := filepath.Split(name.String())
+	ext := filepath.Ext(base)
+	base = strings.Trim(strings.TrimSuffix(base, ext), "_-") + ext
+	if base == "" || strings.HasPrefix(base, ".") {
+		return "", fmt.Errorf("filename template %q gives an empty name", template)
+	}
+	return dir + base, nil
+}
+
+// trimFieldPrefix removes the text that introduces an empty field, such as
+// the "_v" of "_v{{volume}}": the letters right before the field and one
+// separator before them.
+func trimFieldPrefix(text string) string {
+	text = strings.TrimRightFunc(text, unicode.IsLetter)
+	if strings.ContainsAny(text[max(len(text)-1, 0):], "_-. ") {
+		text = text[:len(text)-1]
 	}
+	return text
+}
+
+// CheckFilenameTemplate reports whether template is a valid filename
+// template.
+func CheckFilenameTemplate(template string) error {
+	_, err := GenerateFilename(template, FilenameData{Chapters: []models.Chapter{{Title: "1.00"}}, Ext: "epub"})
+	return err
+}
+
+func filenameFields(data FilenameData) map[string]string {
+	first := SanitizeFilename(data.Chapters[0].Title)
+	last := SanitizeFilename(data.Chapters[len(data.Chapters)-1].Title)
+	fields := map[string]string{
+		"series": "",
+		"volume": volumeField(data.Chapters),
+		"first":  first,
+		"last":   last,
+		"range":  first,
+		"count":  strconv.Itoa(len(data.Chapters)),
+		"date":   data.Date.Format(time.DateOnly),
+		"ext":    SanitizeFilename(data.Ext),
+	}
+	if data.Series != "" {
+		fields["series"] = SanitizeFilename(data.Series)
+	}
+	if len(data.Chapters) > 1 {
+		fields["range"] = first + "-" + last
+	}
+	return fields
+}
 
-	startChapter := SanitizeFilename(chapters[0].Title)
-	return fmt.Sprintf("wandering_inn_%s.epub", startChapter)
+// volumeField returns the volume numbers of the chapters, or "" if any
+// chapter's volume is unknown.
+func volumeField(chapters []models.Chapter) string {
+	var first, last string
+	for _, chapter := range chapters {
+		match := config.VolumePattern.FindStringSubmatch(chapter.Volume)
+		if match == nil {
+			return ""
+		}
+		if first == "" {
+			first = match[1]
+		}
+		last = match[1]
+	}
+	if first == last {
+		return first
+	}
+	return first + "-" + last
+}
+
+// ResolveCollision returns the path to write to when path may exist already.
+// With CollisionSuffix, an existing file is left alone and the first free
+// name of the form name_2.ext, name_3.ext, ... is returned.
+func ResolveCollision(path string, policy CollisionPolicy) (string, error) {
+	if policy == CollisionOverwrite {
+		return path, nil
+	}
+
+	ext := filepath.Ext(path)
+	stem := strings.TrimSuffix(path, ext)
+	candidate := path
+	for i := 2; ; i++ {
+		_, err := os.Stat(candidate)
+		if errors.Is(err, os.ErrNotExist) {
+			return candidate, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		candidate = fmt.Sprintf("%s_%d%s", stem, i, ext)
+	}
 }
 
 func SanitizeFilename(title string) string {
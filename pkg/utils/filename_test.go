@@ -1,49 +1,120 @@
 package utils
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/linuxswords/wandering-inn/internal/config"
 	"github.com/linuxswords/wandering-inn/internal/models"
 )
 
 func TestGenerateFilename(t *testing.T) {
+	date := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	volume8 := []models.Chapter{
+		{Title: "8.00", Volume: "Volume 8"},
+		{Title: "Interlude – The Last Hero!", Volume: "Volume 8"},
+	}
+
 	tests := []struct {
-		name     string
-		chapters []models.Chapter
-		expected string
+		name        string
+		template    string
+		chapters    []models.Chapter
+		expected    string
+		expectError bool
 	}{
 		{
 			name:     "empty chapters",
+			template: config.FilenameTemplate,
 			chapters: []models.Chapter{},
 			expected: "wandering_inn.epub",
 		},
 		{
-			name: "single chapter",
-			chapters: []models.Chapter{
-				{Title: "Chapter 1.00", URL: "test", Index: 0},
-			},
+			name:     "single chapter",
+			template: config.FilenameTemplate,
+			chapters: []models.Chapter{{Title: "Chapter 1.00"}},
 			expected: "wandering_inn_chapter_1.00.epub",
 		},
 		{
-			name: "multiple chapters",
-			chapters: []models.Chapter{
-				{Title: "Chapter 1.00", URL: "test", Index: 0},
-				{Title: "Chapter 1.01", URL: "test", Index: 1},
-			},
-			expected: "wandering_inn_chapter_1.00.epub",
+			name:     "range of chapters",
+			template: config.FilenameTemplate,
+			chapters: []models.Chapter{{Title: "Chapter 1.00"}, {Title: "Chapter 1.01"}},
+			expected: "wandering_inn_chapter_1.00-chapter_1.01.epub",
+		},
+		{
+			name:     "every field",
+			template: "{{series}}_v{{volume}}_{{first}}-{{last}}_{{count}}_{{date}}.{{ext}}",
+			chapters: volume8,
+			expected: "the_wandering_inn_v8_8.00-interlude_the_last_hero_2_2024-05-01.epub",
+		},
+		{
+			name:     "several volumes",
+			template: "twi_v{{ volume }}.{{ext}}",
+			chapters: []models.Chapter{{Title: "3.00", Volume: "Volume 3"}, {Title: "5.00", Volume: "Volume 5"}},
+			expected: "twi_v3-5.epub",
+		},
+		{
+			name:     "unknown volume",
+			template: "{{range}}_{{volume}}.{{ext}}",
+			chapters: []models.Chapter{{Title: "1.00"}},
+			expected: "1.00.epub",
+		},
+		{
+			name:     "text before an unknown volume",
+			template: "wandering_inn_v{{volume}}_{{range}}_{{date}}.{{ext}}",
+			chapters: []models.Chapter{{Title: "1.00"}},
+			expected: "wandering_inn_1.00_2024-05-01.epub",
+		},
+		{
+			name:     "unknown volume first",
+			template: "v{{volume}}-{{range}}.{{ext}}",
+			chapters: []models.Chapter{{Title: "1.00"}},
+			expected: "1.00.epub",
+		},
+		{
+			name:     "directories in the template",
+			template: "{{series}}/volume_{{volume}}/{{range}}.{{ext}}",
+			chapters: volume8,
+			expected: "the_wandering_inn/volume_8/8.00-interlude_the_last_hero.epub",
+		},
+		{
+			name:        "unknown field",
+			template:    "{{title}}.{{ext}}",
+			chapters:    volume8,
+			expectError: true,
+		},
+		{
+			name:        "malformed placeholder",
+			template:    "{{first}.{{ext}}",
+			chapters:    volume8,
+			expectError: true,
 		},
 		{
-			name: "chapter with special characters",
-			chapters: []models.Chapter{
-				{Title: "Chapter 1.00 - The Last Hero", URL: "test", Index: 0},
-			},
-			expected: "wandering_inn_chapter_1.00_-_the_last_hero.epub",
+			name:        "empty name",
+			template:    "{{volume}}",
+			chapters:    []models.Chapter{{Title: "1.00"}},
+			expectError: true,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := GenerateFilename(tt.chapters)
+			result, err := GenerateFilename(tt.template, FilenameData{
+				Series:   "The Wandering Inn",
+				Chapters: tt.chapters,
+				Date:     date,
+				Ext:      "epub",
+			})
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("GenerateFilename() = %q, expected error", result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateFilename() unexpected error: %v", err)
+			}
 			if result != tt.expected {
 				t.Errorf("GenerateFilename() = %v, want %v", result, tt.expected)
 			}
@@ -51,6 +122,28 @@ func TestGenerateFilename(t *testing.T) {
 	}
 }
 
+func TestResolveCollision(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "book.epub")
+
+	if got, err := ResolveCollision(path, CollisionSuffix); err != nil || got != path {
+		t.Errorf("ResolveCollision() of a free name = %q, %v, want %q", got, err, path)
+	}
+
+	for _, name := range []string{"book.epub", "book_2.epub"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got, err := ResolveCollision(path, CollisionSuffix); err != nil || got != filepath.Join(dir, "book_3.epub") {
+		t.Errorf("ResolveCollision(suffix) = %q, %v, want book_3.epub", got, err)
+	}
+	if got, err := ResolveCollision(path, CollisionOverwrite); err != nil || got != path {
+		t.Errorf("ResolveCollision(overwrite) = %q, %v, want %q", got, err, path)
+	}
+}
+
 func TestSanitizeFilename(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -1,7 +1,9 @@
 package utils
 
 import (
-	"net/http"
+	"bytes"
+	"context"
+	"io"
 
 	"golang.org/x/net/html"
 )
@@ -27,11 +29,30 @@ func ExtractText(n *html.Node) string {
 }
 
 func FetchAndParse(url string) (*html.Node, error) {
-	resp, err := http.Get(url)
+	body, err := Fetch(url)
+	if err != nil {
+		return nil, err
+	}
+
+	return html.Parse(bytes.NewReader(body))
+}
+
+// Fetch returns the raw body of the page at url. Responses other than 200 OK
+// are returned as a *StatusError.
+func Fetch(url string) ([]byte, error) {
+	return FetchContext(context.Background(), url)
+}
+
+// FetchContext is like Fetch, but stops when ctx is done.
+func FetchContext(ctx context.Context, url string) ([]byte, error) {
+	resp, err := DefaultClient.GetContext(ctx, url)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	return html.Parse(resp.Body)
+	if err := CheckStatus(resp); err != nil {
+		return nil, err
+	}
+	return io.ReadAll(resp.Body)
 }
@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// tokenBucket allows bursts of up to capacity requests and refills one token
+// per interval. Callers that find the bucket empty reserve a future token, so
+// waiting requests are served in the order they arrived.
+type tokenBucket struct {
+	mu       sync.Mutex
+	interval time.Duration
+	capacity float64
+	tokens   float64
+	last     time.Time
+}
+
+func newTokenBucket(interval time.Duration, burst int) *tokenBucket {
+	burst = max(1, burst)
+	return &tokenBucket{
+		interval: interval,
+		capacity: float64(burst),
+		tokens:   float64(burst),
+	}
+}
+
+// setRate changes the refill interval and burst size, keeping at most burst
+// tokens.
+func (b *tokenBucket) setRate(interval time.Duration, burst int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.interval = interval
+	b.capacity = float64(max(1, burst))
+	b.tokens = min(b.tokens, b.capacity)
+}
+
+// reserve takes a token and returns how long the caller has to wait before
+// using it.
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.interval <= 0 {
+		return 0
+	}
+
+	if !b.last.IsZero() {
+		b.tokens = min(b.capacity, b.tokens+float64(now.Sub(b.last))/float64(b.interval))
+	}
+	b.last = now
+	b.tokens--
+
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens * float64(b.interval))
+}
+
+// wait blocks until the caller may send a request or ctx is done.
+func (b *tokenBucket) wait(ctx context.Context) error {
+	delay := b.reserve(time.Now())
+	if delay == 0 {
+		return nil
+	}
+	return sleep(ctx, delay)
+}
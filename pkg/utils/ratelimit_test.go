@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket_Reserve(t *testing.T) {
+	start := time.Now()
+	bucket := newTokenBucket(time.Second, 2)
+
+	tests := []struct {
+		name     string
+		at       time.Duration
+		expected time.Duration
+	}{
+		{"first token of the burst", 0, 0},
+		{"second token of the burst", 0, 0},
+		{"bucket empty", 0, time.Second},
+		{"queued behind the previous wait", 0, 2 * time.Second},
+		{"refilled after waiting", 4 * time.Second, 0},
+		{"refill is capped at the burst", 10 * time.Second, 0},
+		{"second token after long pause", 10 * time.Second, 0},
+		{"empty again", 10 * time.Second, time.Second},
+	}
+
+	for _, tt := range tests {
+		got := bucket.reserve(start.Add(tt.at))
+		if got != tt.expected {
+			t.Errorf("%s: reserve() = %v, want %v", tt.name, got, tt.expected)
+		}
+	}
+}
+
+func TestTokenBucket_SetRate(t *testing.T) {
+	now := time.Now()
+	bucket := newTokenBucket(time.Second, 4)
+	bucket.setRate(5*time.Second, 1)
+
+	if got := bucket.reserve(now); got != 0 {
+		t.Errorf("first reserve() = %v, want 0", got)
+	}
+	if got := bucket.reserve(now); got != 5*time.Second {
+		t.Errorf("second reserve() = %v, want 5s after lowering the burst", got)
+	}
+}
+
+func TestTokenBucket_NoLimit(t *testing.T) {
+	bucket := newTokenBucket(0, 1)
+	for i := 0; i < 10; i++ {
+		if got := bucket.reserve(time.Now()); got != 0 {
+			t.Fatalf("reserve() without interval = %v, want 0", got)
+		}
+	}
+}
+
+func TestTokenBucket_WaitCancelled(t *testing.T) {
+	bucket := newTokenBucket(time.Hour, 1)
+	bucket.wait(context.Background())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := bucket.wait(ctx); err != context.Canceled {
+		t.Errorf("wait() with cancelled context = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+const testRobots = `# robots.txt
+User-agent: *
+Disallow: /wp-admin/
+Allow: /wp-admin/admin-ajax.php
+Disallow: /*?replytocom=
+Disallow: /*.pdf$
+
+User-agent: wandering-inn
+User-agent: other-bot
+Disallow: /private
+Crawl-delay: 2.5
+
+User-agent: BadBot
+Disallow: /
+`
+
+func TestParseRobots(t *testing.T) {
+	tests := []struct {
+		name       string
+		agent      string
+		path       string
+		allowed    bool
+		crawlDelay time.Duration
+	}{
+		{"generic group allows pages", "some-bot", "/2017/03/03/1-00/", true, 0},
+		{"generic group disallows prefix", "some-bot", "/wp-admin/options.php", false, 0},
+		{"longer allow wins", "some-bot", "/wp-admin/admin-ajax.php", true, 0},
+		{"wildcard", "some-bot", "/1-00/?replytocom=5", false, 0},
+		{"anchored wildcard", "some-bot", "/files/map.pdf", false, 0},
+		{"anchored wildcard does not match longer path", "some-bot", "/files/map.pdf.html", true, 0},
+		{"own group replaces the generic one", "wandering-inn", "/wp-admin/options.php", true, 2500 * time.Millisecond},
+		{"own group rules apply", "wandering-inn", "/private/notes", false, 2500 * time.Millisecond},
+		{"agent names are case-insensitive", "badbot", "/", false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := parseRobots([]byte(testRobots), tt.agent)
+			if got := rules.allowed(tt.path); got != tt.allowed {
+				t.Errorf("allowed(%q) = %v, want %v", tt.path, got, tt.allowed)
+			}
+			if rules.crawlDelay != tt.crawlDelay {
+				t.Errorf("crawlDelay = %v, want %v", rules.crawlDelay, tt.crawlDelay)
+			}
+		})
+	}
+}
+
+func TestParseRobots_Empty(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"empty file", ""},
+		{"empty disallow", "User-agent: *\nDisallow:\n"},
+		{"no matching group", "User-agent: googlebot\nDisallow: /\n"},
+		{"rules before any user agent", "Disallow: /\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !parseRobots([]byte(tt.body), "wandering-inn").allowed("/anything") {
+				t.Error("allowed() = false, want everything allowed")
+			}
+		})
+	}
+}
+
+func TestRobotsMatch(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		path     string
+		expected bool
+	}{
+		{"/", "/anything", true},
+		{"/fish", "/fish.html", true},
+		{"/fish", "/Fish", false},
+		{"/fish$", "/fish", true},
+		{"/fish$", "/fish/", false},
+		{"/*.php", "/index.php?x=1", true},
+		{"/*.php$", "/index.php?x=1", false},
+		{"/a*b*c", "/axxbyyc", true},
+		{"/a*b*c", "/axxcyyb", false},
+	}
+
+	for _, tt := range tests {
+		if got := robotsMatch(tt.pattern, tt.path); got != tt.expected {
+			t.Errorf("robotsMatch(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.expected)
+		}
+	}
+}